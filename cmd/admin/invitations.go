@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+func (app *admin) invitationsCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "purge" {
+		return errors.New("usage: invitations purge")
+	}
+
+	if app.dryRun {
+		count, err := app.store.Users.CountExpiredInvitations(ctx)
+		if err != nil {
+			return err
+		}
+		return app.done("purged %d expired invitation(s)", count)
+	}
+
+	count, err := app.store.Users.DeleteExpiredInvitations(ctx)
+	if err != nil {
+		return err
+	}
+	return app.done("purged %d expired invitation(s)", count)
+}
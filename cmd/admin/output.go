@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+// table prints rows under header, or data as JSON when -o json is set.
+func (p *printer) table(data any, header []string, rows [][]string) error {
+	if p.json {
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) message(msg string) error {
+	if p.json {
+		return json.NewEncoder(p.w).Encode(map[string]string{"result": msg})
+	}
+	_, err := fmt.Fprintln(p.w, msg)
+	return err
+}
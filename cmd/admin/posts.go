@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/igorzinar/goSocial/internal/store"
+	"strconv"
+)
+
+func (app *admin) postsCommand(ctx context.Context, args []string) error {
+	if len(args) < 2 || args[0] != "delete" {
+		return errors.New("usage: posts delete <postID>")
+	}
+
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid post id %q", args[1])
+	}
+
+	post, err := app.store.Posts.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("post %d not found", id)
+		}
+		return err
+	}
+
+	if !app.dryRun {
+		if err := app.store.Posts.Delete(ctx, post.ID); err != nil {
+			return err
+		}
+	}
+	return app.done("deleted post %d %q by user %d", post.ID, post.Title, post.UserID)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"strconv"
+)
+
+func (app *admin) statsCommand(ctx context.Context) error {
+	stats, err := app.store.Stats.Tables(ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(stats))
+	for i, t := range stats {
+		rows[i] = []string{
+			t.Name,
+			strconv.FormatInt(t.LiveRows, 10),
+			strconv.FormatInt(t.DeadRows, 10),
+			strconv.FormatInt(t.TotalBytes, 10),
+		}
+	}
+	return app.out.table(stats, []string{"TABLE", "LIVE ROWS", "DEAD ROWS", "TOTAL BYTES"}, rows)
+}
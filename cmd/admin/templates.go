@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/igorzinar/goSocial/internal/mailer"
+	"os"
+	"sort"
+	"strings"
+)
+
+func templatesCommand(templates *mailer.Templates, out *printer, args []string) error {
+	if len(args) == 0 {
+		return errors.New("templates: missing subcommand")
+	}
+
+	switch args[0] {
+	case "list":
+		names := templates.Names()
+		rows := make([][]string, len(names))
+		for i, name := range names {
+			sample, _ := templates.Sample(name)
+			vars := make([]string, 0, len(sample))
+			for k := range sample {
+				vars = append(vars, k)
+			}
+			sort.Strings(vars)
+			rows[i] = []string{name, strings.Join(vars, ", ")}
+		}
+		return out.table(names, []string{"TEMPLATE", "VARIABLES"}, rows)
+	case "preview":
+		if len(args) < 2 {
+			return errors.New("usage: templates preview <template> [-part html|text|subject] [-data file.json]")
+		}
+		fs := flag.NewFlagSet("templates preview", flag.ContinueOnError)
+		part := fs.String("part", "html", "part to print: html, text or subject")
+		dataFile := fs.String("data", "", "JSON file with the template data, defaults to the template sample")
+		if err := fs.Parse(args[2:]); err != nil {
+			return err
+		}
+
+		name := args[1]
+		data, err := templates.Sample(name)
+		if err != nil {
+			return err
+		}
+		if *dataFile != "" {
+			raw, err := os.ReadFile(*dataFile)
+			if err != nil {
+				return err
+			}
+			data = map[string]any{}
+			if err := json.Unmarshal(raw, &data); err != nil {
+				return fmt.Errorf("parsing %s: %w", *dataFile, err)
+			}
+		}
+
+		rendered, err := templates.Render(name, data)
+		if err != nil {
+			return err
+		}
+		if out.json {
+			return json.NewEncoder(out.w).Encode(rendered)
+		}
+
+		switch *part {
+		case "html":
+			_, err = fmt.Fprint(out.w, rendered.HTML)
+		case "text":
+			_, err = fmt.Fprint(out.w, rendered.Text)
+		case "subject":
+			_, err = fmt.Fprintln(out.w, rendered.Subject)
+		default:
+			return fmt.Errorf("unknown part %q", *part)
+		}
+		return err
+	default:
+		return fmt.Errorf("templates: unknown subcommand %q", args[0])
+	}
+}
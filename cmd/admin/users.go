@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/igorzinar/goSocial/internal/mailer"
+	"github.com/igorzinar/goSocial/internal/store"
+	"strconv"
+	"time"
+)
+
+func (app *admin) usersCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("users: missing subcommand")
+	}
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("users list", flag.ContinueOnError)
+		active := fs.String("active", "", "filter by activation status (true or false)")
+		limit := fs.Int("limit", 50, "maximum number of users")
+		offset := fs.Int("offset", 0, "number of users to skip")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		q := store.UserListQuery{Limit: *limit, Offset: *offset}
+		if *active != "" {
+			v, err := strconv.ParseBool(*active)
+			if err != nil {
+				return fmt.Errorf("invalid -active value %q", *active)
+			}
+			q.Active = &v
+		}
+		return app.listUsers(ctx, q)
+	case "search":
+		if len(args) < 2 {
+			return errors.New("usage: users search <query>")
+		}
+		return app.listUsers(ctx, store.UserListQuery{Search: args[1], Limit: 50})
+	case "activate", "deactivate":
+		user, err := app.userArg(ctx, args)
+		if err != nil {
+			return err
+		}
+		active := args[0] == "activate"
+		if !app.dryRun {
+			if err := app.store.Users.SetActive(ctx, user.ID, active); err != nil {
+				return err
+			}
+		}
+		return app.done("%s user %d (%s)", args[0]+"d", user.ID, user.Username)
+	case "resend-invitation":
+		user, err := app.userArg(ctx, args)
+		if err != nil {
+			return err
+		}
+		return app.resendInvitation(ctx, user)
+	case "set-role":
+		if len(args) < 3 {
+			return errors.New("usage: users set-role <userID> <role>")
+		}
+		user, err := app.userArg(ctx, args)
+		if err != nil {
+			return err
+		}
+		role, err := app.store.Roles.GetByName(ctx, args[2])
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				return fmt.Errorf("role %q does not exist", args[2])
+			}
+			return err
+		}
+		if !app.dryRun {
+			if err := app.store.Users.SetRole(ctx, user.ID, role.ID); err != nil {
+				return err
+			}
+		}
+		return app.done("changed role of user %d (%s) from %s to %s", user.ID, user.Username, user.Role.Name, role.Name)
+	default:
+		return fmt.Errorf("users: unknown subcommand %q", args[0])
+	}
+}
+
+func (app *admin) listUsers(ctx context.Context, q store.UserListQuery) error {
+	users, err := app.store.Users.List(ctx, q)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(users))
+	for i, u := range users {
+		rows[i] = []string{
+			strconv.FormatInt(u.ID, 10),
+			u.Username,
+			u.Email,
+			u.Role.Name,
+			strconv.FormatBool(u.IsActive),
+			u.CreatedAt.Format(time.DateTime),
+		}
+	}
+	return app.out.table(users, []string{"ID", "USERNAME", "EMAIL", "ROLE", "ACTIVE", "CREATED"}, rows)
+}
+
+// userArg loads the user whose id is the second argument.
+func (app *admin) userArg(ctx context.Context, args []string) (*store.User, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("usage: users %s <userID>", args[0])
+	}
+	id, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id %q", args[1])
+	}
+
+	user, err := app.store.Users.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("user %d not found", id)
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (app *admin) resendInvitation(ctx context.Context, user *store.User) error {
+	if user.IsActive {
+		return fmt.Errorf("user %d (%s) is already active", user.ID, user.Username)
+	}
+	if app.dryRun {
+		return app.done("queued a new invitation to %s", user.Email)
+	}
+
+	plainToken := uuid.New().String()
+	hash := sha256.Sum256([]byte(plainToken))
+	hashToken := hex.EncodeToString(hash[:])
+
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: fmt.Sprintf("%s/activation/%s", app.config.frontendURL, plainToken),
+	}
+	email, err := store.NewOutboxEmail(app.templates.Localized(mailer.UserWelcomeTemplate, user.PreferredLocale), user.Username, user.Email, vars)
+	if err != nil {
+		return err
+	}
+
+	// the email goes through the outbox like the API's, admins skip the
+	// resend cooldown
+	if _, err := app.store.Users.ResendInvitation(ctx, user.ID, hashToken, app.config.mailExp, 0, email); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("user %d (%s) is already active", user.ID, user.Username)
+		}
+		return err
+	}
+	return app.done("queued a new invitation to %s", user.Email)
+}
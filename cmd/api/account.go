@@ -0,0 +1,322 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/igorzinar/goSocial/internal/mailer"
+	"github.com/igorzinar/goSocial/internal/store"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	errSameEmail       = errors.New("the new email must differ from the current one")
+	errInvalidPassword = errors.New("invalid password")
+)
+
+type ChangeEmailPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// changeEmailHandler godoc
+//
+//	@Summary		Requests an email change
+//	@Description	Sends a confirmation link to the new address and a notice to the current one. The email is only changed once confirmed.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ChangeEmailPayload	true	"New email"
+//	@Param			Idempotency-Key	header		string	false	"Makes retries of the request safe"
+//	@Success		202		{string}	string				"Confirmation sent"
+//	@Failure		400		{object}	Problem
+//	@Failure		401		{object}	Problem
+//	@Failure		409	{object}	Problem	"Idempotency key reused for a different request"
+//	@Failure		425	{object}	Problem	"Idempotent request still in progress"
+//	@Failure		500		{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/email [post]
+func (app *application) changeEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ChangeEmailPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getAuthUser(r)
+	if strings.EqualFold(user.Email, payload.Email) {
+		app.badRequestResponse(w, r, errSameEmail)
+		return
+	}
+
+	plainToken := uuid.New().String()
+	confirmVars := struct {
+		Username        string
+		NewEmail        string
+		ConfirmationURL string
+	}{
+		Username:        user.Username,
+		NewEmail:        payload.Email,
+		ConfirmationURL: fmt.Sprintf("%s/confirm-email/%s", app.config.frontendURL, plainToken),
+	}
+	confirm, err := store.NewOutboxEmail(app.templates.Localized(mailer.EmailChangeConfirmTemplate, user.PreferredLocale), user.Username, payload.Email, confirmVars)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	noticeVars := struct {
+		Username string
+		NewEmail string
+	}{
+		Username: user.Username,
+		NewEmail: payload.Email,
+	}
+	notice, err := store.NewOutboxEmail(app.templates.Localized(mailer.EmailChangeNoticeTemplate, user.PreferredLocale), user.Username, user.Email, noticeVars)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	err = app.store.Users.RequestEmailChange(r.Context(), user.ID, payload.Email, hashToken(plainToken), app.config.mail.emailChangeExp, confirm, notice)
+	if err != nil {
+		switch err {
+		case store.ErrDuplicateEmail:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// confirmEmailChangeHandler godoc
+//
+//	@Summary		Confirms an email change
+//	@Description	Swaps the email of the account and signs it out of every session
+//	@Tags			users
+//	@Produce		json
+//	@Param			token	path		string	true	"Confirmation token"
+//	@Success		204		{string}	string	"Email changed"
+//	@Failure		400		{object}	Problem	"Email taken in the meantime"
+//	@Failure		404		{object}	Problem	"Unknown token"
+//	@Failure		410		{object}	Problem	"Expired token"
+//	@Failure		500		{object}	Problem
+//	@Router			/users/email/confirm/{token} [put]
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+
+	if _, err := app.store.Users.ConfirmEmailChange(r.Context(), hashToken(token)); err != nil {
+		switch err {
+		case store.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		case store.ErrExpired:
+			app.goneResponse(w, r, err)
+		case store.ErrDuplicateEmail:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getMeHandler godoc
+//
+//	@Summary		Fetches the authenticated user
+//	@Description	Fetches the account and profile of the authenticated user
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	store.User
+//	@Failure		401	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [get]
+func (app *application) getMeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusOK, getAuthUser(r)); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UpdateProfilePayload only changes the fields that are present, empty
+// strings clear optional fields.
+type UpdateProfilePayload struct {
+	Username        *string `json:"username" validate:"omitempty,min=3,max=100"`
+	DisplayName     *string `json:"display_name" validate:"omitempty,max=100"`
+	Bio             *string `json:"bio" validate:"omitempty,max=500"`
+	Website         *string `json:"website" validate:"omitempty,weburl,max=255"`
+	Location        *string `json:"location" validate:"omitempty,max=100"`
+	PreferredLocale *string `json:"preferred_locale" validate:"omitempty,bcp47_language_tag"`
+}
+
+// updateMeHandler godoc
+//
+//	@Summary		Updates the authenticated user
+//	@Description	Updates the profile, username and locale of the authenticated user. The username can only change once per cooldown period.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdateProfilePayload	true	"Profile fields"
+//	@Success		200		{object}	store.User
+//	@Failure		400		{object}	Problem
+//	@Failure		401		{object}	Problem
+//	@Failure		409		{object}	Problem	"Username changed too recently"
+//	@Failure		500		{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [patch]
+func (app *application) updateMeHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateProfilePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getAuthUser(r)
+	if payload.Username != nil {
+		user.Username = *payload.Username
+	}
+	if payload.DisplayName != nil {
+		user.DisplayName = *payload.DisplayName
+	}
+	if payload.Bio != nil {
+		user.Bio = *payload.Bio
+	}
+	if payload.Website != nil {
+		user.Website = *payload.Website
+	}
+	if payload.Location != nil {
+		user.Location = *payload.Location
+	}
+	if payload.PreferredLocale != nil {
+		user.PreferredLocale = *payload.PreferredLocale
+	}
+
+	if err := app.store.Users.UpdateProfile(r.Context(), user, app.config.accounts.usernameCooldown); err != nil {
+		switch err {
+		case store.ErrDuplicateUsername:
+			app.badRequestResponse(w, r, err)
+		case store.ErrUsernameCooldown:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getUserByUsernameHandler godoc
+//
+//	@Summary		Fetches a user profile by username
+//	@Description	Fetches a user profile by its handle, previous handles redirect to the current one
+//	@Tags			users
+//	@Produce		json
+//	@Param			username	path		string	true	"Username"
+//	@Success		200			{object}	store.PublicUser
+//	@Success		307			{string}	string	"Redirect to the current handle"
+//	@Failure		404			{object}	Problem
+//	@Failure		500			{object}	Problem
+//	@Router			/users/by-username/{username} [get]
+func (app *application) getUserByUsernameHandler(w http.ResponseWriter, r *http.Request) {
+	username := chi.URLParam(r, "username")
+	ctx := r.Context()
+
+	user, err := app.store.Users.GetByUsername(ctx, username)
+	if errors.Is(err, store.ErrNotFound) {
+		// handles can be claimed again, so the redirect is not permanent
+		current, err := app.store.Users.ResolveUsername(ctx, username)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case err != nil:
+			app.internalServerError(w, r, err)
+		default:
+			http.Redirect(w, r, "/v1/users/by-username/"+url.PathEscape(current), http.StatusTemporaryRedirect)
+		}
+		return
+	}
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, user.Public()); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type DeletionSchedule struct {
+	DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+}
+
+// deleteMeHandler godoc
+//
+//	@Summary		Deletes the authenticated user
+//	@Description	Schedules the erasure of the account and all its content after the grace period and signs out every session. Logging in before then cancels the deletion.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		DeleteAccountPayload	true	"Password confirmation"
+//	@Success		202		{object}	DeletionSchedule
+//	@Failure		400		{object}	Problem
+//	@Failure		401		{object}	Problem
+//	@Failure		403		{object}	Problem	"Wrong password"
+//	@Failure		500		{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me [delete]
+func (app *application) deleteMeHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DeleteAccountPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getAuthUser(r)
+	if !user.Password.Matches(payload.Password) {
+		app.forbiddenResponse(w, r, errInvalidPassword)
+		return
+	}
+
+	at := app.clock().Add(app.config.accounts.deletionGrace)
+	if err := app.store.Users.ScheduleDeletion(r.Context(), user.ID, at); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, DeletionSchedule{DeletionScheduledAt: at}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
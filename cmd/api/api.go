@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/igorzinar/goSocial/docs" // this is required to generate swagger docs
+	"github.com/igorzinar/goSocial/internal/exports"
+	"github.com/igorzinar/goSocial/internal/health"
+	"github.com/igorzinar/goSocial/internal/i18n"
 	"github.com/igorzinar/goSocial/internal/mailer"
+	"github.com/igorzinar/goSocial/internal/media"
 	"github.com/igorzinar/goSocial/internal/store"
 	"github.com/swaggo/http-swagger/v2"
 	"go.uber.org/zap"
@@ -14,10 +20,17 @@ import (
 )
 
 type application struct {
-	config config
-	store  store.Storage
-	logger *zap.SugaredLogger
-	mailer mailer.Client
+	config    config
+	store     store.Storage
+	logger    *zap.SugaredLogger
+	mailer    mailer.Client
+	templates *mailer.Templates
+	media     media.Storage
+	signer    *exports.Signer
+	i18n      *i18n.Catalog
+	health    *health.Registry
+	// clock is the time source of the handlers, tests replace it.
+	clock func() time.Time
 }
 
 type config struct {
@@ -26,13 +39,133 @@ type config struct {
 	env         string
 	apiUrl      string
 	frontendURL string
+	http        httpConfig
 	mail        mailConfig
+	logger      loggerConfig
+	health      healthConfig
+	accounts    accountsConfig
+	auth        authConfig
+	media       mediaConfig
+	exports     exportsConfig
+	idempotency idempotencyConfig
+	trending    trendingConfig
+	feed        feedConfig
+	suggestions suggestionsConfig
+}
+
+type suggestionsConfig struct {
+	interval time.Duration
+	// minFollowing is the number of follows from which a user's suggestions
+	// are precomputed rather than computed on request.
+	minFollowing int
+	// size is the number of suggestions precomputed per user.
+	size int
+}
+
+type feedConfig struct {
+	// candidates is the number of recent posts the ranked feed ranks.
+	candidates int
+	// halfLife is the age at which the recency of a post counts for half.
+	halfLife time.Duration
+}
+
+type trendingConfig struct {
+	interval time.Duration
+	// window bounds the age of the activity scored.
+	window time.Duration
+	// halfLife is the age at which activity counts for half.
+	halfLife time.Duration
+	// size is the number of tags and posts kept in the snapshot.
+	size int
+}
+
+type idempotencyConfig struct {
+	// ttl is how long a response is kept to be replayed.
+	ttl time.Duration
+}
+
+type exportsConfig struct {
+	ttl         time.Duration
+	signingKey  string
+	interval    time.Duration
+	lease       time.Duration
+	maxAttempts int
+}
+
+type mediaConfig struct {
+	dir           string
+	maxAvatarSize int64
+}
+
+type authConfig struct {
+	tokenExp time.Duration
+}
+
+type accountsConfig struct {
+	purgeInterval time.Duration
+	// unactivatedGrace is how long an account whose invitation expired is
+	// kept before being purged.
+	unactivatedGrace time.Duration
+	// usernameCooldown is the minimum delay between two username changes.
+	usernameCooldown time.Duration
+	// deletionGrace is how long a deleted account can still be restored by
+	// logging in.
+	deletionGrace time.Duration
+}
+
+type httpConfig struct {
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	idleTimeout    time.Duration
+	requestTimeout time.Duration
+}
+
+type healthConfig struct {
+	timeout time.Duration
+}
+
+type loggerConfig struct {
+	level       string
+	format      string
+	sampleEvery uint64
 }
 
 type mailConfig struct {
+	provider  string
 	fromEmail string
 	exp       time.Duration
-	sendGrid  sendGridConfig
+	// resendCooldown is the minimum delay between two activation emails.
+	resendCooldown time.Duration
+	// emailChangeExp is how long an email change can be confirmed.
+	emailChangeExp time.Duration
+	sendGrid       sendGridConfig
+	smtp           smtpConfig
+	file           fileMailConfig
+	outbox         outboxConfig
+}
+
+type outboxConfig struct {
+	interval    time.Duration
+	batchSize   int
+	lease       time.Duration
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	// retention is how long sent emails are kept before being purged.
+	retention time.Duration
+}
+
+type fileMailConfig struct {
+	dir string
+}
+
+type smtpConfig struct {
+	host     string
+	port     int
+	username string
+	password string
+	security string
+	auth     string
 }
 
 type sendGridConfig struct {
@@ -44,6 +177,8 @@ type dbConfig struct {
 	maxOpenConns int
 	maxIdleConns int
 	maxIdleTime  string
+	queryTimeout time.Duration
+	autoMigrate  bool
 }
 
 func (app *application) mount() http.Handler {
@@ -52,21 +187,36 @@ func (app *application) mount() http.Handler {
 	// A good base middleware stack
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	r.Use(app.logRequests)
 	r.Use(middleware.Recoverer)
+	r.Use(app.negotiateLocale)
 
 	// Set a timeout value on the request context (ctx), that will signal
 	// through ctx.Done() that the request has timed out and further
 	// processing should be stopped.
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(middleware.Timeout(app.config.http.requestTimeout))
+
+	// set before the routes, the subrouters inherit them when mounted
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		app.notFoundResponse(w, r, fmt.Errorf("no route for %s", r.URL.Path))
+	})
+	r.MethodNotAllowed(app.methodNotAllowedResponse)
 
 	r.Route("/v1", func(r chi.Router) {
-		r.Get("/health", app.healthCheckHandler)
+		r.Route("/health", func(r chi.Router) {
+			r.Use(app.sampleLogs)
+			r.Get("/live", app.healthCheckHandler)
+			r.Get("/ready", app.readinessHandler)
+		})
 		docsUrl := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsUrl)))
 
+		if app.config.env == "development" {
+			r.Get("/debug/mailbox", app.mailboxHandler)
+		}
+
 		r.Route("/posts", func(r chi.Router) {
-			r.Post("/", app.createPostHandler)
+			r.With(app.authTokenMiddleware, app.idempotencyMiddleware).Post("/", app.createPostHandler)
 			//r.Route("/{postID}", func(r chi.Router) {
 			//	//r.Use(app.postsContextMiddleware)
 			//	r.Get("/", app.getPostHandler)
@@ -78,10 +228,34 @@ func (app *application) mount() http.Handler {
 				r.Get("/", app.getPostHandler)
 				r.Patch("/", app.updatePostHandler)
 				r.Delete("/", app.deletePostHandler)
+				r.With(app.authTokenMiddleware).Put("/bookmark", app.saveBookmarkHandler)
+				r.With(app.authTokenMiddleware).Delete("/bookmark", app.deleteBookmarkHandler)
 			})
 		})
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Put("/email/confirm/{token}", app.confirmEmailChangeHandler)
+			r.Get("/by-username/{username}", app.getUserByUsernameHandler)
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.authTokenMiddleware)
+				r.Get("/", app.getMeHandler)
+				r.Patch("/", app.updateMeHandler)
+				r.Delete("/", app.deleteMeHandler)
+				r.With(app.idempotencyMiddleware).Post("/email", app.changeEmailHandler)
+				r.Put("/avatar", app.uploadAvatarHandler)
+				r.Delete("/avatar", app.deleteAvatarHandler)
+				r.With(app.idempotencyMiddleware).Post("/export", app.requestExportHandler)
+				r.Get("/exports", app.listExportsHandler)
+				r.Get("/suggestions", app.getSuggestionsHandler)
+				r.Delete("/suggestions/{userID}", app.dismissSuggestionHandler)
+				r.Get("/blocks", app.listBlocksHandler)
+				r.Put("/blocks/{userID}", app.blockUserHandler)
+				r.Delete("/blocks/{userID}", app.unblockUserHandler)
+				r.Get("/bookmarks", app.listBookmarksHandler)
+				r.Get("/collections", app.listCollectionsHandler)
+				r.Post("/collections", app.createCollectionHandler)
+				r.Delete("/collections/{collectionID}", app.deleteCollectionHandler)
+			})
 			r.Route("/{userID}", func(r chi.Router) {
 				r.Use(app.userContextMiddleware)
 				r.Get("/", app.getUserHandler)
@@ -89,20 +263,47 @@ func (app *application) mount() http.Handler {
 				r.Put("/unfollow", app.unfollowUserHandler)
 			})
 			r.Group(func(r chi.Router) {
+				r.Use(app.authTokenMiddleware)
 				r.Get("/feed", app.getUserFeedHandler)
 			})
 
 		})
+		r.Route("/tags", func(r chi.Router) {
+			r.Get("/", app.searchTagsHandler)
+			r.Get("/{tag}/posts", app.getTagPostsHandler)
+		})
+		r.Route("/trending", func(r chi.Router) {
+			r.Get("/tags", app.getTrendingTagsHandler)
+			r.Get("/posts", app.getTrendingPostsHandler)
+		})
+		r.Route("/search", func(r chi.Router) {
+			r.Use(app.authTokenMiddleware)
+			r.Get("/users", app.searchUsersHandler)
+		})
 		// Public rote
+		r.Get("/media/{mediaID}", app.getMediaHandler)
+		r.Get("/exports/{exportID}/download", app.downloadExportHandler)
+
 		r.Route("/authentication", func(r chi.Router) {
+			// the responses of /user and /token carry tokens, they must not
+			// be stored by the idempotency middleware
 			r.Post("/user", app.registerUserHandler)
+			r.With(app.idempotencyMiddleware).Post("/resend-activation", app.resendActivationHandler)
+			r.Post("/token", app.createTokenHandler)
+			r.With(app.authTokenMiddleware).Delete("/token", app.deleteTokenHandler)
 		})
 	})
 
 	return r
 }
 
-func (app *application) run(mux http.Handler) error {
+// shutdownTimeout bounds how long in-flight requests may take to complete
+// once the server is asked to stop.
+const shutdownTimeout = 30 * time.Second
+
+// run serves mux until ctx is cancelled, then shuts the server down
+// gracefully.
+func (app *application) run(ctx context.Context, mux http.Handler) error {
 	// Docks
 	docs.SwaggerInfo.Version = version
 	docs.SwaggerInfo.Host = app.config.apiUrl
@@ -110,11 +311,24 @@ func (app *application) run(mux http.Handler) error {
 	srv := &http.Server{
 		Addr:         app.config.addr,
 		Handler:      mux,
-		WriteTimeout: 30 * time.Second,
-		ReadTimeout:  10 * time.Second,
-		IdleTimeout:  time.Minute,
+		WriteTimeout: app.config.http.writeTimeout,
+		ReadTimeout:  app.config.http.readTimeout,
+		IdleTimeout:  app.config.http.idleTimeout,
 	}
 
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		app.logger.Info("shutting down server")
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		shutdown <- srv.Shutdown(ctx)
+	}()
+
 	app.logger.Infow("starting server", "addr", srv.Addr, "env", app.config.env)
-	return srv.ListenAndServe()
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-shutdown
 }
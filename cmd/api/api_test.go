@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/igorzinar/goSocial/internal/exports"
+	"github.com/igorzinar/goSocial/internal/health"
+	"github.com/igorzinar/goSocial/internal/i18n"
+	"github.com/igorzinar/goSocial/internal/jobs"
+	"github.com/igorzinar/goSocial/internal/mailer"
+	"github.com/igorzinar/goSocial/internal/media"
+	"github.com/igorzinar/goSocial/internal/outbox"
+	"github.com/igorzinar/goSocial/internal/store"
+	"github.com/igorzinar/goSocial/internal/store/memstore"
+	"github.com/igorzinar/goSocial/internal/testdb"
+	"go.uber.org/zap"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// testClock is the time source shared by the application and the in-memory
+// store. It starts at the real time so it agrees with NOW() in Postgres.
+type testClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// testApp is an application served by an httptest server. Its config can be
+// changed between requests, handlers read it on every call.
+type testApp struct {
+	*application
+	t      *testing.T
+	clock  *testClock
+	mailer *mailer.MemoryMailer
+	server *httptest.Server
+	client *http.Client
+}
+
+// newTestApp builds an application on the in-memory store, or on a fresh
+// Postgres schema when TEST_DB_ADDR is set.
+func newTestApp(t *testing.T) *testApp {
+	t.Helper()
+
+	clock := &testClock{now: time.Now()}
+
+	var storage store.Storage
+	if os.Getenv("TEST_DB_ADDR") != "" {
+		storage = store.NewStorage(testdb.New(t))
+	} else {
+		storage = memstore.New(clock.Now)
+	}
+
+	templates, err := mailer.ParseTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := i18n.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := media.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mail := mailer.NewMemoryMailer(templates, "test@gophersocial.test")
+
+	app := &application{
+		config:    testConfig(),
+		store:     storage,
+		logger:    zap.NewNop().Sugar(),
+		mailer:    mail,
+		templates: templates,
+		media:     files,
+		signer:    exports.NewSigner([]byte("test signing key")),
+		i18n:      catalog,
+		clock:     clock.Now,
+	}
+	app.health = health.NewRegistry(app.config.health.timeout)
+
+	server := httptest.NewServer(app.mount())
+	t.Cleanup(server.Close)
+
+	client := server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return &testApp{
+		application: app,
+		t:           t,
+		clock:       clock,
+		mailer:      mail,
+		server:      server,
+		client:      client,
+	}
+}
+
+func testConfig() config {
+	return config{
+		env:         "test",
+		apiUrl:      "localhost:8080",
+		frontendURL: "http://frontend.test",
+		http: httpConfig{
+			requestTimeout: 10 * time.Second,
+		},
+		mail: mailConfig{
+			provider:       "memory",
+			exp:            time.Hour,
+			resendCooldown: 2 * time.Minute,
+			emailChangeExp: time.Hour,
+			outbox: outboxConfig{
+				batchSize:   20,
+				lease:       time.Minute,
+				maxAttempts: 3,
+				baseBackoff: time.Second,
+				maxBackoff:  time.Minute,
+			},
+		},
+		logger: loggerConfig{
+			sampleEvery: 1,
+		},
+		health: healthConfig{
+			timeout: time.Second,
+		},
+		accounts: accountsConfig{
+			usernameCooldown: 30 * 24 * time.Hour,
+			deletionGrace:    30 * 24 * time.Hour,
+		},
+		auth: authConfig{
+			tokenExp: time.Hour,
+		},
+		media: mediaConfig{
+			maxAvatarSize: 1 << 10,
+		},
+		exports: exportsConfig{
+			ttl:         time.Hour,
+			lease:       time.Minute,
+			maxAttempts: 3,
+		},
+		idempotency: idempotencyConfig{
+			ttl: 24 * time.Hour,
+		},
+		trending: trendingConfig{
+			window:   24 * time.Hour,
+			halfLife: 6 * time.Hour,
+			size:     100,
+		},
+		feed: feedConfig{
+			candidates: 500,
+			halfLife:   12 * time.Hour,
+		},
+		suggestions: suggestionsConfig{
+			minFollowing: 2,
+			size:         50,
+		},
+	}
+}
+
+// testResponse is a response with its body already read.
+type testResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+type requestOption func(*http.Request)
+
+func withToken(token string) requestOption {
+	return func(r *http.Request) {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+func withHeader(key, value string) requestOption {
+	return func(r *http.Request) {
+		r.Header.Set(key, value)
+	}
+}
+
+// do sends a request to the application. A []byte body is sent as is, any
+// other non nil body is encoded as JSON.
+func (a *testApp) do(method, path string, body any, opts ...requestOption) *testResponse {
+	a.t.Helper()
+
+	var r io.Reader
+	switch b := body.(type) {
+	case nil:
+	case []byte:
+		r = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			a.t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, a.server.URL+path, r)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	if _, ok := body.([]byte); !ok && body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	res, err := a.client.Do(req)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return &testResponse{status: res.StatusCode, header: res.Header, body: data}
+}
+
+// decodeData decodes the data envelope of a successful response.
+func decodeData[T any](t *testing.T, res *testResponse) T {
+	t.Helper()
+
+	var envelope struct {
+		Data T `json:"data"`
+	}
+	if err := json.Unmarshal(res.body, &envelope); err != nil {
+		t.Fatalf("decoding data envelope of %q: %v", res.body, err)
+	}
+	return envelope.Data
+}
+
+// decodeProblem returns the problem details of an error response.
+func decodeProblem(t *testing.T, res *testResponse) *Problem {
+	t.Helper()
+
+	var p Problem
+	if err := json.Unmarshal(res.body, &p); err != nil || p.Code == "" {
+		t.Fatalf("expected problem details, got %d %q", res.status, res.body)
+	}
+	return &p
+}
+
+func expectStatus(t *testing.T, res *testResponse, status int) {
+	t.Helper()
+	if res.status != status {
+		t.Fatalf("expected status %d, got %d: %s", status, res.status, res.body)
+	}
+}
+
+// testUser is an activated user signed in with token.
+type testUser struct {
+	id       int64
+	username string
+	email    string
+	password string
+	token    string
+}
+
+// register signs up username and returns the user id and its activation
+// token.
+func (a *testApp) register(username string) (int64, string) {
+	a.t.Helper()
+
+	res := a.do(http.MethodPost, "/v1/authentication/user", RegisterUserPayload{
+		Username: username,
+		Email:    username + "@example.com",
+		Password: "password",
+	})
+	expectStatus(a.t, res, http.StatusCreated)
+
+	user := decodeData[struct {
+		ID    int64  `json:"id"`
+		Token string `json:"token"`
+	}](a.t, res)
+	return user.ID, user.Token
+}
+
+// createUser registers, activates and signs in username.
+func (a *testApp) createUser(username string) testUser {
+	a.t.Helper()
+
+	id, activation := a.register(username)
+	expectStatus(a.t, a.do(http.MethodPut, "/v1/users/activate/"+activation, nil), http.StatusNoContent)
+
+	user := testUser{id: id, username: username, email: username + "@example.com", password: "password"}
+	user.token = a.login(user.email, user.password)
+	return user
+}
+
+func (a *testApp) login(email, password string) string {
+	a.t.Helper()
+
+	res := a.do(http.MethodPost, "/v1/authentication/token", CreateTokenPayload{Email: email, Password: password})
+	expectStatus(a.t, res, http.StatusCreated)
+	return decodeData[SessionToken](a.t, res).Token
+}
+
+// deliverEmails runs the outbox until n emails were sent in total and
+// returns them, newest first.
+func (a *testApp) deliverEmails(n int) []mailer.Message {
+	a.t.Helper()
+
+	a.dispatchUntil(func() bool { return a.mailer.Count() >= n })
+	messages, err := a.mailer.Messages()
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return messages
+}
+
+// dispatchUntil runs the outbox until done returns true. Emails are due at
+// second precision, so the clock is moved forward and the outbox polled for
+// a while before giving up.
+func (a *testApp) dispatchUntil(done func() bool) {
+	a.t.Helper()
+
+	dispatcher := outbox.NewDispatcher(outbox.Config{
+		BatchSize:   a.config.mail.outbox.batchSize,
+		Lease:       a.config.mail.outbox.lease,
+		MaxAttempts: a.config.mail.outbox.maxAttempts,
+		BaseBackoff: a.config.mail.outbox.baseBackoff,
+		MaxBackoff:  a.config.mail.outbox.maxBackoff,
+		Sandbox:     true,
+	}, a.store, a.mailer, a.logger)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			a.t.Fatalf("outbox not delivered, %d emails were sent", a.mailer.Count())
+		}
+		a.clock.Advance(time.Second)
+		if _, err := dispatcher.Dispatch(context.Background()); err != nil {
+			a.t.Fatal(err)
+		}
+		if !done() {
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
+
+var confirmEmailLink = regexp.MustCompile(`/confirm-email/([0-9a-f-]{36})`)
+
+// emailChangeToken delivers the outbox and returns the token of the email
+// change confirmation.
+func (a *testApp) emailChangeToken() string {
+	a.t.Helper()
+
+	confirmations := func() []mailer.Message { return a.mailer.WithTemplate(mailer.EmailChangeConfirmTemplate) }
+	a.dispatchUntil(func() bool { return len(confirmations()) > 0 })
+
+	sent := confirmations()
+	m := confirmEmailLink.FindStringSubmatch(sent[len(sent)-1].HTML)
+	if m == nil {
+		a.t.Fatal("the email change confirmation has no link")
+	}
+	return m[1]
+}
+
+// buildExports runs the export job once.
+func (a *testApp) buildExports() {
+	a.t.Helper()
+
+	build := jobs.BuildExports(jobs.ExportConfig{
+		TTL:         a.config.exports.ttl,
+		Lease:       a.config.exports.lease,
+		MaxAttempts: a.config.exports.maxAttempts,
+		BaseURL:     a.server.URL,
+		Signer:      a.signer,
+		Templates:   a.templates,
+	}, a.store, a.media, a.logger)
+	if err := build(context.Background()); err != nil {
+		a.t.Fatal(err)
+	}
+}
+
+// computeTrending runs the trending job once.
+func (a *testApp) computeTrending() {
+	a.t.Helper()
+
+	compute := jobs.ComputeTrending(a.store, store.TrendingParams{
+		Window:   a.config.trending.window,
+		HalfLife: a.config.trending.halfLife,
+		Limit:    a.config.trending.size,
+	}, a.logger)
+	if err := compute(context.Background()); err != nil {
+		a.t.Fatal(err)
+	}
+}
+
+// precomputeSuggestions runs the follow suggestions job once.
+func (a *testApp) precomputeSuggestions() {
+	a.t.Helper()
+
+	precompute := jobs.PrecomputeSuggestions(a.store, a.config.suggestions.minFollowing, a.config.suggestions.size, a.logger)
+	if err := precompute(context.Background()); err != nil {
+		a.t.Fatal(err)
+	}
+}
+
+// downloadPath returns the signed download path of an export.
+func (a *testApp) downloadPath(id int64, expires time.Time) string {
+	return a.signer.URL("", id, expires)
+}
+
+// goldenHeaders are the response headers recorded in golden files.
+var goldenHeaders = []string{
+	"Content-Type",
+	"Content-Language",
+	"Content-Disposition",
+	"Location",
+	"Retry-After",
+	"Idempotent-Replayed",
+	"WWW-Authenticate",
+}
+
+var timestamp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})$`)
+
+// assertGolden compares res with testdata/<test name>.golden. Run the tests
+// with -update to rewrite the files.
+func assertGolden(t *testing.T, res *testResponse) {
+	t.Helper()
+
+	got := formatGolden(t, res)
+	path := filepath.Join("testdata", filepath.FromSlash(t.Name())+".golden")
+
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v, run the tests with -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("response differs from %s\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+// formatGolden renders the status, the stable headers and the body of res.
+// Values that change between runs (timestamps, tokens, latencies) are
+// replaced by placeholders.
+func formatGolden(t *testing.T, res *testResponse) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "HTTP %d\n", res.status)
+	for _, key := range goldenHeaders {
+		if v := res.header.Get(key); v != "" {
+			fmt.Fprintf(&b, "%s: %s\n", key, v)
+		}
+	}
+	b.WriteString("\n")
+
+	switch {
+	case len(res.body) == 0:
+	case strings.HasPrefix(res.header.Get("Content-Type"), "application/json"),
+		res.header.Get("Content-Type") == "application/problem+json":
+		decoder := json.NewDecoder(bytes.NewReader(res.body))
+		decoder.UseNumber()
+		var body any
+		if err := decoder.Decode(&body); err != nil {
+			t.Fatalf("decoding %q: %v", res.body, err)
+		}
+		encoder := json.NewEncoder(&b)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(normalize("", body)); err != nil {
+			t.Fatal(err)
+		}
+	case strings.HasPrefix(res.header.Get("Content-Type"), "text/"):
+		b.Write(res.body)
+	default:
+		// archives embed their build time, only JSON bodies are compared
+		b.WriteString("<binary body>\n")
+	}
+	return b.Bytes()
+}
+
+func normalize(key string, v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, value := range v {
+			v[k] = normalize(k, value)
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = normalize("", value)
+		}
+		return v
+	case json.Number:
+		// scores decay with the wall clock on Postgres
+		if f, err := v.Float64(); err == nil && (key == "score" || key == "value") {
+			return json.Number(strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64))
+		}
+	case string:
+		switch {
+		case key == "token":
+			return "<token>"
+		case key == "latency":
+			return "<latency>"
+		case key == "instance":
+			return "<request-id>"
+		case timestamp.MatchString(v):
+			return "<timestamp>"
+		}
+	}
+	return v
+}
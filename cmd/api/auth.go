@@ -3,17 +3,27 @@ package main
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/igorzinar/goSocial/internal/mailer"
 	"github.com/igorzinar/goSocial/internal/store"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
+	"time"
 )
 
+// dummyPasswordHash is a bcrypt hash at the cost passwords are stored with.
+// Logins with an unknown email are checked against it, so they take as long
+// to reject as a wrong password and don't tell which emails have accounts.
+var dummyPasswordHash = []byte("$2a$10$k4rAzcnGs2wY.ASRfdByp.QfKofEM3QE3JRFeSOi9twQbTkPReZEW")
+
 type RegisterUserPayload struct {
 	Username string `json:"username" validate:"required,min=3,max=100"`
 	Email    string `json:"email" validate:"required,email,max=255"`
 	Password string `json:"password" validate:"required,min=3,max=72"`
+	// PreferredLocale defaults to the negotiated Accept-Language
+	PreferredLocale string `json:"preferred_locale" validate:"omitempty,bcp47_language_tag"`
 }
 
 type UserWithToken struct {
@@ -30,8 +40,8 @@ type UserWithToken struct {
 //	@Produce		json
 //	@Param			payload	body		RegisterUserPayload	true	"User credentials"
 //	@Success		201		{object}	UserWithToken		"User registered"
-//	@Failure		400		{object}	error
-//	@Failure		500		{object}	error
+//	@Failure		400		{object}	Problem
+//	@Failure		500		{object}	Problem
 //	@Router			/authentication/user [post]
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 	var payload RegisterUserPayload
@@ -45,9 +55,15 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	locale := payload.PreferredLocale
+	if locale == "" {
+		locale = getLocale(r).String()
+	}
+
 	user := store.User{
-		Username: payload.Username,
-		Email:    payload.Email,
+		Username:        payload.Username,
+		Email:           payload.Email,
+		PreferredLocale: locale,
 	}
 	// hash user password
 	if err := user.Password.Set(payload.Password); err != nil {
@@ -56,12 +72,14 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	ctx := r.Context()
-	plainToken := uuid.New().String()
-	// store user
+	plainToken, tokenHash, email, err := app.newInvitation(&user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
 
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
-	if err := app.store.Users.CreateAndInvite(ctx, &user, hashToken, app.config.mail.exp); err != nil {
+	// store user, the welcome email is sent by the outbox dispatcher
+	if err := app.store.Users.CreateAndInvite(ctx, &user, tokenHash, app.config.mail.exp, email); err != nil {
 		switch err {
 		case store.ErrDuplicateEmail:
 			app.badRequestResponse(w, r, err)
@@ -78,9 +96,94 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Token: plainToken,
 	}
 
+	if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// resendActivationHandler godoc
+//
+//	@Summary		Resends the activation email
+//	@Description	Issues a new invitation token to an account that is not active yet. The response does not tell whether the account exists.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		ResendActivationPayload	true	"Account email"
+//	@Param			Idempotency-Key	header		string	false	"Makes retries of the request safe"
+//	@Success		202		{string}	string					"Activation email sent if the account exists"
+//	@Failure		400		{object}	Problem
+//	@Failure		429		{object}	Problem
+//	@Failure		409	{object}	Problem	"Idempotency key reused for a different request"
+//	@Failure		425	{object}	Problem	"Idempotent request still in progress"
+//	@Failure		500		{object}	Problem
+//	@Router			/authentication/resend-activation [post]
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		app.activationResent(w, r)
+		return
+	case err != nil:
+		app.internalServerError(w, r, err)
+		return
+	}
+	if user.IsActive {
+		app.activationResent(w, r)
+		return
+	}
+
+	_, tokenHash, email, err := app.newInvitation(user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	retryAfter, err := app.store.Users.ResendInvitation(ctx, user.ID, tokenHash, app.config.mail.exp, app.config.mail.resendCooldown, email)
+	switch {
+	case errors.Is(err, store.ErrRateLimited):
+		app.rateLimitExceededResponse(w, r, retryAfter)
+		return
+	case errors.Is(err, store.ErrNotFound):
+		// activated concurrently
+	case err != nil:
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.activationResent(w, r)
+}
+
+// activationResent answers the same way whether or not an email was sent so
+// the endpoint can't be used to probe registered addresses.
+func (app *application) activationResent(w http.ResponseWriter, r *http.Request) {
+	if err := app.jsonResponse(w, http.StatusAccepted, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// newInvitation creates an activation token for user and the localized
+// invitation email carrying it. The hashed token is what gets stored.
+func (app *application) newInvitation(user *store.User) (plainToken, tokenHash string, email *store.OutboxEmail, err error) {
+	plainToken = uuid.New().String()
 	activationURL := fmt.Sprintf("%s/activation/%s", app.config.frontendURL, plainToken)
 
-	isProdEnv := app.config.env == "production"
 	vars := struct {
 		Username      string
 		ActivationURL string
@@ -88,23 +191,113 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Username:      user.Username,
 		ActivationURL: activationURL,
 	}
-
-	// send email
-	err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
+	template := app.templates.Localized(mailer.UserWelcomeTemplate, user.PreferredLocale)
+	email, err = store.NewOutboxEmail(template, user.Username, user.Email, vars)
 	if err != nil {
-		app.logger.Error("error sending welcome email", "error", err)
+		return "", "", nil, err
+	}
+
+	return plainToken, hashToken(plainToken), email, nil
+}
+
+// hashToken is how every opaque token (invitations, sessions, email
+// changes) is stored.
+func hashToken(plain string) string {
+	hash := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(hash[:])
+}
+
+type CreateTokenPayload struct {
+	Email    string `json:"email" validate:"required,email,max=255"`
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
 
-		// rollback user creations (SAGA pattern)
-		if err := app.store.Users.Delete(ctx, user.ID); err != nil {
-			app.logger.Errorw("error deleting user", "error", err)
+type SessionToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// createTokenHandler godoc
+//
+//	@Summary		Creates a session token
+//	@Description	Exchanges the credentials of an active user for a bearer token. Logging in cancels a scheduled account deletion.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateTokenPayload	true	"User credentials"
+//	@Success		201		{object}	SessionToken		"Token"
+//	@Failure		400		{object}	Problem
+//	@Failure		401		{object}	Problem
+//	@Failure		500		{object}	Problem
+//	@Router			/authentication/token [post]
+func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(payload.Password))
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	case err != nil:
+		app.internalServerError(w, r, err)
+		return
+	}
+	// the password is checked first so inactive accounts take as long too
+	if !user.Password.Matches(payload.Password) || !user.IsActive {
+		app.unauthorizedErrorResponse(w, r, errors.New("invalid credentials"))
+		return
+	}
+
+	if user.DeletionScheduledAt != nil {
+		if _, err := app.store.Users.CancelDeletion(ctx, user.ID); err != nil {
 			app.internalServerError(w, r, err)
+			return
 		}
+		app.requestLogger(ctx).Infow("account deletion cancelled by login", "user_id", user.ID)
+	}
+
+	plainToken := uuid.New().String()
+	session, err := app.store.Sessions.Create(ctx, user.ID, hashToken(plainToken), app.config.auth.tokenExp)
+	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusCreated, userWithToken); err != nil {
+	token := SessionToken{Token: plainToken, ExpiresAt: session.Expiry}
+	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+}
+
+// deleteTokenHandler godoc
+//
+//	@Summary		Deletes the session token
+//	@Description	Signs out the current session
+//	@Tags			authentication
+//	@Success		204	{string}	string	"Signed out"
+//	@Failure		401	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/token [delete]
+func (app *application) deleteTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, _ := bearerToken(r)
+	if err := app.store.Sessions.Delete(r.Context(), hashToken(token)); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/igorzinar/goSocial/internal/store"
+	"net/http"
+	"strconv"
+)
+
+// listBlocksHandler godoc
+//
+//	@Summary		Lists the blocked users
+//	@Description	Lists the users blocked by the authenticated user, the most recently blocked first
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{array}		store.BlockedUser
+//	@Failure		401	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/blocks [get]
+func (app *application) listBlocksHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	blocked, err := app.store.Blocks.List(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, blocked); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// blockUserHandler godoc
+//
+//	@Summary		Blocks a user
+//	@Description	Hides the user and the authenticated user from each other, blocking twice is a no-op
+//	@Tags			users
+//	@Param			userID	path	int	true	"Blocked user ID"
+//	@Success		204
+//	@Failure		400	{object}	Problem	"Blocking yourself"
+//	@Failure		401	{object}	Problem
+//	@Failure		404	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/blocks/{userID} [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r, err)
+		return
+	}
+	if id == user.ID {
+		app.badRequestResponse(w, r, errors.New("users can't block themselves"))
+		return
+	}
+
+	if err := app.store.Blocks.Block(r.Context(), user.ID, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// unblockUserHandler godoc
+//
+//	@Summary		Unblocks a user
+//	@Description	Removes a block, whether or not the user was blocked
+//	@Tags			users
+//	@Param			userID	path	int	true	"Blocked user ID"
+//	@Success		204
+//	@Failure		401	{object}	Problem
+//	@Failure		404	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/blocks/{userID} [delete]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Blocks.Unblock(r.Context(), user.ID, id); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/igorzinar/goSocial/internal/store"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type SaveBookmarkPayload struct {
+	CollectionID *int64 `json:"collection_id"`
+}
+
+type BookmarksQuery struct {
+	Cursor       string `json:"cursor"`
+	CollectionID *int64 `json:"collection"`
+	Limit        int    `json:"limit" validate:"gte=1,lte=50"`
+}
+
+// BookmarkPage is a page of bookmarks, NextCursor is left out on the last
+// one.
+type BookmarkPage struct {
+	Bookmarks  []store.Bookmark `json:"bookmarks"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+type CreateCollectionPayload struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+// encodeCursor and decodeCursor keep the bookmark ID behind a cursor opaque,
+// so clients don't build their own.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(cursor string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid cursor")
+	}
+	return id, nil
+}
+
+// saveBookmarkHandler godoc
+//
+//	@Summary		Bookmarks a post
+//	@Description	Saves a post for later, in a collection or in none. Saving a bookmarked post again moves it to the collection given, or out of its collection without one.
+//	@Tags			bookmarks
+//	@Accept			json
+//	@Param			postID	path	int					true	"Post ID"
+//	@Param			payload	body	SaveBookmarkPayload	false	"Collection"
+//	@Success		204
+//	@Failure		400	{object}	Problem
+//	@Failure		401	{object}	Problem
+//	@Failure		404	{object}	Problem	"Post or collection not found"
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/bookmark [put]
+func (app *application) saveBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+	post := getPostFromCtx(r)
+
+	// the payload is optional
+	var payload SaveBookmarkPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Bookmarks.Save(r.Context(), user.ID, post.ID, payload.CollectionID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteBookmarkHandler godoc
+//
+//	@Summary		Removes a bookmark
+//	@Description	Removes the bookmark of a post, whether or not it was bookmarked
+//	@Tags			bookmarks
+//	@Param			postID	path	int	true	"Post ID"
+//	@Success		204
+//	@Failure		401	{object}	Problem
+//	@Failure		404	{object}	Problem	"Post not found"
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/bookmark [delete]
+func (app *application) deleteBookmarkHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+	post := getPostFromCtx(r)
+
+	if err := app.store.Bookmarks.Delete(r.Context(), user.ID, post.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// listBookmarksHandler godoc
+//
+//	@Summary		Lists the bookmarks
+//	@Description	Lists the bookmarks of the user, the most recently saved first. Pass the next_cursor of a page as cursor to get the next one.
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Param			cursor		query		string	false	"Cursor of the page"
+//	@Param			collection	query		int		false	"Collection ID"
+//	@Param			limit		query		int		false	"Limit"
+//	@Success		200			{object}	BookmarkPage
+//	@Failure		400			{object}	Problem
+//	@Failure		401			{object}	Problem
+//	@Failure		404			{object}	Problem	"Collection not found"
+//	@Failure		500			{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/bookmarks [get]
+func (app *application) listBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	q := BookmarksQuery{
+		Cursor: r.URL.Query().Get("cursor"),
+		Limit:  20,
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		q.Limit = l
+	}
+	if collection := r.URL.Query().Get("collection"); collection != "" {
+		id, err := strconv.ParseInt(collection, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		q.CollectionID = &id
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	bq := store.BookmarkQuery{CollectionID: q.CollectionID, Limit: q.Limit + 1}
+	if q.Cursor != "" {
+		before, err := decodeCursor(q.Cursor)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		bq.Before = before
+	}
+
+	// one more bookmark than asked for tells whether there is a next page
+	bookmarks, err := app.store.Bookmarks.List(r.Context(), user.ID, bq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	page := BookmarkPage{Bookmarks: bookmarks}
+	if len(bookmarks) > q.Limit {
+		page.Bookmarks = bookmarks[:q.Limit]
+		page.NextCursor = encodeCursor(page.Bookmarks[q.Limit-1].ID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// listCollectionsHandler godoc
+//
+//	@Summary		Lists the bookmark collections
+//	@Description	Lists the bookmark collections of the user by name, with the number of bookmarks in each
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Success		200	{array}		store.BookmarkCollection
+//	@Failure		401	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/collections [get]
+func (app *application) listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	collections, err := app.store.Bookmarks.ListCollections(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, collections); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createCollectionHandler godoc
+//
+//	@Summary		Creates a bookmark collection
+//	@Description	Creates a named collection to save bookmarks in, names are unique per user
+//	@Tags			bookmarks
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateCollectionPayload	true	"Collection payload"
+//	@Success		201		{object}	store.BookmarkCollection
+//	@Failure		400		{object}	Problem
+//	@Failure		401		{object}	Problem
+//	@Failure		409		{object}	Problem	"Name already used"
+//	@Failure		500		{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/collections [post]
+func (app *application) createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	var payload CreateCollectionPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	payload.Name = strings.TrimSpace(payload.Name)
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	collection := &store.BookmarkCollection{UserID: user.ID, Name: payload.Name}
+	if err := app.store.Bookmarks.CreateCollection(r.Context(), collection); err != nil {
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, collection); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteCollectionHandler godoc
+//
+//	@Summary		Deletes a bookmark collection
+//	@Description	Deletes a bookmark collection, its bookmarks are kept without a collection
+//	@Tags			bookmarks
+//	@Param			collectionID	path	int	true	"Collection ID"
+//	@Success		204
+//	@Failure		401	{object}	Problem
+//	@Failure		404	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/collections/{collectionID} [delete]
+func (app *application) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "collectionID"), 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Bookmarks.DeleteCollection(r.Context(), user.ID, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
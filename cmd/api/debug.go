@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"github.com/igorzinar/goSocial/internal/mailer"
+	"html/template"
+	"net/http"
+)
+
+var mailboxTemplate = template.Must(template.New("mailbox").Parse(`<!doctype html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Mailbox</title>
+  <style>
+    body { font-family: sans-serif; margin: 2rem; }
+    details { border: 1px solid #ddd; border-radius: 4px; margin-bottom: 1rem; padding: .5rem 1rem; }
+    summary { cursor: pointer; }
+    .meta { color: #666; font-size: .9rem; }
+    pre { background: #f6f6f6; padding: 1rem; white-space: pre-wrap; }
+  </style>
+</head>
+<body>
+  <h1>Mailbox ({{len .}})</h1>
+  {{range .}}
+  <details>
+    <summary><strong>{{.Subject}}</strong> &mdash; {{.To}} <span class="meta">{{.SentAt.Format "2006-01-02 15:04:05"}}</span></summary>
+    <p class="meta">From {{.From}}{{if .Template}}, template {{.Template}}{{end}}</p>
+    <div>{{.HTMLBody}}</div>
+    {{if .Text}}<pre>{{.Text}}</pre>{{end}}
+  </details>
+  {{else}}
+  <p>No messages sent yet.</p>
+  {{end}}
+</body>
+</html>`))
+
+type mailboxMessage struct {
+	mailer.Message
+	HTMLBody template.HTML
+}
+
+// mailboxHandler godoc
+//
+//	@Summary		Browse sent emails
+//	@Description	Lists emails recorded by the file or memory mailer, development only
+//	@Tags			debug
+//	@Produce		html
+//	@Param			format	query		string	false	"json to get the raw messages"
+//	@Success		200		{object}	[]mailer.Message
+//	@Failure		500		{object}	Problem
+//	@Router			/debug/mailbox [get]
+func (app *application) mailboxHandler(w http.ResponseWriter, r *http.Request) {
+	mailbox, ok := app.mailer.(mailer.Mailbox)
+	if !ok {
+		app.notFoundResponse(w, r, errors.New("mailer does not keep sent messages"))
+		return
+	}
+
+	messages, err := mailbox.Messages()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		if err := app.jsonResponse(w, http.StatusOK, messages); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// the bodies come from our own templates, render them as is so the
+	// activation links can be clicked
+	view := make([]mailboxMessage, len(messages))
+	for i, msg := range messages {
+		view[i] = mailboxMessage{Message: msg, HTMLBody: template.HTML(msg.HTML)}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := mailboxTemplate.Execute(w, view); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -1,24 +1,242 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-playground/validator/v10"
+	"github.com/igorzinar/goSocial/internal/store"
+	"io"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// problemTypeBase prefixes the code of a problem to build its type URI.
+const problemTypeBase = "/problems/"
+
+// Problem is an RFC 9457 problem details object. Code is a stable, machine
+// readable identifier of the problem, Errors lists the invalid fields of the
+// request.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is an invalid field of the request, Rule is the failed
+// validation (required, max, type, unknown...).
+type FieldError struct {
+	Field  string `json:"field"`
+	Rule   string `json:"rule"`
+	Detail string `json:"detail"`
+}
+
+// Problem codes not tied to a sentinel error. The title of a code is the
+// catalog message "errors.<code>".
+const (
+	codeInternal          = "internal"
+	codeBadRequest        = "bad_request"
+	codeValidationFailed  = "validation_failed"
+	codeMalformedBody     = "malformed_body"
+	codeNotFound          = "not_found"
+	codeMethodNotAllowed  = "method_not_allowed"
+	codeUnauthorized      = "unauthorized"
+	codeForbidden         = "forbidden"
+	codeTooLarge          = "too_large"
+	codeUnsupportedMedia  = "unsupported_media"
+	codeRequestInProgress = "request_in_progress"
+)
+
+// errorCodes maps errors with a stable meaning to their problem code.
+var errorCodes = map[error]string{
+	store.ErrNotFound:          "not_found",
+	store.ErrConflict:          "conflict",
+	store.ErrExpired:           "expired",
+	store.ErrRateLimited:       "rate_limited",
+	store.ErrDuplicateEmail:    "duplicate_email",
+	store.ErrDuplicateUsername: "duplicate_username",
+	store.ErrUsernameCooldown:  "username_cooldown",
+	errSameEmail:               "same_email",
+	errInvalidPassword:         "invalid_password",
+	errUnsupportedMedia:        "unsupported_media",
+	errIdempotencyKey:          "invalid_idempotency_key",
+	errIdempotencyMismatch:     "idempotency_key_reused",
+}
+
+// errorCode returns the code of err, fallback when it has none.
+func errorCode(err error, fallback string) string {
+	for target, code := range errorCodes {
+		if errors.Is(err, target) {
+			return code
+		}
+	}
+	return fallback
+}
+
+// problem returns the problem of code, titled for the request locale.
+func (app *application) problem(r *http.Request, status int, code string) *Problem {
+	return &Problem{
+		Type:     problemTypeBase + code,
+		Title:    app.i18n.T(getLocale(r), "errors."+code),
+		Status:   status,
+		Instance: middleware.GetReqID(r.Context()),
+		Code:     code,
+	}
+}
+
+// writeProblem sends p as application/problem+json, or as application/json
+// to clients that only accept the latter.
+func writeProblem(w http.ResponseWriter, r *http.Request, p *Problem) error {
+	contentType := "application/problem+json"
+	accept := r.Header.Get("Accept")
+	if strings.Contains(accept, "application/json") && !strings.Contains(accept, "application/problem+json") {
+		contentType = "application/json; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(p.Status)
+	return json.NewEncoder(w).Encode(p)
+}
+
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Errorw("internal server error", "method", r.Method, "path", r.URL.Path, "err", err)
-	writeJSONError(w, http.StatusInternalServerError, "the server encountered a problem")
+	app.requestLogger(r.Context()).Errorw("internal server error", "err", err)
+	writeProblem(w, r, app.problem(r, http.StatusInternalServerError, codeInternal))
 }
 
+// badRequestResponse describes invalid input without leaking the validator
+// or decoder error: invalid fields are listed, syntax errors located.
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Warnw("bad request error", "method", r.Method, "path", r.URL.Path, "err", err)
-	writeJSONError(w, http.StatusBadRequest, err.Error())
+	app.requestLogger(r.Context()).Warnw("bad request error", "err", err)
+
+	var (
+		validationErrs validator.ValidationErrors
+		syntaxErr      *json.SyntaxError
+		typeErr        *json.UnmarshalTypeError
+		maxBytesErr    *http.MaxBytesError
+	)
+	locale := getLocale(r)
+	var p *Problem
+	switch {
+	case errors.As(err, &validationErrs):
+		p = app.problem(r, http.StatusBadRequest, codeValidationFailed)
+		messages := make([]string, len(validationErrs))
+		for i, fe := range validationErrs {
+			messages[i] = app.i18n.ValidationMessage(locale, fe)
+			p.Errors = append(p.Errors, FieldError{Field: fieldPath(fe), Rule: fe.Tag(), Detail: messages[i]})
+		}
+		p.Detail = strings.Join(messages, "; ")
+	case errors.As(err, &typeErr):
+		p = app.problem(r, http.StatusBadRequest, codeValidationFailed)
+		fe := FieldError{Field: typeErr.Field, Rule: "type", Detail: app.i18n.T(locale, "validation.type", typeErr.Field, jsonType(typeErr.Type))}
+		p.Errors = []FieldError{fe}
+		p.Detail = fe.Detail
+	case unknownField(err) != "":
+		p = app.problem(r, http.StatusBadRequest, codeValidationFailed)
+		field := unknownField(err)
+		fe := FieldError{Field: field, Rule: "unknown", Detail: app.i18n.T(locale, "validation.unknown", field)}
+		p.Errors = []FieldError{fe}
+		p.Detail = fe.Detail
+	case errors.As(err, &syntaxErr):
+		p = app.problem(r, http.StatusBadRequest, codeMalformedBody)
+		p.Detail = app.i18n.T(locale, "errors.syntax_error", strconv.FormatInt(syntaxErr.Offset, 10))
+	case errors.Is(err, io.EOF):
+		p = app.problem(r, http.StatusBadRequest, codeMalformedBody)
+		p.Detail = app.i18n.T(locale, "errors.empty_body")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		p = app.problem(r, http.StatusBadRequest, codeMalformedBody)
+		p.Detail = app.i18n.T(locale, "errors.truncated_body")
+	case errors.As(err, &maxBytesErr):
+		p = app.problem(r, http.StatusRequestEntityTooLarge, codeTooLarge)
+	default:
+		p = app.problem(r, http.StatusBadRequest, errorCode(err, codeBadRequest))
+	}
+	writeProblem(w, r, p)
 }
+
+// fieldPath returns the JSON path of a field, without the payload struct.
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+// unknownField returns the field rejected by DisallowUnknownFields, the
+// decoder has no error type for it.
+func unknownField(err error) string {
+	name, found := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !found {
+		return ""
+	}
+	field, err := strconv.Unquote(name)
+	if err != nil {
+		return name
+	}
+	return field
+}
+
+// jsonType names the JSON type a Go type is decoded from.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Pointer:
+		return jsonType(t.Elem())
+	default:
+		return "object"
+	}
+}
+
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Warnw("not found error", "method", r.Method, "path", r.URL.Path, "err", err)
-	writeJSONError(w, http.StatusNotFound, "not found")
+	app.requestLogger(r.Context()).Warnw("not found error", "err", err)
+	writeProblem(w, r, app.problem(r, http.StatusNotFound, codeNotFound))
+}
+
+func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	app.requestLogger(r.Context()).Warnw("method not allowed", "method", r.Method)
+	writeProblem(w, r, app.problem(r, http.StatusMethodNotAllowed, codeMethodNotAllowed))
 }
 
 func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.logger.Errorw("conflict error", "method", r.Method, "path", r.URL.Path, "err", err)
-	writeJSONError(w, http.StatusConflict, err.Error())
+	app.requestLogger(r.Context()).Errorw("conflict error", "err", err)
+	writeProblem(w, r, app.problem(r, http.StatusConflict, errorCode(err, "conflict")))
+}
+
+func (app *application) goneResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.requestLogger(r.Context()).Warnw("gone error", "err", err)
+	writeProblem(w, r, app.problem(r, http.StatusGone, errorCode(err, "expired")))
+}
+
+// rateLimitExceededResponse sends retryAfter in whole seconds, at least one.
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	app.requestLogger(r.Context()).Warnw("rate limit exceeded", "retry_after", retryAfter)
+	w.Header().Set("Retry-After", strconv.Itoa(max(int(retryAfter.Round(time.Second).Seconds()), 1)))
+	writeProblem(w, r, app.problem(r, http.StatusTooManyRequests, "rate_limited"))
+}
+
+func (app *application) unauthorizedErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.requestLogger(r.Context()).Warnw("unauthorized error", "err", err)
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	writeProblem(w, r, app.problem(r, http.StatusUnauthorized, codeUnauthorized))
+}
+
+func (app *application) forbiddenResponse(w http.ResponseWriter, r *http.Request, err error) {
+	app.requestLogger(r.Context()).Warnw("forbidden", "err", err)
+	writeProblem(w, r, app.problem(r, http.StatusForbidden, errorCode(err, codeForbidden)))
 }
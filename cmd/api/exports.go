@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/igorzinar/goSocial/internal/media"
+	"github.com/igorzinar/goSocial/internal/store"
+	"net/http"
+	"strconv"
+)
+
+// requestExportHandler godoc
+//
+//	@Summary		Requests a personal data export
+//	@Description	Queues a ZIP archive of everything stored about the authenticated user. A download link is emailed once it is ready.
+//	@Tags			users
+//	@Produce		json
+//	@Param			Idempotency-Key	header		string	false	"Makes retries of the request safe"
+//	@Success		202	{object}	store.DataExport
+//	@Failure		401	{object}	Problem
+//	@Failure		409	{object}	Problem	"An export is already being built"
+//	@Failure		425	{object}	Problem	"Idempotent request still in progress"
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/export [post]
+func (app *application) requestExportHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	export, err := app.store.Exports.Request(r.Context(), user.ID)
+	if err != nil {
+		switch err {
+		case store.ErrConflict:
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusAccepted, export); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// listExportsHandler godoc
+//
+//	@Summary		Lists the personal data exports
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{array}		store.DataExport
+//	@Failure		401	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/exports [get]
+func (app *application) listExportsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	exports, err := app.store.Exports.ListByUser(r.Context(), user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, exports); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// downloadExportHandler godoc
+//
+//	@Summary		Downloads a personal data export
+//	@Description	Serves the archive behind the signed, time limited link sent by email
+//	@Tags			users
+//	@Produce		application/zip
+//	@Param			exportID	path		int		true	"Export ID"
+//	@Param			expires		query		int		true	"Link expiry (unix time)"
+//	@Param			signature	query		string	true	"Link signature"
+//	@Success		200			{file}		file
+//	@Failure		404			{object}	Problem
+//	@Failure		410			{object}	Problem	"Link or archive expired"
+//	@Failure		500			{object}	Problem
+//	@Router			/exports/{exportID}/download [get]
+func (app *application) downloadExportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "exportID"), 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r, err)
+		return
+	}
+
+	// an invalid signature looks like an unknown export
+	valid, expired := app.signer.Verify(id, r.URL.Query(), app.clock())
+	if !valid {
+		app.notFoundResponse(w, r, errors.New("invalid export signature"))
+		return
+	}
+	if expired {
+		app.goneResponse(w, r, store.ErrExpired)
+		return
+	}
+
+	ctx := r.Context()
+	export, err := app.store.Exports.GetByID(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	switch export.Status {
+	case store.ExportReady:
+	case store.ExportExpired:
+		app.goneResponse(w, r, store.ErrExpired)
+		return
+	default:
+		app.notFoundResponse(w, r, fmt.Errorf("export %d is %s", id, export.Status))
+		return
+	}
+
+	f, err := app.media.Open(export.StorageKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrNotFound):
+			app.goneResponse(w, r, store.ErrExpired)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="gophersocial-export-%d.zip"`, export.ID))
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, "", *export.CompletedAt, f)
+}
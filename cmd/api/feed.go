@@ -1,30 +1,40 @@
 package main
 
 import (
+	"github.com/igorzinar/goSocial/internal/ranking"
 	"github.com/igorzinar/goSocial/internal/store"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // getUserFeedHandler godoc
 //
 //	@Summary		Fetches the user feed
-//	@Description	Fetches the user feed
+//	@Description	Fetches the user feed, newest first or ranked with mode=ranked. A ranked feed is computed at the time sent back in the Feed-Snapshot header, pass it as snapshot to page through the same ranking.
 //	@Tags			feed
 //	@Accept			json
 //	@Produce		json
-//	@Param			since	query		string	false	"Since"
-//	@Param			until	query		string	false	"Until"
-//	@Param			limit	query		int		false	"Limit"
-//	@Param			offset	query		int		false	"Offset"
-//	@Param			sort	query		string	false	"Sort"
-//	@Param			tags	query		string	false	"Tags"
-//	@Param			search	query		string	false	"Search"
-//	@Success		200		{object}	[]store.PostWithMetadata
-//	@Failure		400		{object}	error
-//	@Failure		500		{object}	error
+//	@Param			since		query		string	false	"Since"
+//	@Param			until		query		string	false	"Until"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Param			sort		query		string	false	"Sort, ignored by the ranked feed"
+//	@Param			tags		query		string	false	"Tags"
+//	@Param			search		query		string	false	"Search"
+//	@Param			mode		query		string	false	"chronological or ranked"
+//	@Param			snapshot	query		int		false	"Unix time of the ranking to page through"
+//	@Param			debug		query		bool	false	"Explain the scores of a ranked feed"
+//	@Success		200			{object}	[]ranking.Post
+//	@Header			200			{integer}	Feed-Snapshot	"Unix time the ranked feed is computed at"
+//	@Failure		400			{object}	Problem
+//	@Failure		401			{object}	Problem
+//	@Failure		500			{object}	Problem
 //	@Security		ApiKeyAuth
 //	@Router			/users/feed [get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
 	// pagination, filter
 
 	fq := store.PaginatedFeedQuery{
@@ -43,8 +53,13 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	if fq.Mode == store.FeedRanked {
+		app.rankedFeed(w, r, user.ID, fq)
+		return
+	}
+
 	ctx := r.Context()
-	feed, err := app.store.Posts.GetUserFeed(ctx, int64(13), fq)
+	feed, err := app.store.Posts.GetUserFeed(ctx, user.ID, fq)
 
 	if err != nil {
 		app.internalServerError(w, r, err)
@@ -57,3 +72,34 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 }
+
+// rankedFeed ranks the recent posts of the viewer's network as of the
+// snapshot, now for the first page.
+func (app *application) rankedFeed(w http.ResponseWriter, r *http.Request, viewerID int64, fq store.PaginatedFeedQuery) {
+	at := app.clock().Round(time.Second)
+	if fq.Snapshot != 0 {
+		at = time.Unix(fq.Snapshot, 0)
+	}
+
+	candidates, err := app.store.Posts.GetFeedCandidates(r.Context(), viewerID, at, fq, app.config.feed.candidates)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ranked := ranking.Default(app.config.feed.halfLife).Rank(candidates, at)
+	var feed []ranking.Post
+	if fq.Offset < len(ranked) {
+		feed = ranked[fq.Offset:min(fq.Offset+fq.Limit, len(ranked))]
+	}
+	if !fq.Debug {
+		for i := range feed {
+			feed[i].Explanation = nil
+		}
+	}
+
+	w.Header().Set("Feed-Snapshot", strconv.FormatInt(at.Unix(), 10))
+	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -1,17 +1,22 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/igorzinar/goSocial/internal/migrate"
 	"net/http"
 )
 
 // healthcheckHandler godoc
 //
-//	@Summary		Healthcheck
-//	@Description	Healthcheck endpoint
+//	@Summary		Liveness probe
+//	@Description	Reports that the process is up, without checking dependencies
 //	@Tags			ops
 //	@Produce		json
 //	@Success		200	{object}	string	"ok"
-//	@Router			/health [get]
+//	@Router			/health/live [get]
 func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	data := map[string]string{
 		"status":  "ok",
@@ -22,3 +27,61 @@ func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Reques
 		app.internalServerError(w, r, err)
 	}
 }
+
+// readinessHandler godoc
+//
+//	@Summary		Readiness probe
+//	@Description	Checks every registered dependency and reports per component status
+//	@Tags			ops
+//	@Produce		json
+//	@Success		200	{object}	health.Report
+//	@Failure		503	{object}	health.Report
+//	@Router			/health/ready [get]
+func (app *application) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	report := app.health.Run(r.Context())
+
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+		app.requestLogger(r.Context()).Warnw("readiness check failed", "components", report.Components)
+	}
+
+	if err := app.jsonResponse(w, status, report); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) registerHealthChecks(db *sql.DB, migrator *migrate.Migrator) {
+	app.health.Register("database", true, db.PingContext)
+	app.health.Register("migrations", true, func(ctx context.Context) error {
+		return checkMigrations(ctx, migrator)
+	})
+	app.health.Register("mailer", false, func(ctx context.Context) error {
+		if app.config.mail.provider == "file" || app.config.mail.provider == "memory" {
+			return nil
+		}
+		if app.config.mail.fromEmail == "" {
+			return errors.New("from email is not configured")
+		}
+		if app.config.mail.provider == "sendgrid" && app.config.mail.sendGrid.apiKey == "" {
+			return errors.New("sendgrid api key is not configured")
+		}
+		return nil
+	})
+}
+
+// checkMigrations fails when the schema is dirty or behind the migrations
+// embedded in the binary.
+func checkMigrations(ctx context.Context, migrator *migrate.Migrator) error {
+	v, dirty, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("schema version %d is dirty", v)
+	}
+	if latest := migrator.Latest(); v < latest {
+		return fmt.Errorf("schema version %d is behind %d", v, latest)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/igorzinar/goSocial/internal/store"
+	"io"
+	"net"
+	"net/http"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+var (
+	errIdempotencyKey      = errors.New("invalid idempotency key")
+	errIdempotencyMismatch = errors.New("idempotency key reused for a different request")
+)
+
+// idempotencyMiddleware makes retries of a request sent with an
+// Idempotency-Key header safe: the first response is stored and replayed to
+// later requests with the same key. A key reused for a different request is
+// rejected, and so are retries arriving while the first request still runs.
+// Server errors aren't stored, the request can be retried with the same key.
+// Responses are stored as sent, so routes answering with credentials or
+// tokens must not use it.
+func (app *application) idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > 255 {
+			app.badRequestResponse(w, r, errIdempotencyKey)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		ctx := r.Context()
+		k := &store.IdempotencyKey{
+			Scope:       idempotencyScope(r),
+			Key:         key,
+			Fingerprint: requestFingerprint(r, body),
+		}
+		// a request can't run longer than the request timeout, a key still in
+		// progress after that was abandoned
+		existing, err := app.store.Idempotency.Begin(ctx, k, app.config.idempotency.ttl, app.config.http.requestTimeout)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != k.Fingerprint:
+				app.conflictResponse(w, r, errIdempotencyMismatch)
+			case !existing.Completed():
+				app.requestLogger(ctx).Warnw("idempotent request in progress", "key", key)
+				w.Header().Set("Retry-After", "1")
+				writeProblem(w, r, app.problem(r, http.StatusTooEarly, codeRequestInProgress))
+			default:
+				replayResponse(w, existing)
+			}
+			return
+		}
+
+		// the key is released unless a response is stored, including when the
+		// handler panics
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			if err := app.store.Idempotency.Release(context.WithoutCancel(ctx), k.Scope, k.Key); err != nil {
+				app.requestLogger(ctx).Errorw("releasing idempotency key", "key", key, "error", err)
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status >= http.StatusInternalServerError {
+			return
+		}
+
+		k.Status = rec.status
+		k.Header = rec.header
+		k.Body = rec.body.Bytes()
+		if err := app.store.Idempotency.Complete(context.WithoutCancel(ctx), k); err != nil {
+			app.requestLogger(ctx).Errorw("storing idempotent response", "key", key, "error", err)
+			return
+		}
+		completed = true
+	})
+}
+
+// idempotencyScope keeps the keys of different clients apart: per user when
+// the request is authenticated, per client address otherwise.
+func idempotencyScope(r *http.Request) string {
+	if user := getAuthUser(r); user != nil {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// requestFingerprint identifies a request by its method, URL and body.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", r.Method, r.URL.RequestURI())
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func replayResponse(w http.ResponseWriter, k *store.IdempotencyKey) {
+	for name, values := range k.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(k.Status)
+	w.Write(k.Body)
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+		rec.header = rec.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
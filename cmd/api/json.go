@@ -3,36 +3,68 @@ package main
 import (
 	"encoding/json"
 	"github.com/go-playground/validator/v10"
+	"github.com/igorzinar/goSocial/internal/richtext"
 	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
 )
 
 var Validate *validator.Validate
 
 func init() {
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+
+	// report fields by their JSON name in validation messages
+	Validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+
+	// weburl accepts an empty string, so optional links can be cleared
+	Validate.RegisterValidation("weburl", func(fl validator.FieldLevel) bool {
+		raw := fl.Field().String()
+		if raw == "" {
+			return true
+		}
+		u, err := url.Parse(raw)
+		return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+	})
+
+	// tag accepts what posts can be tagged with, "#Go" included
+	Validate.RegisterValidation("tag", func(fl validator.FieldLevel) bool {
+		_, ok := richtext.NormalizeTag(fl.Field().String())
+		return ok
+	})
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) error {
+	// a 204 response can't carry a body
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return nil
+	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(status)
 	return json.NewEncoder(w).Encode(data)
 }
 
+// maxRequestBody bounds the JSON request bodies.
+const maxRequestBody = 1_048_578 // 1mb
+
 func readJSON(w http.ResponseWriter, r *http.Request, data any) error {
-	maxBytes := 1_048_578 // 1mb
-	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
 	decoder := json.NewDecoder(r.Body)
 	decoder.DisallowUnknownFields()
 	return decoder.Decode(data)
 }
 
-func writeJSONError(w http.ResponseWriter, status int, message string) error {
-	type envelope struct {
-		Error string `json:"error"`
-	}
-	return writeJSON(w, status, &envelope{Error: message})
-}
-
 func (app *application) jsonResponse(w http.ResponseWriter, status int, data any) error {
 	type envelope struct {
 		Data any `json:"data"`
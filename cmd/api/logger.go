@@ -0,0 +1,27 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func newLogger(cfg loggerConfig) (*zap.SugaredLogger, error) {
+	level, err := zapcore.ParseLevel(cfg.level)
+	if err != nil {
+		return nil, err
+	}
+
+	zapCfg := zap.NewProductionConfig()
+	zapCfg.Level = zap.NewAtomicLevelAt(level)
+	zapCfg.Encoding = cfg.format
+	zapCfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	if cfg.format == "console" {
+		zapCfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	}
+
+	logger, err := zapCfg.Build()
+	if err != nil {
+		return nil, err
+	}
+	return logger.Sugar(), nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/igorzinar/goSocial/internal/media"
+	"github.com/igorzinar/goSocial/internal/store"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+var errUnsupportedMedia = errors.New("unsupported media type")
+
+// avatarTypes maps the accepted image types, sniffed from the content, to
+// the extension they are stored with.
+var avatarTypes = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// uploadAvatarHandler godoc
+//
+//	@Summary		Uploads the avatar
+//	@Description	Replaces the avatar of the authenticated user with the image sent as request body (png, jpeg, gif or webp)
+//	@Tags			users
+//	@Accept			image/png,image/jpeg,image/gif,image/webp
+//	@Produce		json
+//	@Success		200	{object}	store.User
+//	@Failure		401	{object}	Problem
+//	@Failure		413	{object}	Problem
+//	@Failure		415	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/avatar [put]
+func (app *application) uploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+	ctx := r.Context()
+
+	body := http.MaxBytesReader(w, r.Body, app.config.media.maxAvatarSize)
+	head := make([]byte, 512)
+	n, err := io.ReadFull(body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		app.mediaErrorResponse(w, r, err)
+		return
+	}
+	head = head[:n]
+
+	contentType := http.DetectContentType(head)
+	ext, ok := avatarTypes[contentType]
+	if !ok {
+		app.mediaErrorResponse(w, r, errUnsupportedMedia)
+		return
+	}
+
+	m := &store.Media{
+		UserID:      user.ID,
+		Kind:        store.MediaAvatar,
+		StorageKey:  fmt.Sprintf("avatars/%d/%s%s", user.ID, uuid.New().String(), ext),
+		ContentType: contentType,
+	}
+	m.Size, err = app.media.Put(m.StorageKey, io.MultiReader(bytes.NewReader(head), body))
+	if err != nil {
+		app.mediaErrorResponse(w, r, err)
+		return
+	}
+	if err := app.store.Media.Create(ctx, m); err != nil {
+		app.deleteMediaFile(r, m.StorageKey)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	previous, err := app.store.Users.SetAvatar(ctx, user.ID, &m.ID)
+	if err != nil {
+		app.deleteMedia(r, &m.ID)
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.deleteMedia(r, previous)
+
+	user.AvatarID = &m.ID
+	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteAvatarHandler godoc
+//
+//	@Summary		Removes the avatar
+//	@Tags			users
+//	@Success		204	{string}	string	"Avatar removed"
+//	@Failure		401	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/avatar [delete]
+func (app *application) deleteAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	previous, err := app.store.Users.SetAvatar(r.Context(), user.ID, nil)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.deleteMedia(r, previous)
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getMediaHandler godoc
+//
+//	@Summary		Downloads a media file
+//	@Tags			media
+//	@Produce		octet-stream
+//	@Param			mediaID	path		int	true	"Media ID"
+//	@Success		200		{file}		file
+//	@Failure		404		{object}	Problem
+//	@Failure		500		{object}	Problem
+//	@Router			/media/{mediaID} [get]
+func (app *application) getMediaHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "mediaID"), 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r, err)
+		return
+	}
+
+	m, err := app.store.Media.GetByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	f, err := app.media.Open(m.StorageKey)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", m.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", m.CreatedAt, f)
+}
+
+// deleteMedia removes a replaced media, failures only leave an orphan file
+// behind so they are logged instead of failing the request.
+func (app *application) deleteMedia(r *http.Request, id *int64) {
+	if id == nil {
+		return
+	}
+	ctx := r.Context()
+	m, err := app.store.Media.GetByID(ctx, *id)
+	if err != nil {
+		app.requestLogger(ctx).Warnw("loading replaced media", "media_id", *id, "error", err)
+		return
+	}
+	if err := app.store.Media.Delete(ctx, m.ID); err != nil {
+		app.requestLogger(ctx).Warnw("deleting replaced media", "media_id", m.ID, "error", err)
+		return
+	}
+	app.deleteMediaFile(r, m.StorageKey)
+}
+
+func (app *application) deleteMediaFile(r *http.Request, key string) {
+	if err := app.media.Delete(key); err != nil {
+		app.requestLogger(r.Context()).Warnw("deleting media file", "key", key, "error", err)
+	}
+}
+
+func (app *application) mediaErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		app.requestLogger(r.Context()).Warnw("media too large", "err", err)
+		writeProblem(w, r, app.problem(r, http.StatusRequestEntityTooLarge, codeTooLarge))
+	case errors.Is(err, errUnsupportedMedia):
+		app.requestLogger(r.Context()).Warnw("unsupported media", "err", err)
+		writeProblem(w, r, app.problem(r, http.StatusUnsupportedMediaType, codeUnsupportedMedia))
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/igorzinar/goSocial/internal/i18n"
+	"github.com/igorzinar/goSocial/internal/store"
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type loggerKey string
+
+const loggerCtx loggerKey = "logger"
+
+type authUserKey string
+
+const authUserCtx authUserKey = "authUser"
+
+type localeKey string
+
+const localeCtx localeKey = "locale"
+
+// requestLog holds the request-scoped logger plus the fields that are only
+// known once deeper handlers ran (authenticated user, sampling decision).
+type requestLog struct {
+	logger      *zap.SugaredLogger
+	sampleEvery uint64
+}
+
+// routeCounters counts requests per route pattern for log sampling.
+var routeCounters sync.Map
+
+func (app *application) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		entry := &requestLog{
+			logger: app.logger.With(
+				"request_id", middleware.GetReqID(r.Context()),
+				"method", r.Method,
+				"path", r.URL.Path,
+			),
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ctx := context.WithValue(r.Context(), loggerCtx, entry)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		route := r.URL.Path
+		if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		// errors are never sampled out
+		if status < http.StatusInternalServerError && !shouldLog(route, entry.sampleEvery) {
+			return
+		}
+
+		fields := []any{
+			"route", route,
+			"status", status,
+			"bytes", ww.BytesWritten(),
+			"latency", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+		}
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			entry.logger.Errorw("request completed", fields...)
+		case status >= http.StatusBadRequest:
+			entry.logger.Warnw("request completed", fields...)
+		default:
+			entry.logger.Infow("request completed", fields...)
+		}
+	})
+}
+
+// sampleLogs marks a route as high volume so only one out of every
+// config.logger.sampleEvery successful requests is written to the access log.
+func (app *application) sampleLogs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if entry, ok := r.Context().Value(loggerCtx).(*requestLog); ok {
+			entry.sampleEvery = app.config.logger.sampleEvery
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func shouldLog(route string, every uint64) bool {
+	if every <= 1 {
+		return true
+	}
+	counter, _ := routeCounters.LoadOrStore(route, new(atomic.Uint64))
+	return counter.(*atomic.Uint64).Add(1)%every == 1
+}
+
+// negotiateLocale picks the language of error messages from the
+// Accept-Language header.
+func (app *application) negotiateLocale(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		locale := app.i18n.Negotiate(r.Header.Get("Accept-Language"))
+		w.Header().Set("Content-Language", locale.String())
+		w.Header().Add("Vary", "Accept-Language")
+
+		ctx := context.WithValue(r.Context(), localeCtx, locale)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getLocale(r *http.Request) language.Tag {
+	if locale, ok := r.Context().Value(localeCtx).(language.Tag); ok {
+		return locale
+	}
+	return i18n.DefaultLocale
+}
+
+// authTokenMiddleware requires a valid session token in the Authorization
+// header and loads the authenticated user.
+func (app *application) authTokenMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			app.unauthorizedErrorResponse(w, r, errors.New("missing bearer token"))
+			return
+		}
+
+		ctx := r.Context()
+		userID, err := app.store.Sessions.GetUserID(ctx, hashToken(token))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.unauthorizedErrorResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		user, err := app.store.Users.GetByID(ctx, userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				app.unauthorizedErrorResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		// deactivated accounts lose their sessions, this covers any left
+		if !user.IsActive {
+			app.unauthorizedErrorResponse(w, r, errors.New("inactive user"))
+			return
+		}
+
+		setRequestUserID(ctx, user.ID)
+		ctx = context.WithValue(ctx, authUserCtx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// getAuthUser returns the user authenticated by authTokenMiddleware.
+func getAuthUser(r *http.Request) *store.User {
+	user, _ := r.Context().Value(authUserCtx).(*store.User)
+	return user
+}
+
+// setRequestUserID attaches the authenticated user to the access log entry.
+func setRequestUserID(ctx context.Context, userID int64) {
+	if entry, ok := ctx.Value(loggerCtx).(*requestLog); ok {
+		entry.logger = entry.logger.With("user_id", userID)
+	}
+}
+
+// requestLogger returns the logger scoped to the current request, falling
+// back to the application logger outside of an HTTP request.
+func (app *application) requestLogger(ctx context.Context) *zap.SugaredLogger {
+	if entry, ok := ctx.Value(loggerCtx).(*requestLog); ok {
+		return entry.logger
+	}
+	return app.logger
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"net/http"
+	"testing"
+)
+
+// TestRequestLogger checks that the store errors logged by the handlers and
+// the access log carry the request ID and the authenticated user.
+func TestRequestLogger(t *testing.T) {
+	a := newTestApp(t)
+	core, logs := observer.New(zapcore.DebugLevel)
+	a.logger = zap.New(core).Sugar()
+
+	alice := a.createUser("alice")
+	expectStatus(t, a.do(http.MethodPut, "/v1/users/me/blocks/404", nil, withToken(alice.token)), http.StatusNotFound)
+
+	for _, msg := range []string{"not found error", "request completed"} {
+		entries := logs.FilterMessage(msg).FilterField(zap.Int64("user_id", alice.id)).All()
+		if len(entries) != 1 {
+			t.Fatalf("%d %q entries for user %d, want 1", len(entries), msg, alice.id)
+		}
+		if id, ok := entries[0].ContextMap()["request_id"].(string); !ok || id == "" {
+			t.Errorf("%q entry without a request ID: %v", msg, entries[0].ContextMap())
+		}
+	}
+}
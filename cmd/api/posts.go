@@ -3,9 +3,13 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/igorzinar/goSocial/internal/mailer"
+	"github.com/igorzinar/goSocial/internal/richtext"
 	"github.com/igorzinar/goSocial/internal/store"
 	"net/http"
+	"slices"
 	"strconv"
 )
 
@@ -17,24 +21,28 @@ const PostIDKey string = "postID"
 type CreatePostPayload struct {
 	Content string   `json:"content" validate:"required,max=1000"`
 	Title   string   `json:"title" validate:"required,max=100"`
-	Tags    []string `json:"tags"`
+	Tags    []string `json:"tags" validate:"max=10,dive,max=100,tag"`
 }
 
 // CreatePost godoc
 //
 //	@Summary		Creates a post
-//	@Description	Creates a post
+//	@Description	Creates a post, the #hashtags of the content are added to its tags and the @mentioned users notified
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		CreatePostPayload	true	"Post payload"
+//	@Param			Idempotency-Key	header		string	false	"Makes retries of the request safe"
 //	@Success		201		{object}	store.Post
-//	@Failure		400		{object}	error
-//	@Failure		401		{object}	error
-//	@Failure		500		{object}	error
+//	@Failure		400		{object}	Problem
+//	@Failure		401		{object}	Problem
+//	@Failure		409	{object}	Problem	"Idempotency key reused for a different request"
+//	@Failure		425	{object}	Problem	"Idempotent request still in progress"
+//	@Failure		500		{object}	Problem
 //	@Security		ApiKeyAuth
 //	@Router			/posts [post]
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
 
 	var payload CreatePostPayload
 	if err := readJSON(w, r, &payload); err != nil {
@@ -47,15 +55,21 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	entities := richtext.Parse(payload.Content)
 	post := &store.Post{
-		Title:   payload.Title,
-		Content: payload.Content,
-		Tags:    payload.Tags,
-		// TODO change after auth
-		UserID: 1,
+		Title:    payload.Title,
+		Content:  payload.Content,
+		Tags:     richtext.NormalizeTags(append(payload.Tags, entities.Hashtags...)),
+		Mentions: entities.Mentions,
+		UserID:   user.ID,
 	}
 	ctx := r.Context()
-	if err := app.store.Posts.Create(ctx, post); err != nil {
+	notify, err := app.mentionNotifier(ctx, post)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Posts.Create(ctx, post, notify); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -75,8 +89,8 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 //	@Produce		json
 //	@Param			id	path		int	true	"Post ID"
 //	@Success		200	{object}	store.Post
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Failure		404	{object}	Problem
+//	@Failure		500	{object}	Problem
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [get]
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
@@ -105,8 +119,8 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 //	@Produce		json
 //	@Param			id	path		int	true	"Post ID"
 //	@Success		204	{object} string
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Failure		404	{object}	Problem
+//	@Failure		500	{object}	Problem
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [delete]
 func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -141,17 +155,17 @@ type UpdatePostPayload struct {
 // UpdatePost godoc
 //
 //	@Summary		Updates a post
-//	@Description	Updates a post by ID
+//	@Description	Updates a post by ID, its hashtags and mentions follow the new content and only newly mentioned users are notified
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
 //	@Param			id		path		int					true	"Post ID"
 //	@Param			payload	body		UpdatePostPayload	true	"Post payload"
 //	@Success		200		{object}	store.Post
-//	@Failure		400		{object}	error
-//	@Failure		401		{object}	error
-//	@Failure		404		{object}	error
-//	@Failure		500		{object}	error
+//	@Failure		400		{object}	Problem
+//	@Failure		401		{object}	Problem
+//	@Failure		404		{object}	Problem
+//	@Failure		500		{object}	Problem
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [patch]
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
@@ -169,14 +183,30 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	if payload.Content != nil {
+		// the tags given at creation stay, the hashtags follow the content
+		previous := richtext.Parse(post.Content).Hashtags
+		tags := slices.DeleteFunc(post.Tags, func(tag string) bool { return slices.Contains(previous, tag) })
 		post.Content = *payload.Content
+		post.Tags = richtext.NormalizeTags(append(tags, richtext.Parse(post.Content).Hashtags...))
 	}
+	post.Mentions = richtext.Parse(post.Content).Mentions
 
 	if payload.Title != nil {
 		post.Title = *payload.Title
 	}
-	if err := app.store.Posts.Update(r.Context(), post); err != nil {
+	notify, err := app.mentionNotifier(r.Context(), post)
+	if err != nil {
 		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.store.Posts.Update(r.Context(), post, notify); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
 	}
 
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
@@ -190,7 +220,7 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 		idParam := chi.URLParam(r, "postID")
 		id, err := strconv.ParseInt(idParam, 10, 64)
 		if err != nil {
-			app.internalServerError(w, r, err)
+			app.notFoundResponse(w, r, err)
 			return
 		}
 
@@ -211,6 +241,43 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// mentionNotifier returns the notifier emailing the users post mentions, nil
+// when it mentions nobody.
+func (app *application) mentionNotifier(ctx context.Context, post *store.Post) (store.MentionNotifier, error) {
+	if len(post.Mentions) == 0 {
+		return nil, nil
+	}
+	// loaded beforehand, the notifier runs within the transaction of the post
+	author, err := app.store.Users.GetByID(ctx, post.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(post *store.Post, mentioned []store.User) ([]*store.OutboxEmail, error) {
+		emails := make([]*store.OutboxEmail, 0, len(mentioned))
+		for _, user := range mentioned {
+			vars := struct {
+				Username  string
+				Author    string
+				PostTitle string
+				PostURL   string
+			}{
+				Username:  user.Username,
+				Author:    author.Username,
+				PostTitle: post.Title,
+				PostURL:   fmt.Sprintf("%s/posts/%d", app.config.frontendURL, post.ID),
+			}
+			email, err := store.NewOutboxEmail(app.templates.Localized(mailer.PostMentionTemplate, user.PreferredLocale), user.Username, user.Email, vars)
+			if err != nil {
+				return nil, err
+			}
+			emails = append(emails, email)
+		}
+		return emails, nil
+	}, nil
+}
+
 func getPostFromCtx(r *http.Request) *store.Post {
 	post, _ := r.Context().Value(postCtx).(*store.Post)
 	return post
@@ -0,0 +1,1083 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/igorzinar/goSocial/internal/store"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// avatarPNG is sniffed as image/png by http.DetectContentType.
+var avatarPNG = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+// routeTest exercises one route and returns the response recorded in its
+// golden file. Every test gets a fresh application.
+type routeTest struct {
+	name string
+	run  func(t *testing.T, a *testApp) *testResponse
+}
+
+// TestRoutes records the success and error responses of every route. The
+// swagger UI and the development mailbox are left out, they aren't part of
+// the API contract.
+func TestRoutes(t *testing.T) {
+	groups := map[string][]routeTest{
+		"health":         healthTests,
+		"posts":          postTests,
+		"activation":     activationTests,
+		"email":          emailTests,
+		"by_username":    byUsernameTests,
+		"me":             meTests,
+		"avatar":         avatarTests,
+		"exports":        exportTests,
+		"users":          userTests,
+		"feed":           feedTests,
+		"authentication": authenticationTests,
+		"idempotency":    idempotencyTests,
+		"problems":       problemTests,
+		"tags":           tagTests,
+		"trending":       trendingTests,
+		"suggestions":    suggestionTests,
+		"blocks":         blockTests,
+		"search":         searchTests,
+		"bookmarks":      bookmarkTests,
+	}
+
+	for group, tests := range groups {
+		t.Run(group, func(t *testing.T) {
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					t.Parallel()
+					a := newTestApp(t)
+					assertGolden(t, tt.run(t, a))
+				})
+			}
+		})
+	}
+}
+
+var healthTests = []routeTest{
+	{"live", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/health/live", nil)
+	}},
+	{"ready", func(t *testing.T, a *testApp) *testResponse {
+		a.health.Register("database", true, func(context.Context) error { return nil })
+		return a.do(http.MethodGet, "/v1/health/ready", nil)
+	}},
+	{"not_ready", func(t *testing.T, a *testApp) *testResponse {
+		a.health.Register("database", true, func(context.Context) error { return errors.New("connection refused") })
+		a.health.Register("mailer", false, func(context.Context) error { return nil })
+		return a.do(http.MethodGet, "/v1/health/ready", nil)
+	}},
+}
+
+// createPost creates a post by alice.
+func (a *testApp) createPost() int64 {
+	a.t.Helper()
+
+	alice := a.createUser("alice")
+	res := a.do(http.MethodPost, "/v1/posts", CreatePostPayload{
+		Title:   "Hello",
+		Content: "First post",
+		Tags:    []string{"go"},
+	}, withToken(alice.token))
+	expectStatus(a.t, res, http.StatusCreated)
+	return decodeData[struct {
+		ID int64 `json:"id"`
+	}](a.t, res).ID
+}
+
+var postTests = []routeTest{
+	{"create", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/posts", CreatePostPayload{
+			Title:   "Hello",
+			Content: "First post",
+			Tags:    []string{"go", "testing"},
+		}, withToken(alice.token))
+	}},
+	{"create_invalid", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/posts", CreatePostPayload{Content: "No title"}, withToken(alice.token))
+	}},
+	{"create_malformed", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/posts", []byte(`{"title": "Hello", "unknown": true}`), withToken(alice.token))
+	}},
+	{"create_without_token", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/posts", CreatePostPayload{Title: "Hello", Content: "First post"})
+	}},
+	{"get", func(t *testing.T, a *testApp) *testResponse {
+		id := a.createPost()
+		return a.do(http.MethodGet, fmt.Sprintf("/v1/posts/%d", id), nil)
+	}},
+	{"get_not_found", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/posts/42", nil)
+	}},
+	{"get_invalid_id", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/posts/abc", nil)
+	}},
+	{"update", func(t *testing.T, a *testApp) *testResponse {
+		id := a.createPost()
+		return a.do(http.MethodPatch, fmt.Sprintf("/v1/posts/%d", id), map[string]string{"title": "Hello again"})
+	}},
+	{"update_invalid", func(t *testing.T, a *testApp) *testResponse {
+		id := a.createPost()
+		return a.do(http.MethodPatch, fmt.Sprintf("/v1/posts/%d", id), map[string]string{"title": strings.Repeat("a", 101)})
+	}},
+	{"update_not_found", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPatch, "/v1/posts/42", map[string]string{"title": "Hello again"})
+	}},
+	{"delete", func(t *testing.T, a *testApp) *testResponse {
+		id := a.createPost()
+		res := a.do(http.MethodDelete, fmt.Sprintf("/v1/posts/%d", id), nil)
+		expectStatus(t, a.do(http.MethodGet, fmt.Sprintf("/v1/posts/%d", id), nil), http.StatusNotFound)
+		return res
+	}},
+	{"delete_not_found", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodDelete, "/v1/posts/42", nil)
+	}},
+}
+
+var activationTests = []routeTest{
+	{"activate", func(t *testing.T, a *testApp) *testResponse {
+		_, token := a.register("alice")
+		return a.do(http.MethodPut, "/v1/users/activate/"+token, nil)
+	}},
+	{"activate_unknown", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPut, "/v1/users/activate/unknown", nil)
+	}},
+	{"activate_expired", func(t *testing.T, a *testApp) *testResponse {
+		a.config.mail.exp = -time.Minute
+		_, token := a.register("alice")
+		return a.do(http.MethodPut, "/v1/users/activate/"+token, nil)
+	}},
+}
+
+var emailTests = []routeTest{
+	{"change", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		res := a.do(http.MethodPost, "/v1/users/me/email", ChangeEmailPayload{Email: "alice@example.org"}, withToken(alice.token))
+		sent := a.deliverEmails(3)
+		if sent[0].To == sent[1].To {
+			t.Errorf("expected the confirmation and the notice to go to different addresses, got %s", sent[0].To)
+		}
+		return res
+	}},
+	{"change_same", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/users/me/email", ChangeEmailPayload{Email: "ALICE@example.com"}, withToken(alice.token))
+	}},
+	{"change_duplicate", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		bob := a.createUser("bob")
+		return a.do(http.MethodPost, "/v1/users/me/email", ChangeEmailPayload{Email: bob.email}, withToken(alice.token))
+	}},
+	{"change_invalid", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/users/me/email", ChangeEmailPayload{Email: "alice"}, withToken(alice.token))
+	}},
+	{"change_unauthorized", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/users/me/email", ChangeEmailPayload{Email: "alice@example.org"})
+	}},
+	{"confirm", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPost, "/v1/users/me/email", ChangeEmailPayload{Email: "alice@example.org"}, withToken(alice.token)), http.StatusAccepted)
+		res := a.do(http.MethodPut, "/v1/users/email/confirm/"+a.emailChangeToken(), nil)
+		// confirming signs out every session
+		expectStatus(t, a.do(http.MethodGet, "/v1/users/me", nil, withToken(alice.token)), http.StatusUnauthorized)
+		a.login("alice@example.org", alice.password)
+		return res
+	}},
+	{"confirm_unknown", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPut, "/v1/users/email/confirm/unknown", nil)
+	}},
+	{"confirm_expired", func(t *testing.T, a *testApp) *testResponse {
+		a.config.mail.emailChangeExp = -time.Minute
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPost, "/v1/users/me/email", ChangeEmailPayload{Email: "alice@example.org"}, withToken(alice.token)), http.StatusAccepted)
+		return a.do(http.MethodPut, "/v1/users/email/confirm/"+a.emailChangeToken(), nil)
+	}},
+}
+
+var byUsernameTests = []routeTest{
+	{"get", func(t *testing.T, a *testApp) *testResponse {
+		a.createUser("alice")
+		return a.do(http.MethodGet, "/v1/users/by-username/alice", nil)
+	}},
+	{"renamed", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPatch, "/v1/users/me", map[string]string{"username": "alicia"}, withToken(alice.token)), http.StatusOK)
+		return a.do(http.MethodGet, "/v1/users/by-username/alice", nil)
+	}},
+	{"not_found", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/users/by-username/nobody", nil)
+	}},
+}
+
+var meTests = []routeTest{
+	{"get", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodGet, "/v1/users/me", nil, withToken(alice.token))
+	}},
+	{"get_without_token", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/users/me", nil)
+	}},
+	{"get_invalid_token", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/users/me", nil, withToken("invalid"))
+	}},
+	{"update", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPatch, "/v1/users/me", map[string]string{
+			"display_name": "Alice",
+			"bio":          "Gopher",
+			"website":      "https://alice.example.com",
+			"location":     "Berlin",
+		}, withToken(alice.token))
+	}},
+	{"update_invalid", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPatch, "/v1/users/me", map[string]string{"website": "alice"}, withToken(alice.token))
+	}},
+	{"update_duplicate_username", func(t *testing.T, a *testApp) *testResponse {
+		a.createUser("alice")
+		bob := a.createUser("bob")
+		return a.do(http.MethodPatch, "/v1/users/me", map[string]string{"username": "alice"}, withToken(bob.token))
+	}},
+	{"update_username_cooldown", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPatch, "/v1/users/me", map[string]string{"username": "alicia"}, withToken(alice.token)), http.StatusOK)
+		return a.do(http.MethodPatch, "/v1/users/me", map[string]string{"username": "ally"}, withToken(alice.token))
+	}},
+	{"delete", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodDelete, "/v1/users/me", DeleteAccountPayload{Password: alice.password}, withToken(alice.token))
+	}},
+	{"delete_wrong_password", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodDelete, "/v1/users/me", DeleteAccountPayload{Password: "wrong"}, withToken(alice.token))
+	}},
+	{"delete_invalid", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodDelete, "/v1/users/me", map[string]string{}, withToken(alice.token))
+	}},
+}
+
+var avatarTests = []routeTest{
+	{"upload", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPut, "/v1/users/me/avatar", avatarPNG, withToken(alice.token))
+	}},
+	{"upload_unsupported", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPut, "/v1/users/me/avatar", []byte("plain text"), withToken(alice.token))
+	}},
+	{"upload_too_large", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		body := append(bytes.Clone(avatarPNG), make([]byte, a.config.media.maxAvatarSize)...)
+		return a.do(http.MethodPut, "/v1/users/me/avatar", body, withToken(alice.token))
+	}},
+	{"delete", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPut, "/v1/users/me/avatar", avatarPNG, withToken(alice.token)), http.StatusOK)
+		return a.do(http.MethodDelete, "/v1/users/me/avatar", nil, withToken(alice.token))
+	}},
+	{"get_media", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPut, "/v1/users/me/avatar", avatarPNG, withToken(alice.token)), http.StatusOK)
+		res := a.do(http.MethodGet, "/v1/media/1", nil)
+		if !bytes.Equal(res.body, avatarPNG) {
+			t.Errorf("expected the uploaded avatar, got %d bytes", len(res.body))
+		}
+		return res
+	}},
+	{"get_media_not_found", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/media/42", nil)
+	}},
+}
+
+var exportTests = []routeTest{
+	{"request", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/users/me/export", nil, withToken(alice.token))
+	}},
+	{"request_pending", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPost, "/v1/users/me/export", nil, withToken(alice.token)), http.StatusAccepted)
+		return a.do(http.MethodPost, "/v1/users/me/export", nil, withToken(alice.token))
+	}},
+	{"list", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPost, "/v1/users/me/export", nil, withToken(alice.token)), http.StatusAccepted)
+		return a.do(http.MethodGet, "/v1/users/me/exports", nil, withToken(alice.token))
+	}},
+	{"download", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPost, "/v1/users/me/export", nil, withToken(alice.token)), http.StatusAccepted)
+		a.buildExports()
+		return a.do(http.MethodGet, a.downloadPath(1, a.clock.Now().Add(time.Hour)), nil)
+	}},
+	{"download_invalid_signature", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPost, "/v1/users/me/export", nil, withToken(alice.token)), http.StatusAccepted)
+		a.buildExports()
+		path := a.downloadPath(2, a.clock.Now().Add(time.Hour))
+		return a.do(http.MethodGet, strings.Replace(path, "/exports/2/", "/exports/1/", 1), nil)
+	}},
+	{"download_expired_link", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPost, "/v1/users/me/export", nil, withToken(alice.token)), http.StatusAccepted)
+		a.buildExports()
+		path := a.downloadPath(1, a.clock.Now().Add(time.Minute))
+		a.clock.Advance(2 * time.Minute)
+		return a.do(http.MethodGet, path, nil)
+	}},
+}
+
+var userTests = []routeTest{
+	{"get", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodGet, fmt.Sprintf("/v1/users/%d", alice.id), nil)
+	}},
+	{"get_not_found", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/users/42", nil)
+	}},
+	{"get_invalid_id", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/users/alice", nil)
+	}},
+	{"follow", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		bob := a.createUser("bob")
+		return a.do(http.MethodPut, fmt.Sprintf("/v1/users/%d/follow", alice.id), FollowUser{UserID: bob.id})
+	}},
+	{"follow_twice", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		bob := a.createUser("bob")
+		path := fmt.Sprintf("/v1/users/%d/follow", alice.id)
+		expectStatus(t, a.do(http.MethodPut, path, FollowUser{UserID: bob.id}), http.StatusNoContent)
+		return a.do(http.MethodPut, path, FollowUser{UserID: bob.id})
+	}},
+	{"follow_unknown", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPut, fmt.Sprintf("/v1/users/%d/follow", alice.id), FollowUser{UserID: 42})
+	}},
+	{"unfollow", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		bob := a.createUser("bob")
+		expectStatus(t, a.do(http.MethodPut, fmt.Sprintf("/v1/users/%d/follow", alice.id), FollowUser{UserID: bob.id}), http.StatusNoContent)
+		return a.do(http.MethodPut, fmt.Sprintf("/v1/users/%d/unfollow", alice.id), FollowUser{UserID: bob.id})
+	}},
+}
+
+// rankedFeedFixture gives the feed reader three posts ranked commented, own
+// and followed, and one from too far in the follow graph. It returns the
+// reader.
+func rankedFeedFixture(t *testing.T, a *testApp) testUser {
+	t.Helper()
+	for i := 1; i <= 3; i++ {
+		a.createUser(fmt.Sprintf("user%d", i))
+	}
+	reader := a.createUser("reader")
+	ctx := context.Background()
+	// the reader follows 1, who follows 2, who follows 3
+	for _, f := range [][2]int64{{reader.id, 1}, {1, 2}, {2, 3}} {
+		if err := a.store.Followers.Follow(ctx, f[0], f[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	posts := []*store.Post{
+		{UserID: 1, Title: "Followed", Content: "About #go", Tags: []string{"go"}},
+		{UserID: 2, Title: "Second degree", Content: "About #rust", Tags: []string{"rust"}},
+		{UserID: 3, Title: "Third degree", Content: "About #go", Tags: []string{"go"}},
+		{UserID: reader.id, Title: "Own", Content: "About #go", Tags: []string{"go"}},
+	}
+	for _, p := range posts {
+		if err := a.store.Posts.Create(ctx, p, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.store.Comments.Create(ctx, &store.Comment{PostID: posts[1].ID, UserID: reader.id, Content: "Nice"}); err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+// bookmarkedFeedFixture is rankedFeedFixture where the reader bookmarked the
+// followed post and someone else their own post, which is only bookmarked
+// for them. It returns the reader.
+func bookmarkedFeedFixture(t *testing.T, a *testApp) testUser {
+	t.Helper()
+	reader := rankedFeedFixture(t, a)
+	other := a.createUser("other")
+	expectStatus(t, a.do(http.MethodPut, "/v1/posts/1/bookmark", nil, withToken(reader.token)), http.StatusNoContent)
+	expectStatus(t, a.do(http.MethodPut, "/v1/posts/4/bookmark", nil, withToken(other.token)), http.StatusNoContent)
+	return reader
+}
+
+var feedTests = []routeTest{
+	{"bookmarked", func(t *testing.T, a *testApp) *testResponse {
+		reader := bookmarkedFeedFixture(t, a)
+		return a.do(http.MethodGet, "/v1/users/feed", nil, withToken(reader.token))
+	}},
+	{"ranked_bookmarked", func(t *testing.T, a *testApp) *testResponse {
+		reader := bookmarkedFeedFixture(t, a)
+		return a.do(http.MethodGet, "/v1/users/feed?mode=ranked", nil, withToken(reader.token))
+	}},
+	{"get", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodGet, "/v1/users/feed?limit=10&sort=asc", nil, withToken(alice.token))
+	}},
+	{"ranked", func(t *testing.T, a *testApp) *testResponse {
+		reader := rankedFeedFixture(t, a)
+		res := a.do(http.MethodGet, "/v1/users/feed?mode=ranked", nil, withToken(reader.token))
+		if res.header.Get("Feed-Snapshot") == "" {
+			t.Error("no Feed-Snapshot header")
+		}
+		return res
+	}},
+	{"ranked_debug", func(t *testing.T, a *testApp) *testResponse {
+		reader := rankedFeedFixture(t, a)
+		return a.do(http.MethodGet, "/v1/users/feed?mode=ranked&debug=true&limit=2", nil, withToken(reader.token))
+	}},
+	{"ranked_snapshot", func(t *testing.T, a *testApp) *testResponse {
+		reader := rankedFeedFixture(t, a)
+		res := a.do(http.MethodGet, "/v1/users/feed?mode=ranked&limit=2", nil, withToken(reader.token))
+		expectStatus(t, res, http.StatusOK)
+		snapshot := res.header.Get("Feed-Snapshot")
+
+		// later activity would rank the followed post first
+		a.clock.Advance(time.Second)
+		for i := 0; i < 3; i++ {
+			if err := a.store.Comments.Create(context.Background(), &store.Comment{PostID: 1, UserID: reader.id, Content: "Nice"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		res = a.do(http.MethodGet, "/v1/users/feed?mode=ranked&limit=2&offset=2&snapshot="+snapshot, nil, withToken(reader.token))
+		if got := res.header.Get("Feed-Snapshot"); got != snapshot {
+			t.Errorf("Feed-Snapshot = %q, want %q", got, snapshot)
+		}
+		return res
+	}},
+	{"ranked_other_reader", func(t *testing.T, a *testApp) *testResponse {
+		rankedFeedFixture(t, a)
+		other := a.createUser("other")
+		return a.do(http.MethodGet, "/v1/users/feed?mode=ranked", nil, withToken(other.token))
+	}},
+	{"ranked_invalid_mode", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodGet, "/v1/users/feed?mode=popular", nil, withToken(alice.token))
+	}},
+	{"get_invalid", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodGet, "/v1/users/feed?limit=50", nil, withToken(alice.token))
+	}},
+	{"get_unparsable", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodGet, "/v1/users/feed?limit=ten", nil, withToken(alice.token))
+	}},
+	{"without_token", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/users/feed", nil)
+	}},
+}
+
+var authenticationTests = []routeTest{
+	{"register", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/authentication/user", RegisterUserPayload{
+			Username: "alice",
+			Email:    "alice@example.com",
+			Password: "password",
+		})
+	}},
+	{"register_invalid", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/authentication/user", RegisterUserPayload{Username: "al", Email: "alice"})
+	}},
+	{"register_invalid_localized", func(t *testing.T, a *testApp) *testResponse {
+		payload := RegisterUserPayload{Username: "al", Email: "alice"}
+		english := decodeProblem(t, a.do(http.MethodPost, "/v1/authentication/user", payload)).Detail
+		res := a.do(http.MethodPost, "/v1/authentication/user", payload, withHeader("Accept-Language", "de"))
+		if decodeProblem(t, res).Detail == english {
+			t.Errorf("expected a German message, got %q", english)
+		}
+		return res
+	}},
+	{"register_duplicate_email", func(t *testing.T, a *testApp) *testResponse {
+		a.register("alice")
+		return a.do(http.MethodPost, "/v1/authentication/user", RegisterUserPayload{
+			Username: "alicia",
+			Email:    "ALICE@example.com",
+			Password: "password",
+		})
+	}},
+	{"register_duplicate_username", func(t *testing.T, a *testApp) *testResponse {
+		a.register("alice")
+		return a.do(http.MethodPost, "/v1/authentication/user", RegisterUserPayload{
+			Username: "alice",
+			Email:    "alicia@example.com",
+			Password: "password",
+		})
+	}},
+	{"resend_activation", func(t *testing.T, a *testApp) *testResponse {
+		// invitations are stamped at second precision, up to half a second
+		// ahead of the clock
+		a.config.mail.resendCooldown = -time.Second
+		a.register("alice")
+		res := a.do(http.MethodPost, "/v1/authentication/resend-activation", ResendActivationPayload{Email: "alice@example.com"})
+		a.deliverEmails(2)
+		return res
+	}},
+	{"resend_activation_unknown", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/authentication/resend-activation", ResendActivationPayload{Email: "nobody@example.com"})
+	}},
+	{"resend_activation_too_soon", func(t *testing.T, a *testApp) *testResponse {
+		a.register("alice")
+		// Retry-After is the time left of the cooldown
+		a.clock.Advance(30 * time.Second)
+		return a.do(http.MethodPost, "/v1/authentication/resend-activation", ResendActivationPayload{Email: "alice@example.com"})
+	}},
+	{"resend_activation_invalid", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/authentication/resend-activation", ResendActivationPayload{})
+	}},
+	{"create_token", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/authentication/token", CreateTokenPayload{Email: alice.email, Password: alice.password})
+	}},
+	{"create_token_wrong_password", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/authentication/token", CreateTokenPayload{Email: alice.email, Password: "wrong"})
+	}},
+	{"create_token_unknown_email", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/authentication/token", CreateTokenPayload{Email: "nobody@example.com", Password: "password"})
+	}},
+	{"create_token_inactive", func(t *testing.T, a *testApp) *testResponse {
+		a.register("alice")
+		return a.do(http.MethodPost, "/v1/authentication/token", CreateTokenPayload{Email: "alice@example.com", Password: "password"})
+	}},
+	{"create_token_invalid", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/authentication/token", CreateTokenPayload{Email: "alice"})
+	}},
+	{"create_token_cancels_deletion", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodDelete, "/v1/users/me", DeleteAccountPayload{Password: alice.password}, withToken(alice.token)), http.StatusAccepted)
+		token := a.login(alice.email, alice.password)
+		return a.do(http.MethodGet, "/v1/users/me", nil, withToken(token))
+	}},
+	{"delete_token", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		res := a.do(http.MethodDelete, "/v1/authentication/token", nil, withToken(alice.token))
+		expectStatus(t, a.do(http.MethodGet, "/v1/users/me", nil, withToken(alice.token)), http.StatusUnauthorized)
+		return res
+	}},
+	{"delete_token_unauthorized", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodDelete, "/v1/authentication/token", nil)
+	}},
+	{"deactivated_signed_out", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		if err := a.store.Users.SetActive(context.Background(), alice.id, false); err != nil {
+			t.Fatal(err)
+		}
+		return a.do(http.MethodGet, "/v1/users/me", nil, withToken(alice.token))
+	}},
+	{"inactive_session", func(t *testing.T, a *testApp) *testResponse {
+		ctx := context.Background()
+		alice := a.createUser("alice")
+		if err := a.store.Users.SetActive(ctx, alice.id, false); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.store.Sessions.Create(ctx, alice.id, hashToken("leftover"), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		return a.do(http.MethodGet, "/v1/users/me", nil, withToken("leftover"))
+	}},
+}
+
+var idempotencyTests = []routeTest{
+	{"replay", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		payload := CreatePostPayload{Title: "Hello", Content: "First post", Tags: []string{"go"}}
+		first := a.do(http.MethodPost, "/v1/posts", payload, withHeader("Idempotency-Key", "post-1"), withToken(alice.token))
+		expectStatus(t, first, http.StatusCreated)
+
+		res := a.do(http.MethodPost, "/v1/posts", payload, withHeader("Idempotency-Key", "post-1"), withToken(alice.token))
+		if !bytes.Equal(res.body, first.body) {
+			t.Errorf("replayed %s, want %s", res.body, first.body)
+		}
+		expectStatus(t, a.do(http.MethodGet, "/v1/posts/2", nil), http.StatusNotFound)
+		return res
+	}},
+	{"registration_not_stored", func(t *testing.T, a *testApp) *testResponse {
+		// the response carries the activation token, a retry registers again
+		payload := RegisterUserPayload{Username: "alice", Email: "alice@example.com", Password: "password"}
+		expectStatus(t, a.do(http.MethodPost, "/v1/authentication/user", payload, withHeader("Idempotency-Key", "signup")), http.StatusCreated)
+		res := a.do(http.MethodPost, "/v1/authentication/user", payload, withHeader("Idempotency-Key", "signup"))
+		a.deliverEmails(1)
+		if got := a.mailer.Count(); got != 1 {
+			t.Errorf("sent %d welcome emails, want 1", got)
+		}
+		return res
+	}},
+	{"token_not_stored", func(t *testing.T, a *testApp) *testResponse {
+		// a retry signs in again instead of getting the stored token back
+		alice := a.createUser("alice")
+		payload := CreateTokenPayload{Email: alice.email, Password: alice.password}
+		first := a.do(http.MethodPost, "/v1/authentication/token", payload, withHeader("Idempotency-Key", "login"))
+		expectStatus(t, first, http.StatusCreated)
+		res := a.do(http.MethodPost, "/v1/authentication/token", payload, withHeader("Idempotency-Key", "login"))
+		expectStatus(t, res, http.StatusCreated)
+		if decodeData[SessionToken](t, res).Token == decodeData[SessionToken](t, first).Token {
+			t.Error("the session token was replayed")
+		}
+		return res
+	}},
+	{"different_request", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		expectStatus(t, a.do(http.MethodPost, "/v1/posts", CreatePostPayload{Title: "Hello", Content: "First post"}, withHeader("Idempotency-Key", "post-1"), withToken(alice.token)), http.StatusCreated)
+		return a.do(http.MethodPost, "/v1/posts", CreatePostPayload{Title: "Hello", Content: "Second post"}, withHeader("Idempotency-Key", "post-1"), withToken(alice.token))
+	}},
+	{"in_progress", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		body := []byte(`{"title":"Hello","content":"First post"}`)
+		key := &store.IdempotencyKey{
+			Scope:       fmt.Sprintf("user:%d", alice.id),
+			Key:         "post-1",
+			Fingerprint: requestFingerprint(httptest.NewRequest(http.MethodPost, "/v1/posts", nil), body),
+		}
+		existing, err := a.store.Idempotency.Begin(context.Background(), key, time.Hour, time.Hour)
+		if err != nil || existing != nil {
+			t.Fatalf("Begin = %+v, %v", existing, err)
+		}
+		return a.do(http.MethodPost, "/v1/posts", body, withHeader("Idempotency-Key", "post-1"), withToken(alice.token))
+	}},
+	{"scoped_by_user", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		bob := a.createUser("bob")
+		expectStatus(t, a.do(http.MethodPost, "/v1/users/me/export", nil, withToken(alice.token), withHeader("Idempotency-Key", "export")), http.StatusAccepted)
+		return a.do(http.MethodPost, "/v1/users/me/export", nil, withToken(bob.token), withHeader("Idempotency-Key", "export"))
+	}},
+	{"errors_replayed", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		payload := CreatePostPayload{Content: "No title"}
+		expectStatus(t, a.do(http.MethodPost, "/v1/posts", payload, withHeader("Idempotency-Key", "post-1"), withToken(alice.token)), http.StatusBadRequest)
+		return a.do(http.MethodPost, "/v1/posts", payload, withHeader("Idempotency-Key", "post-1"), withToken(alice.token))
+	}},
+	{"invalid_key", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/posts", CreatePostPayload{Title: "Hello", Content: "First post"}, withHeader("Idempotency-Key", strings.Repeat("k", 256)), withToken(alice.token))
+	}},
+}
+
+var problemTests = []routeTest{
+	{"malformed_body", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/authentication/user", []byte(`{"username": "alice",}`))
+	}},
+	{"empty_body", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/authentication/user", []byte{})
+	}},
+	{"truncated_body", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/authentication/user", []byte(`{"username": "alice"`))
+	}},
+	{"wrong_type", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/authentication/user", []byte(`{"username": 42}`))
+	}},
+	{"unknown_field", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPost, "/v1/authentication/user", []byte(`{"nickname": "alice"}`))
+	}},
+	{"too_large", func(t *testing.T, a *testApp) *testResponse {
+		body := fmt.Sprintf(`{"username": %q}`, strings.Repeat("a", maxRequestBody))
+		return a.do(http.MethodPost, "/v1/authentication/user", []byte(body))
+	}},
+	{"instance", func(t *testing.T, a *testApp) *testResponse {
+		res := a.do(http.MethodGet, "/v1/posts/999", nil, withHeader("X-Request-Id", "req-1"))
+		if p := decodeProblem(t, res); p.Instance != "req-1" {
+			t.Errorf("expected the request ID as instance, got %q", p.Instance)
+		}
+		return res
+	}},
+	{"unknown_route", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/nowhere", nil)
+	}},
+	{"method_not_allowed", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodDelete, "/v1/health/live", nil)
+	}},
+	{"accept_json", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/posts/999", nil, withHeader("Accept", "application/json"))
+	}},
+}
+
+var tagTests = []routeTest{
+	{"create_with_hashtags", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/posts", CreatePostPayload{
+			Title:   "Hello",
+			Content: "Learning #Go and #SQL, not a#tag nor #42 #go",
+			Tags:    []string{"#Testing", "go"},
+		}, withToken(alice.token))
+	}},
+	{"create_with_invalid_tags", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/posts", CreatePostPayload{
+			Title:   "Hello",
+			Content: "Learning #Go",
+			Tags:    []string{"testing", "two words", "42"},
+		}, withToken(alice.token))
+	}},
+	{"create_with_mentions", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		a.createUser("bob")
+		a.createUser("carol")
+		res := a.do(http.MethodPost, "/v1/posts", CreatePostPayload{
+			Title:   "Hello",
+			Content: "Thanks @bob and @carol. Not @nobody, nor me@alice.example, nor myself @alice!",
+		}, withToken(alice.token))
+		expectStatus(t, res, http.StatusCreated)
+
+		var mentions []string
+		for _, msg := range a.deliverEmails(5) {
+			if strings.HasPrefix(msg.Subject, "alice mentioned you") {
+				mentions = append(mentions, msg.To)
+			}
+		}
+		slices.Sort(mentions)
+		if !slices.Equal(mentions, []string{`"bob" <bob@example.com>`, `"carol" <carol@example.com>`}) {
+			t.Errorf("mention emails sent to %v", mentions)
+		}
+		return res
+	}},
+	{"update_retags", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		res := a.do(http.MethodPost, "/v1/posts", CreatePostPayload{Title: "Hello", Content: "About #go", Tags: []string{"testing"}}, withToken(alice.token))
+		expectStatus(t, res, http.StatusCreated)
+		id := decodeData[struct {
+			ID int64 `json:"id"`
+		}](t, res).ID
+		return a.do(http.MethodPatch, fmt.Sprintf("/v1/posts/%d", id), map[string]string{"content": "About #rust"})
+	}},
+	{"posts", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		for _, content := range []string{"First #go post", "A #rust post", "Second #go post"} {
+			expectStatus(t, a.do(http.MethodPost, "/v1/posts", CreatePostPayload{Title: "Hello", Content: content}, withToken(alice.token)), http.StatusCreated)
+		}
+		return a.do(http.MethodGet, "/v1/tags/%23GO/posts?sort=asc", nil)
+	}},
+	{"posts_unknown", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/tags/go/posts", nil)
+	}},
+	{"search", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		for _, content := range []string{"#go #golang", "#go #gopher", "#rust"} {
+			expectStatus(t, a.do(http.MethodPost, "/v1/posts", CreatePostPayload{Title: "Hello", Content: content}, withToken(alice.token)), http.StatusCreated)
+		}
+		return a.do(http.MethodGet, "/v1/tags?prefix=%23Go&limit=2", nil)
+	}},
+	{"search_invalid", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/tags?limit=100", nil)
+	}},
+}
+
+// postTrending creates posts scoring 1, 3 and 1: the second one is commented.
+func postTrending(t *testing.T, a *testApp) {
+	t.Helper()
+	alice := a.createUser("alice")
+	for _, content := range []string{"Learning #go", "#go and #sql", "Trying #rust"} {
+		expectStatus(t, a.do(http.MethodPost, "/v1/posts", CreatePostPayload{Title: "Hello", Content: content}, withToken(alice.token)), http.StatusCreated)
+	}
+	if err := a.store.Comments.Create(context.Background(), &store.Comment{PostID: 2, UserID: 1, Content: "Nice"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var trendingTests = []routeTest{
+	{"tags", func(t *testing.T, a *testApp) *testResponse {
+		postTrending(t, a)
+		a.computeTrending()
+		return a.do(http.MethodGet, "/v1/trending/tags", nil)
+	}},
+	{"posts", func(t *testing.T, a *testApp) *testResponse {
+		postTrending(t, a)
+		a.computeTrending()
+		return a.do(http.MethodGet, "/v1/trending/posts?limit=2", nil)
+	}},
+	{"not_computed", func(t *testing.T, a *testApp) *testResponse {
+		postTrending(t, a)
+		return a.do(http.MethodGet, "/v1/trending/posts", nil)
+	}},
+	{"invalid_limit", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/trending/tags?limit=100", nil)
+	}},
+}
+
+// suggestionFixture makes alice follow bob, who follows carol and dave, and
+// erin follow carol. It returns alice.
+func suggestionFixture(t *testing.T, a *testApp) testUser {
+	t.Helper()
+	users := map[string]testUser{}
+	for _, name := range []string{"alice", "bob", "carol", "dave", "erin"} {
+		users[name] = a.createUser(name)
+	}
+	for _, f := range [][2]string{{"alice", "bob"}, {"bob", "carol"}, {"bob", "dave"}, {"erin", "carol"}} {
+		if err := a.store.Followers.Follow(context.Background(), users[f[0]].id, users[f[1]].id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return users["alice"]
+}
+
+var suggestionTests = []routeTest{
+	{"list", func(t *testing.T, a *testApp) *testResponse {
+		alice := suggestionFixture(t, a)
+		return a.do(http.MethodGet, "/v1/users/me/suggestions", nil, withToken(alice.token))
+	}},
+	{"list_without_follows", func(t *testing.T, a *testApp) *testResponse {
+		suggestionFixture(t, a)
+		frank := a.createUser("frank")
+		return a.do(http.MethodGet, "/v1/users/me/suggestions?limit=2", nil, withToken(frank.token))
+	}},
+	{"list_precomputed", func(t *testing.T, a *testApp) *testResponse {
+		alice := suggestionFixture(t, a)
+		a.config.suggestions.minFollowing = 1
+		a.precomputeSuggestions()
+		// dave's new follower isn't in the precomputed score
+		if err := a.store.Followers.Follow(context.Background(), 5, 4); err != nil {
+			t.Fatal(err)
+		}
+		return a.do(http.MethodGet, "/v1/users/me/suggestions", nil, withToken(alice.token))
+	}},
+	{"list_invalid", func(t *testing.T, a *testApp) *testResponse {
+		alice := suggestionFixture(t, a)
+		return a.do(http.MethodGet, "/v1/users/me/suggestions?limit=0", nil, withToken(alice.token))
+	}},
+	{"dismiss", func(t *testing.T, a *testApp) *testResponse {
+		alice := suggestionFixture(t, a)
+		expectStatus(t, a.do(http.MethodDelete, "/v1/users/me/suggestions/3", nil, withToken(alice.token)), http.StatusNoContent)
+		return a.do(http.MethodGet, "/v1/users/me/suggestions", nil, withToken(alice.token))
+	}},
+	{"dismiss_unknown", func(t *testing.T, a *testApp) *testResponse {
+		alice := suggestionFixture(t, a)
+		return a.do(http.MethodDelete, "/v1/users/me/suggestions/404", nil, withToken(alice.token))
+	}},
+	{"block", func(t *testing.T, a *testApp) *testResponse {
+		alice := suggestionFixture(t, a)
+		expectStatus(t, a.do(http.MethodPut, "/v1/users/me/blocks/3", nil, withToken(alice.token)), http.StatusNoContent)
+		return a.do(http.MethodGet, "/v1/users/me/suggestions", nil, withToken(alice.token))
+	}},
+	{"unblock", func(t *testing.T, a *testApp) *testResponse {
+		alice := suggestionFixture(t, a)
+		expectStatus(t, a.do(http.MethodPut, "/v1/users/me/blocks/3", nil, withToken(alice.token)), http.StatusNoContent)
+		expectStatus(t, a.do(http.MethodDelete, "/v1/users/me/blocks/3", nil, withToken(alice.token)), http.StatusNoContent)
+		return a.do(http.MethodGet, "/v1/users/me/suggestions", nil, withToken(alice.token))
+	}},
+}
+
+// blockFixture creates alice, bob and carol, alice blocks bob then carol. It
+// returns alice.
+func blockFixture(t *testing.T, a *testApp) testUser {
+	t.Helper()
+	alice := a.createUser("alice")
+	a.createUser("bob")
+	a.createUser("carol")
+	for _, id := range []string{"2", "3"} {
+		expectStatus(t, a.do(http.MethodPut, "/v1/users/me/blocks/"+id, nil, withToken(alice.token)), http.StatusNoContent)
+	}
+	return alice
+}
+
+var blockTests = []routeTest{
+	{"list", func(t *testing.T, a *testApp) *testResponse {
+		alice := blockFixture(t, a)
+		return a.do(http.MethodGet, "/v1/users/me/blocks", nil, withToken(alice.token))
+	}},
+	{"block_again", func(t *testing.T, a *testApp) *testResponse {
+		alice := blockFixture(t, a)
+		expectStatus(t, a.do(http.MethodPut, "/v1/users/me/blocks/2", nil, withToken(alice.token)), http.StatusNoContent)
+		return a.do(http.MethodGet, "/v1/users/me/blocks", nil, withToken(alice.token))
+	}},
+	{"block_unknown", func(t *testing.T, a *testApp) *testResponse {
+		alice := blockFixture(t, a)
+		return a.do(http.MethodPut, "/v1/users/me/blocks/404", nil, withToken(alice.token))
+	}},
+	{"block_invalid_id", func(t *testing.T, a *testApp) *testResponse {
+		alice := blockFixture(t, a)
+		return a.do(http.MethodPut, "/v1/users/me/blocks/bob", nil, withToken(alice.token))
+	}},
+	{"block_self", func(t *testing.T, a *testApp) *testResponse {
+		alice := blockFixture(t, a)
+		return a.do(http.MethodPut, "/v1/users/me/blocks/1", nil, withToken(alice.token))
+	}},
+	{"unblock", func(t *testing.T, a *testApp) *testResponse {
+		alice := blockFixture(t, a)
+		expectStatus(t, a.do(http.MethodDelete, "/v1/users/me/blocks/2", nil, withToken(alice.token)), http.StatusNoContent)
+		expectStatus(t, a.do(http.MethodDelete, "/v1/users/me/blocks/2", nil, withToken(alice.token)), http.StatusNoContent)
+		return a.do(http.MethodGet, "/v1/users/me/blocks", nil, withToken(alice.token))
+	}},
+	{"without_token", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodPut, "/v1/users/me/blocks/2", nil)
+	}},
+}
+
+// searchFixture creates alice, alicia, malice and bob, known as Alice Cooper.
+// The viewer follows alicia and malice follows the viewer. It returns the
+// viewer.
+func searchFixture(t *testing.T, a *testApp) testUser {
+	t.Helper()
+	ctx := context.Background()
+	users := map[string]testUser{}
+	for _, name := range []string{"viewer", "alice", "alicia", "malice", "bob"} {
+		users[name] = a.createUser(name)
+	}
+	bob, err := a.store.Users.GetByID(ctx, users["bob"].id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob.DisplayName = "Alice Cooper"
+	if err := a.store.Users.UpdateProfile(ctx, bob, 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range [][2]string{{"viewer", "alicia"}, {"malice", "viewer"}} {
+		if err := a.store.Followers.Follow(ctx, users[f[0]].id, users[f[1]].id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return users["viewer"]
+}
+
+var searchTests = []routeTest{
+	{"users", func(t *testing.T, a *testApp) *testResponse {
+		viewer := searchFixture(t, a)
+		return a.do(http.MethodGet, "/v1/search/users?q=alice", nil, withToken(viewer.token))
+	}},
+	{"users_autocomplete", func(t *testing.T, a *testApp) *testResponse {
+		viewer := searchFixture(t, a)
+		return a.do(http.MethodGet, "/v1/search/users?q=@ali&autocomplete=true&limit=2", nil, withToken(viewer.token))
+	}},
+	{"users_blocked", func(t *testing.T, a *testApp) *testResponse {
+		viewer := searchFixture(t, a)
+		expectStatus(t, a.do(http.MethodPut, "/v1/users/me/blocks/3", nil, withToken(viewer.token)), http.StatusNoContent)
+		return a.do(http.MethodGet, "/v1/search/users?q=alice", nil, withToken(viewer.token))
+	}},
+	{"users_no_match", func(t *testing.T, a *testApp) *testResponse {
+		viewer := searchFixture(t, a)
+		return a.do(http.MethodGet, "/v1/search/users?q=zed", nil, withToken(viewer.token))
+	}},
+	{"users_missing_query", func(t *testing.T, a *testApp) *testResponse {
+		viewer := searchFixture(t, a)
+		return a.do(http.MethodGet, "/v1/search/users?q=@", nil, withToken(viewer.token))
+	}},
+	{"users_invalid_autocomplete", func(t *testing.T, a *testApp) *testResponse {
+		viewer := searchFixture(t, a)
+		return a.do(http.MethodGet, "/v1/search/users?q=ali&autocomplete=maybe", nil, withToken(viewer.token))
+	}},
+	{"users_without_token", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/search/users?q=alice", nil)
+	}},
+}
+
+// bookmarkFixture creates alice, three posts and her "later" collection, in
+// which she bookmarks the second post, and the first and third outside of it.
+// It returns alice.
+func bookmarkFixture(t *testing.T, a *testApp) testUser {
+	t.Helper()
+	alice := a.createUser("alice")
+	for _, title := range []string{"First", "Second", "Third"} {
+		expectStatus(t, a.do(http.MethodPost, "/v1/posts", CreatePostPayload{Title: title, Content: "Hello"}, withToken(alice.token)), http.StatusCreated)
+	}
+	expectStatus(t, a.do(http.MethodPost, "/v1/users/me/collections", CreateCollectionPayload{Name: "later"}, withToken(alice.token)), http.StatusCreated)
+	expectStatus(t, a.do(http.MethodPut, "/v1/posts/1/bookmark", nil, withToken(alice.token)), http.StatusNoContent)
+	expectStatus(t, a.do(http.MethodPut, "/v1/posts/2/bookmark", map[string]int64{"collection_id": 1}, withToken(alice.token)), http.StatusNoContent)
+	expectStatus(t, a.do(http.MethodPut, "/v1/posts/3/bookmark", nil, withToken(alice.token)), http.StatusNoContent)
+	return alice
+}
+
+var bookmarkTests = []routeTest{
+	{"list", func(t *testing.T, a *testApp) *testResponse {
+		alice := bookmarkFixture(t, a)
+		return a.do(http.MethodGet, "/v1/users/me/bookmarks", nil, withToken(alice.token))
+	}},
+	{"list_first_page", func(t *testing.T, a *testApp) *testResponse {
+		alice := bookmarkFixture(t, a)
+		return a.do(http.MethodGet, "/v1/users/me/bookmarks?limit=2", nil, withToken(alice.token))
+	}},
+	{"list_next_page", func(t *testing.T, a *testApp) *testResponse {
+		alice := bookmarkFixture(t, a)
+		res := a.do(http.MethodGet, "/v1/users/me/bookmarks?limit=2", nil, withToken(alice.token))
+		expectStatus(t, res, http.StatusOK)
+		cursor := decodeData[BookmarkPage](t, res).NextCursor
+		return a.do(http.MethodGet, "/v1/users/me/bookmarks?limit=2&cursor="+cursor, nil, withToken(alice.token))
+	}},
+	{"list_collection", func(t *testing.T, a *testApp) *testResponse {
+		alice := bookmarkFixture(t, a)
+		return a.do(http.MethodGet, "/v1/users/me/bookmarks?collection=1", nil, withToken(alice.token))
+	}},
+	{"list_collection_of_someone_else", func(t *testing.T, a *testApp) *testResponse {
+		bookmarkFixture(t, a)
+		bob := a.createUser("bob")
+		return a.do(http.MethodGet, "/v1/users/me/bookmarks?collection=1", nil, withToken(bob.token))
+	}},
+	{"list_invalid_cursor", func(t *testing.T, a *testApp) *testResponse {
+		alice := bookmarkFixture(t, a)
+		return a.do(http.MethodGet, "/v1/users/me/bookmarks?cursor=nope", nil, withToken(alice.token))
+	}},
+	{"list_without_token", func(t *testing.T, a *testApp) *testResponse {
+		return a.do(http.MethodGet, "/v1/users/me/bookmarks", nil)
+	}},
+	{"move", func(t *testing.T, a *testApp) *testResponse {
+		alice := bookmarkFixture(t, a)
+		expectStatus(t, a.do(http.MethodPut, "/v1/posts/2/bookmark", nil, withToken(alice.token)), http.StatusNoContent)
+		return a.do(http.MethodGet, "/v1/users/me/bookmarks", nil, withToken(alice.token))
+	}},
+	{"save_unknown_post", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPut, "/v1/posts/404/bookmark", nil, withToken(alice.token))
+	}},
+	{"save_collection_of_someone_else", func(t *testing.T, a *testApp) *testResponse {
+		bookmarkFixture(t, a)
+		bob := a.createUser("bob")
+		return a.do(http.MethodPut, "/v1/posts/1/bookmark", map[string]int64{"collection_id": 1}, withToken(bob.token))
+	}},
+	{"save_without_token", func(t *testing.T, a *testApp) *testResponse {
+		bookmarkFixture(t, a)
+		return a.do(http.MethodPut, "/v1/posts/1/bookmark", nil)
+	}},
+	{"delete", func(t *testing.T, a *testApp) *testResponse {
+		alice := bookmarkFixture(t, a)
+		expectStatus(t, a.do(http.MethodDelete, "/v1/posts/3/bookmark", nil, withToken(alice.token)), http.StatusNoContent)
+		expectStatus(t, a.do(http.MethodDelete, "/v1/posts/3/bookmark", nil, withToken(alice.token)), http.StatusNoContent)
+		return a.do(http.MethodGet, "/v1/users/me/bookmarks", nil, withToken(alice.token))
+	}},
+	{"delete_post", func(t *testing.T, a *testApp) *testResponse {
+		alice := bookmarkFixture(t, a)
+		expectStatus(t, a.do(http.MethodDelete, "/v1/posts/2", nil), http.StatusNoContent)
+		return a.do(http.MethodGet, "/v1/users/me/bookmarks", nil, withToken(alice.token))
+	}},
+	{"collections", func(t *testing.T, a *testApp) *testResponse {
+		alice := bookmarkFixture(t, a)
+		expectStatus(t, a.do(http.MethodPost, "/v1/users/me/collections", CreateCollectionPayload{Name: "Recipes"}, withToken(alice.token)), http.StatusCreated)
+		return a.do(http.MethodGet, "/v1/users/me/collections", nil, withToken(alice.token))
+	}},
+	{"create_collection", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/users/me/collections", CreateCollectionPayload{Name: " Recipes "}, withToken(alice.token))
+	}},
+	{"create_collection_duplicate", func(t *testing.T, a *testApp) *testResponse {
+		alice := bookmarkFixture(t, a)
+		return a.do(http.MethodPost, "/v1/users/me/collections", CreateCollectionPayload{Name: "later"}, withToken(alice.token))
+	}},
+	{"create_collection_invalid", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodPost, "/v1/users/me/collections", CreateCollectionPayload{Name: " "}, withToken(alice.token))
+	}},
+	{"delete_collection", func(t *testing.T, a *testApp) *testResponse {
+		alice := bookmarkFixture(t, a)
+		expectStatus(t, a.do(http.MethodDelete, "/v1/users/me/collections/1", nil, withToken(alice.token)), http.StatusNoContent)
+		return a.do(http.MethodGet, "/v1/users/me/bookmarks?limit=2", nil, withToken(alice.token))
+	}},
+	{"delete_collection_unknown", func(t *testing.T, a *testApp) *testResponse {
+		alice := a.createUser("alice")
+		return a.do(http.MethodDelete, "/v1/users/me/collections/404", nil, withToken(alice.token))
+	}},
+}
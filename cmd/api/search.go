@@ -0,0 +1,73 @@
+package main
+
+import (
+	"github.com/igorzinar/goSocial/internal/store"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type UserSearchQuery struct {
+	Query        string `json:"q" validate:"required,max=100"`
+	Autocomplete bool   `json:"autocomplete"`
+	Limit        int    `json:"limit" validate:"gte=1,lte=20"`
+}
+
+// searchUsersHandler godoc
+//
+//	@Summary		Searches users
+//	@Description	Lists the active users whose username or display name is similar to q, or starts with it with autocomplete=true, the accounts followed by or following the user and the most followed ones first. Blocked accounts are left out.
+//	@Tags			users
+//	@Produce		json
+//	@Param			q				query		string	true	"Query, with or without the leading @"
+//	@Param			autocomplete	query		bool	false	"Only match the names starting with q, for mention pickers"
+//	@Param			limit			query		int		false	"Limit"
+//	@Success		200				{object}	[]store.UserSearchResult
+//	@Failure		400				{object}	Problem
+//	@Failure		401				{object}	Problem
+//	@Failure		500				{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/search/users [get]
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	q := UserSearchQuery{
+		Query: strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "@"),
+		Limit: 10,
+	}
+	if autocomplete := r.URL.Query().Get("autocomplete"); autocomplete != "" {
+		a, err := strconv.ParseBool(autocomplete)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		q.Autocomplete = a
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		q.Limit = l
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	results, err := app.store.Users.Search(r.Context(), store.UserSearchQuery{
+		ViewerID:     user.ID,
+		Query:        q.Query,
+		Autocomplete: q.Autocomplete,
+		Limit:        q.Limit,
+	})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
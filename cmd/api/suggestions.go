@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/igorzinar/goSocial/internal/store"
+	"net/http"
+	"strconv"
+)
+
+type SuggestionsQuery struct {
+	Limit int `json:"limit" validate:"gte=1,lte=50"`
+}
+
+// getSuggestionsHandler godoc
+//
+//	@Summary		Suggests accounts to follow
+//	@Description	Suggests the accounts followed by the ones the user follows, popular accounts and accounts posting in the tags the user posts or comments in, leaving out blocked accounts
+//	@Tags			users
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Success		200		{array}		store.Suggestion
+//	@Failure		400		{object}	Problem
+//	@Failure		401		{object}	Problem
+//	@Failure		500		{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/suggestions [get]
+func (app *application) getSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	q := SuggestionsQuery{Limit: 10}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		q.Limit = l
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	suggestions, err := app.store.Suggestions.List(r.Context(), user.ID, q.Limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, suggestions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// dismissSuggestionHandler godoc
+//
+//	@Summary		Dismisses a suggestion
+//	@Description	Stops suggesting an account to follow
+//	@Tags			users
+//	@Param			userID	path	int	true	"Suggested user ID"
+//	@Success		204
+//	@Failure		401	{object}	Problem
+//	@Failure		404	{object}	Problem
+//	@Failure		500	{object}	Problem
+//	@Security		ApiKeyAuth
+//	@Router			/users/me/suggestions/{userID} [delete]
+func (app *application) dismissSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	user := getAuthUser(r)
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r, err)
+		return
+	}
+
+	if err := app.store.Suggestions.Dismiss(r.Context(), user.ID, id); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
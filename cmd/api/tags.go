@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"github.com/igorzinar/goSocial/internal/richtext"
+	"github.com/igorzinar/goSocial/internal/store"
+	"net/http"
+	"strconv"
+)
+
+type TagSearchQuery struct {
+	Prefix string `json:"prefix" validate:"max=100"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=20"`
+}
+
+// searchTagsHandler godoc
+//
+//	@Summary		Autocompletes tags
+//	@Description	Lists the tags in use starting with a prefix, the most used first
+//	@Tags			tags
+//	@Produce		json
+//	@Param			prefix	query		string	false	"Prefix, with or without the leading #"
+//	@Param			limit	query		int		false	"Limit"
+//	@Success		200		{object}	[]store.Tag
+//	@Failure		400		{object}	Problem
+//	@Failure		500		{object}	Problem
+//	@Router			/tags [get]
+func (app *application) searchTagsHandler(w http.ResponseWriter, r *http.Request) {
+	q := TagSearchQuery{
+		Prefix: richtext.FoldTag(r.URL.Query().Get("prefix")),
+		Limit:  10,
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		q.Limit = l
+	}
+	if err := Validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tags, err := app.store.Tags.Search(r.Context(), q.Prefix, q.Limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getTagPostsHandler godoc
+//
+//	@Summary		Fetches the posts of a tag
+//	@Description	Fetches the posts tagged with a tag, the way the feed is paginated and filtered
+//	@Tags			tags
+//	@Produce		json
+//	@Param			tag		path		string	true	"Tag"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Param			tags	query		string	false	"Other tags the posts must have"
+//	@Param			search	query		string	false	"Search"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	Problem
+//	@Failure		404		{object}	Problem
+//	@Failure		500		{object}	Problem
+//	@Router			/tags/{tag}/posts [get]
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := richtext.NormalizeTag(chi.URLParam(r, "tag"))
+	if !ok {
+		app.notFoundResponse(w, r, errors.New("invalid tag"))
+		return
+	}
+
+	fq := store.PaginatedFeedQuery{
+		Limit:  20,
+		Offset: 0,
+		Sort:   "desc",
+	}
+	fq, err := fq.Parse(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(fq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	// folded rather than normalized, an invalid tag matches nothing
+	for i, t := range fq.Tags {
+		fq.Tags[i] = richtext.FoldTag(t)
+	}
+
+	ctx := r.Context()
+	tag, err := app.store.Tags.GetByName(ctx, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	posts, err := app.store.Posts.GetByTag(ctx, tag.Name, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+)
+
+type TrendingQuery struct {
+	Limit int `json:"limit" validate:"gte=1,lte=50"`
+}
+
+// parseTrendingQuery reads the limit of a trending request, 10 by default.
+func parseTrendingQuery(r *http.Request) (TrendingQuery, error) {
+	q := TrendingQuery{Limit: 10}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, err
+		}
+		q.Limit = l
+	}
+	return q, Validate.Struct(q)
+}
+
+// getTrendingTagsHandler godoc
+//
+//	@Summary		Fetches the trending tags
+//	@Description	Lists the tags of the posts with the most recent activity, as last computed by the trending job
+//	@Tags			trending
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Success		200		{object}	[]store.TrendingTag
+//	@Failure		400		{object}	Problem
+//	@Failure		500		{object}	Problem
+//	@Router			/trending/tags [get]
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseTrendingQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	tags, err := app.store.Trending.Tags(r.Context(), q.Limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getTrendingPostsHandler godoc
+//
+//	@Summary		Fetches the trending posts
+//	@Description	Lists the posts with the most recent activity, as last computed by the trending job
+//	@Tags			trending
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Success		200		{object}	[]store.TrendingPost
+//	@Failure		400		{object}	Problem
+//	@Failure		500		{object}	Problem
+//	@Router			/trending/posts [get]
+func (app *application) getTrendingPostsHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseTrendingQuery(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	posts, err := app.store.Trending.Posts(r.Context(), q.Limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -21,15 +21,15 @@ const userCtx userKey = "user"
 //	@Accept			json
 //	@Produce		json
 //	@Param			id	path		int	true	"User ID"
-//	@Success		200	{object}	store.User
-//	@Failure		400	{object}	error
-//	@Failure		404	{object}	error
-//	@Failure		500	{object}	error
+//	@Success		200	{object}	store.PublicUser
+//	@Failure		400	{object}	Problem
+//	@Failure		404	{object}	Problem
+//	@Failure		500	{object}	Problem
 //	@Security		ApiKeyAuth
 //	@Router			/users/{id} [get]
 func (app *application) getUserHandler(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromContext(r.Context())
-	if err := app.jsonResponse(w, http.StatusOK, user); err != nil {
+	if err := app.jsonResponse(w, http.StatusOK, user.Public()); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -49,8 +49,8 @@ type FollowUser struct {
 //	@Produce		json
 //	@Param			userID	path		int		true	"User ID"
 //	@Success		204		{string}	string	"User followed"
-//	@Failure		400		{object}	error	"User payload missing"
-//	@Failure		404		{object}	error	"User not found"
+//	@Failure		400		{object}	Problem	"User payload missing"
+//	@Failure		404		{object}	Problem	"User not found"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID}/follow [put]
 func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -66,7 +66,14 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 
 	ctx := r.Context()
 	if err := app.store.Followers.Follow(ctx, followerUser.ID, payload.UserID); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, store.ErrConflict):
+			app.conflictResponse(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
@@ -84,8 +91,8 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 //	@Produce		json
 //	@Param			userID	path		int		true	"User ID"
 //	@Success		204		{string}	string	"User unfollowed"
-//	@Failure		400		{object}	error	"User payload missing"
-//	@Failure		404		{object}	error	"User not found"
+//	@Failure		400		{object}	Problem	"User payload missing"
+//	@Failure		404		{object}	Problem	"User not found"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID}/unfollow [put]
 func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -125,8 +132,9 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 //	@Produce		json
 //	@Param			token	path		string	true	"Invitation token"
 //	@Success		204		{string}	string	"User activated"
-//	@Failure		404		{object}	error
-//	@Failure		500		{object}	error
+//	@Failure		404		{object}	Problem	"Unknown token"
+//	@Failure		410		{object}	Problem	"Expired token"
+//	@Failure		500		{object}	Problem
 //	@Security		ApiKeyAuth
 //	@Router			/users/activate/{token} [put]
 func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -137,6 +145,8 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		switch err {
 		case store.ErrNotFound:
 			app.notFoundResponse(w, r, err)
+		case store.ErrExpired:
+			app.goneResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
 
@@ -154,7 +164,7 @@ func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 		idParam := chi.URLParam(r, "userID")
 		id, err := strconv.ParseInt(idParam, 10, 64)
 		if err != nil {
-			app.internalServerError(w, r, err)
+			app.notFoundResponse(w, r, err)
 			return
 		}
 
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    level int NOT NULL DEFAULT 0,
+    description TEXT
+);
+
+INSERT INTO roles (name, description, level)
+VALUES ('user', 'A user can create posts and comments', 1),
+       ('moderator', 'A moderator can update other users posts', 2),
+       ('admin', 'An admin can update and delete other users posts', 3);
+
+ALTER TABLE users ADD COLUMN role_id INT REFERENCES roles (id) DEFAULT 1;
+
+UPDATE users SET role_id = (SELECT id FROM roles WHERE name = 'user');
+
+ALTER TABLE users ALTER COLUMN role_id SET NOT NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS email_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    template VARCHAR(255) NOT NULL,
+    username VARCHAR(255) NOT NULL,
+    email citext NOT NULL,
+    data jsonb NOT NULL DEFAULT '{}',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    sent_at timestamp(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_outbox_pending ON email_outbox (next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS users
+ADD COLUMN preferred_locale varchar(35) NOT NULL DEFAULT 'en';
@@ -0,0 +1,2 @@
+ALTER TABLE IF EXISTS user_invitations
+ADD COLUMN created_at timestamp(0) with time zone NOT NULL DEFAULT NOW();
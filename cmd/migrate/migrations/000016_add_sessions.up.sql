@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    token bytea PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expiry timestamp(0) WITH TIME ZONE NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS email_changes (
+    user_id BIGINT PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    new_email citext NOT NULL,
+    token bytea NOT NULL UNIQUE,
+    expiry timestamp(0) WITH TIME ZONE NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS username_history;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS display_name,
+    DROP COLUMN IF EXISTS bio,
+    DROP COLUMN IF EXISTS website,
+    DROP COLUMN IF EXISTS location,
+    DROP COLUMN IF EXISTS avatar_id,
+    DROP COLUMN IF EXISTS username_changed_at;
+
+DROP TABLE IF EXISTS media;
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS media (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    storage_key VARCHAR(255) NOT NULL UNIQUE,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_user_id ON media (user_id);
+
+ALTER TABLE users
+    ADD COLUMN display_name VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+    ADD COLUMN website VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN location VARCHAR(100) NOT NULL DEFAULT '',
+    ADD COLUMN avatar_id BIGINT REFERENCES media (id) ON DELETE SET NULL,
+    ADD COLUMN username_changed_at timestamp(0) WITH TIME ZONE;
+
+-- previous handles of a user, used to redirect old profile links
+CREATE TABLE IF NOT EXISTS username_history (
+    username VARCHAR(255) NOT NULL,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    changed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (username, user_id)
+);
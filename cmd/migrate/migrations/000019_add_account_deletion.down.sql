@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_at;
+
+ALTER TABLE IF EXISTS users
+DROP COLUMN IF EXISTS deletion_scheduled_at;
@@ -0,0 +1,4 @@
+ALTER TABLE IF EXISTS users
+ADD COLUMN deletion_scheduled_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_users_deletion_scheduled_at ON users (deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS data_exports (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    storage_key VARCHAR(255),
+    size BIGINT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    claimed_until timestamp(0) WITH TIME ZONE,
+    requested_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    completed_at timestamp(0) WITH TIME ZONE,
+    expires_at timestamp(0) WITH TIME ZONE
+);
+
+-- a user has at most one export being built
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_exports_in_progress ON data_exports (user_id) WHERE status IN ('pending', 'processing');
+CREATE INDEX IF NOT EXISTS idx_data_exports_user_id ON data_exports (user_id);
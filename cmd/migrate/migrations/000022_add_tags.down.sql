@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS post_mentions;
+DROP TABLE IF EXISTS post_tags;
+DROP FUNCTION IF EXISTS count_tag_posts;
+DROP TABLE IF EXISTS tags;
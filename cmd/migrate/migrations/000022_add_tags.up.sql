@@ -0,0 +1,55 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id BIGSERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE,
+    post_count BIGINT NOT NULL DEFAULT 0,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- the prefix searches of the autocomplete
+CREATE INDEX IF NOT EXISTS idx_tags_name_prefix ON tags (name varchar_pattern_ops);
+
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id BIGINT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    tag_id BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (post_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag_id ON post_tags (tag_id);
+
+-- post_count follows post_tags, including the rows removed with their post
+CREATE OR REPLACE FUNCTION count_tag_posts() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE tags SET post_count = post_count + 1 WHERE id = NEW.tag_id;
+    ELSE
+        UPDATE tags SET post_count = post_count - 1 WHERE id = OLD.tag_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER post_tags_count
+    AFTER INSERT OR DELETE ON post_tags
+    FOR EACH ROW EXECUTE FUNCTION count_tag_posts();
+
+CREATE TABLE IF NOT EXISTS post_mentions (
+    post_id BIGINT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_user_id ON post_mentions (user_id);
+
+-- tags used to be free-form, existing ones are lower-cased and linked
+UPDATE posts
+SET tags = ARRAY(SELECT DISTINCT lower(t) FROM unnest(tags) AS t WHERE t <> '')
+WHERE tags IS NOT NULL;
+
+INSERT INTO tags (name)
+SELECT DISTINCT unnest(tags) FROM posts
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO post_tags (post_id, tag_id)
+SELECT p.id, t.id FROM posts p JOIN tags t ON t.name = ANY (p.tags)
+ON CONFLICT DO NOTHING;
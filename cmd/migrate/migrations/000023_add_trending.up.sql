@@ -0,0 +1,18 @@
+-- snapshots written by the trending job, replaced as a whole on every run
+CREATE TABLE IF NOT EXISTS trending_tags (
+    tag_id BIGINT PRIMARY KEY REFERENCES tags (id) ON DELETE CASCADE,
+    rank INT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS trending_posts (
+    post_id BIGINT PRIMARY KEY REFERENCES posts (id) ON DELETE CASCADE,
+    rank INT NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    computed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- the windows of the computation
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at);
+CREATE INDEX IF NOT EXISTS idx_comments_created_at ON comments (created_at);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_followers_follower_id;
+DROP TABLE IF EXISTS follow_suggestion_dismissals;
+DROP TABLE IF EXISTS follow_suggestions;
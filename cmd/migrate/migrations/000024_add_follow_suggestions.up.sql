@@ -0,0 +1,20 @@
+-- suggestions precomputed for the users following many accounts, the others
+-- get theirs computed on request
+CREATE TABLE IF NOT EXISTS follow_suggestions (
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    suggested_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    reasons VARCHAR(50)[] NOT NULL,
+    computed_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, suggested_id)
+);
+
+CREATE TABLE IF NOT EXISTS follow_suggestion_dismissals (
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    suggested_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, suggested_id)
+);
+
+-- the friends of friends are found from the followed side
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS bookmark_collections (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+-- a bookmark outlives its collection, it is left without one
+CREATE TABLE IF NOT EXISTS bookmarks (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    post_id BIGINT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    collection_id BIGINT REFERENCES bookmark_collections (id) ON DELETE SET NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, post_id)
+);
+
+-- the bookmarks are paged newest first by id, in a collection or not
+CREATE INDEX IF NOT EXISTS idx_bookmarks_user_id ON bookmarks (user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_collection_id ON bookmarks (collection_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_bookmarks_post_id ON bookmarks (post_id);
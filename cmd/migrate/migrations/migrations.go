@@ -0,0 +1,9 @@
+package migrations
+
+import "embed"
+
+// FS holds every up/down SQL migration so binaries can migrate without the
+// external migrate CLI.
+//
+//go:embed *.sql
+var FS embed.FS
@@ -20,5 +20,5 @@ func main() {
 
 	seedStore := store.NewStorage(conn)
 
-	db.Seed(seedStore)
+	db.Seed(seedStore, conn)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"github.com/igorzinar/goSocial/internal/richtext"
 	"github.com/igorzinar/goSocial/internal/store"
 	"log"
 	"math/rand"
@@ -78,12 +79,12 @@ var contentsList = []string{
 }
 
 var tags = []string{
-	"coding", "programming", "web development", "API", "data structures",
-	"cloud computing", "app development", "JavaScript", "Git", "AI",
-	"code optimization", "React", "machine learning", "UI/UX", "responsive design",
-	"Docker", "clean code", "SEO", "portfolio", "SQL",
+	"coding", "programming", "web_development", "API", "data_structures",
+	"cloud_computing", "app_development", "JavaScript", "Git", "AI",
+	"code_optimization", "React", "machine_learning", "ux", "responsive_design",
+	"Docker", "clean_code", "SEO", "portfolio", "SQL",
 	"debugging", "Golang", "frontend", "backend", "databases",
-	"development tips", "tutorial", "best practices", "beginner", "advanced",
+	"development_tips", "tutorial", "best_practices", "beginner", "advanced",
 }
 
 var commentsList = []string{
@@ -124,7 +125,7 @@ func Seed(store store.Storage, db *sql.DB) {
 
 	posts := generatePosts(200, users)
 	for _, post := range posts {
-		if err := store.Posts.Create(ctx, post); err != nil {
+		if err := store.Posts.Create(ctx, post, nil); err != nil {
 			log.Fatal("Seed generatePosts ====> ", err)
 			return
 		}
@@ -160,10 +161,10 @@ func generatePosts(num int, users []*store.User) []*store.Post {
 			UserID:  user.ID,
 			Title:   titlesList[rand.Intn(len(titlesList))],
 			Content: contentsList[rand.Intn(len(contentsList))],
-			Tags: []string{
+			Tags: richtext.NormalizeTags([]string{
 				tags[rand.Intn(len(tags))],
 				tags[rand.Intn(len(tags))],
-			},
+			}),
 		}
 	}
 	return posts
@@ -0,0 +1,255 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sourceDefault = "default"
+	sourceFile    = "file"
+	sourceEnv     = "env"
+	redacted      = "<redacted>"
+)
+
+type entry struct {
+	value  string
+	source string
+	secret bool
+}
+
+// Loader resolves configuration keys from, in increasing priority, the
+// fallback value, a YAML file and environment variables. Nested YAML keys
+// map to environment names, so `db: {addr: x}` is read as DB_ADDR.
+//
+// Invalid or missing values are collected instead of silently falling back,
+// call Err once everything was loaded to get a consolidated report.
+type Loader struct {
+	file    map[string]string
+	entries map[string]entry
+	errs    []error
+}
+
+func NewLoader(path string) (*Loader, error) {
+	l := &Loader{
+		file:    map[string]string{},
+		entries: map[string]entry{},
+	}
+	if path == "" {
+		return l, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	var raw map[string]any
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	flatten("", raw, l.file)
+
+	return l, nil
+}
+
+func flatten(prefix string, raw map[string]any, out map[string]string) {
+	for k, v := range raw {
+		key := strings.ToUpper(k)
+		if prefix != "" {
+			key = prefix + "_" + key
+		}
+
+		switch val := v.(type) {
+		case map[string]any:
+			flatten(key, val, out)
+		case []any:
+			items := make([]string, len(val))
+			for i, item := range val {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+		default:
+			out[key] = fmt.Sprint(val)
+		}
+	}
+}
+
+func (l *Loader) lookup(key string) (string, string, bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		return value, sourceEnv, true
+	}
+	if value, ok := l.file[key]; ok {
+		return value, sourceFile, true
+	}
+	return "", sourceDefault, false
+}
+
+func (l *Loader) record(key, value, source string, secret bool) {
+	l.entries[key] = entry{value: value, source: source, secret: secret}
+}
+
+func (l *Loader) fail(key, format string, args ...any) {
+	l.errs = append(l.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (l *Loader) String(key, fallback string) string {
+	value, source, ok := l.lookup(key)
+	if !ok {
+		value = fallback
+	}
+	l.record(key, value, source, false)
+	return value
+}
+
+// Secret reads a sensitive value, either directly from key or from the file
+// named by key_FILE (e.g. a mounted docker secret). It is redacted in Dump.
+func (l *Loader) Secret(key, fallback string) string {
+	value, source, ok := l.lookup(key)
+	if !ok {
+		if path, fileSource, found := l.lookup(key + "_FILE"); found {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				l.fail(key, "reading secret file: %v", err)
+			}
+			value, source, ok = strings.TrimSpace(string(content)), fileSource, true
+		}
+	}
+	if !ok {
+		value = fallback
+	}
+	l.record(key, value, source, true)
+	return value
+}
+
+func (l *Loader) Int(key string, fallback int) int {
+	raw, source, ok := l.lookup(key)
+	if !ok {
+		l.record(key, strconv.Itoa(fallback), source, false)
+		return fallback
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		l.fail(key, "invalid integer %q", raw)
+		return fallback
+	}
+	l.record(key, raw, source, false)
+	return value
+}
+
+func (l *Loader) Bool(key string, fallback bool) bool {
+	raw, source, ok := l.lookup(key)
+	if !ok {
+		l.record(key, strconv.FormatBool(fallback), source, false)
+		return fallback
+	}
+
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		l.fail(key, "invalid boolean %q", raw)
+		return fallback
+	}
+	l.record(key, raw, source, false)
+	return value
+}
+
+func (l *Loader) Duration(key string, fallback time.Duration) time.Duration {
+	raw, source, ok := l.lookup(key)
+	if !ok {
+		l.record(key, fallback.String(), source, false)
+		return fallback
+	}
+
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		l.fail(key, "invalid duration %q", raw)
+		return fallback
+	}
+	l.record(key, raw, source, false)
+	return value
+}
+
+// List reads a comma separated value, or a YAML sequence in the config file.
+func (l *Loader) List(key string, fallback []string) []string {
+	raw, source, ok := l.lookup(key)
+	if !ok {
+		l.record(key, strings.Join(fallback, ","), source, false)
+		return fallback
+	}
+
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	l.record(key, raw, source, false)
+	return values
+}
+
+// Require reports an error if key resolved to an empty value.
+func (l *Loader) Require(keys ...string) {
+	for _, key := range keys {
+		if e, ok := l.entries[key]; !ok || e.value == "" {
+			l.fail(key, "is required")
+		}
+	}
+}
+
+// Check records a custom validation error for key when ok is false.
+func (l *Loader) Check(key string, ok bool, message string) {
+	if !ok {
+		l.fail(key, "%s", message)
+	}
+}
+
+// Err returns every validation error found while loading, or nil.
+func (l *Loader) Err() error {
+	if len(l.errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid configuration:\n%w", errors.Join(l.errs...))
+}
+
+// Dump writes the effective configuration with secrets redacted.
+func (l *Loader) Dump(w io.Writer) error {
+	keys := make([]string, 0, len(l.entries))
+	for k := range l.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		e := l.entries[k]
+		value := e.value
+		if e.secret && value != "" {
+			value = redacted
+		}
+		if _, err := fmt.Fprintf(w, "%-28s %-40s (%s)\n", k, value, e.source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Effective returns the resolved configuration with secrets redacted.
+func (l *Loader) Effective() map[string]string {
+	out := make(map[string]string, len(l.entries))
+	for k, e := range l.entries {
+		if e.secret && e.value != "" {
+			out[k] = redacted
+			continue
+		}
+		out[k] = e.value
+	}
+	return out
+}
@@ -0,0 +1,85 @@
+package exports
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/igorzinar/goSocial/internal/media"
+	"github.com/igorzinar/goSocial/internal/store"
+	"io"
+	"path"
+	"time"
+)
+
+// WriteArchive writes the data of a user as a ZIP: one JSON file per kind of
+// data plus the original uploads under media/.
+func WriteArchive(w io.Writer, data *store.UserData, files media.Storage) error {
+	zw := zip.NewWriter(w)
+
+	documents := []struct {
+		name  string
+		value any
+	}{
+		{"profile.json", data.Profile},
+		{"posts.json", orEmpty(data.Posts)},
+		{"comments.json", orEmpty(data.Comments)},
+		{"following.json", orEmpty(data.Following)},
+		{"followers.json", orEmpty(data.Followers)},
+		{"media.json", orEmpty(data.Media)},
+		{"sessions.json", orEmpty(data.Sessions)},
+		{"previous_usernames.json", orEmpty(data.Usernames)},
+	}
+	for _, doc := range documents {
+		if err := writeJSON(zw, doc.name, doc.value); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range data.Media {
+		if err := copyMedia(zw, files, m); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func writeJSON(zw *zip.Writer, name string, value any) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(value)
+}
+
+func copyMedia(zw *zip.Writer, files media.Storage, m store.Media) error {
+	src, err := files.Open(m.StorageKey)
+	if errors.Is(err, media.ErrNotFound) {
+		// the metadata in media.json is all that is left
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("media %d: %w", m.ID, err)
+	}
+	defer src.Close()
+
+	name := fmt.Sprintf("media/%d-%s%s", m.ID, m.Kind, path.Ext(m.StorageKey))
+	// uploads are already compressed images
+	dst, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: m.CreatedAt})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
+
+// orEmpty makes nil slices encode as [] instead of null.
+func orEmpty[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
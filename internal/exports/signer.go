@@ -0,0 +1,53 @@
+package exports
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Signer issues and checks time limited download links, so an archive can be
+// fetched from an email without being signed in.
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+func (s *Signer) sign(id int64, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	fmt.Fprintf(mac, "export:%d:%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// URL returns the download link of an export, valid until expires.
+func (s *Signer) URL(baseURL string, id int64, expires time.Time) string {
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("signature", s.sign(id, expires.Unix()))
+	return fmt.Sprintf("%s/v1/exports/%d/download?%s", baseURL, id, q.Encode())
+}
+
+// Verify checks the query of a download link. It reports whether the
+// signature is valid and, separately, whether the link expired.
+func (s *Signer) Verify(id int64, q url.Values, now time.Time) (valid, expired bool) {
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil {
+		return false, false
+	}
+	signature, err := hex.DecodeString(q.Get("signature"))
+	if err != nil {
+		return false, false
+	}
+	expected, _ := hex.DecodeString(s.sign(id, expires))
+	if !hmac.Equal(signature, expected) {
+		return false, false
+	}
+	return true, now.Unix() >= expires
+}
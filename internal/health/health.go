@@ -0,0 +1,126 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// CheckFunc probes a single dependency and returns an error if it is unhealthy.
+type CheckFunc func(ctx context.Context) error
+
+type checker struct {
+	name     string
+	critical bool
+	check    CheckFunc
+}
+
+type Component struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Latency  string `json:"latency"`
+	Error    string `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status     string               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+// Healthy reports whether every critical component is up. Non critical
+// components only degrade the report.
+func (r Report) Healthy() bool {
+	return r.Status != StatusDown
+}
+
+type Registry struct {
+	timeout  time.Duration
+	mu       sync.RWMutex
+	checkers []checker
+}
+
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Register adds a named check. A failing critical check marks the whole
+// report as down.
+func (r *Registry) Register(name string, critical bool, check CheckFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checkers = append(r.checkers, checker{name: name, critical: critical, check: check})
+}
+
+// Run executes all checks concurrently, each bounded by the registry timeout.
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checkers := make([]checker, len(r.checkers))
+	copy(checkers, r.checkers)
+	r.mu.RUnlock()
+
+	report := Report{
+		Status:     StatusUp,
+		Components: make(map[string]Component, len(checkers)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for _, c := range checkers {
+		wg.Add(1)
+		go func(c checker) {
+			defer wg.Done()
+			component := r.run(ctx, c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[c.name] = component
+			if component.Status == StatusDown {
+				if c.critical {
+					report.Status = StatusDown
+				} else if report.Status == StatusUp {
+					report.Status = StatusDegraded
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func (r *Registry) run(ctx context.Context, c checker) Component {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- c.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	component := Component{
+		Status:   StatusUp,
+		Critical: c.critical,
+		Latency:  time.Since(start).String(),
+	}
+	if err != nil {
+		component.Status = StatusDown
+		component.Error = err.Error()
+	}
+	return component
+}
@@ -0,0 +1,131 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/de"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/language"
+	"path"
+	"reflect"
+	"strings"
+)
+
+//go:embed locales/*.json
+var FS embed.FS
+
+// DefaultLocale is used when nothing better matches and for messages
+// missing from a catalog.
+var DefaultLocale = language.English
+
+// translators lists the locales with plural and formatting rules, a catalog
+// file locales/<locale>.json must exist for each of them.
+var translators = []locales.Translator{en.New(), de.New(), es.New()}
+
+// Catalog holds the messages of every supported locale.
+type Catalog struct {
+	uni     *ut.UniversalTranslator
+	keys    map[string]bool
+	tags    []language.Tag
+	matcher language.Matcher
+}
+
+// Load reads the embedded message catalogs.
+func Load() (*Catalog, error) {
+	uni := ut.New(translators[0], translators...)
+	c := &Catalog{uni: uni, keys: map[string]bool{}}
+
+	for _, t := range translators {
+		locale := t.Locale()
+		raw, err := FS.ReadFile(path.Join("locales", locale+".json"))
+		if err != nil {
+			return nil, fmt.Errorf("loading %s catalog: %w", locale, err)
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			return nil, fmt.Errorf("parsing %s catalog: %w", locale, err)
+		}
+
+		trans, _ := uni.GetTranslator(locale)
+		for key, text := range messages {
+			if err := trans.Add(key, text, false); err != nil {
+				return nil, fmt.Errorf("%s catalog, %s: %w", locale, key, err)
+			}
+			c.keys[key] = true
+		}
+		if err := trans.VerifyTranslations(); err != nil {
+			return nil, err
+		}
+
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return nil, err
+		}
+		c.tags = append(c.tags, tag)
+	}
+	c.matcher = language.NewMatcher(c.tags)
+
+	return c, nil
+}
+
+// Negotiate picks the best supported locale for an Accept-Language header.
+func (c *Catalog) Negotiate(acceptLanguage string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return DefaultLocale
+	}
+	_, idx, confidence := c.matcher.Match(tags...)
+	if confidence == language.No {
+		return DefaultLocale
+	}
+	return c.tags[idx]
+}
+
+// T returns the message for key in locale, falling back to the default
+// locale and then to the key itself. Params replace {0}, {1}... and must
+// cover every placeholder of the message.
+func (c *Catalog) T(locale language.Tag, key string, params ...string) string {
+	for _, tag := range []language.Tag{locale, DefaultLocale} {
+		base, _ := tag.Base()
+		trans, found := c.uni.GetTranslator(base.String())
+		if !found {
+			continue
+		}
+		if msg, err := trans.T(key, params...); err == nil {
+			return msg
+		}
+	}
+	return key
+}
+
+// Has reports whether key exists in any catalog.
+func (c *Catalog) Has(key string) bool {
+	return c.keys[key]
+}
+
+// ValidationMessage translates a validator error. Messages are looked up as
+// validation.<tag>.<kind> (e.g. validation.max.string), then
+// validation.<tag> and finally validation.default.
+func (c *Catalog) ValidationMessage(locale language.Tag, fe validator.FieldError) string {
+	params := []string{fe.Field(), strings.ReplaceAll(fe.Param(), " ", ", ")}
+
+	keys := []string{"validation." + fe.Tag(), "validation.default"}
+	switch fe.Kind() {
+	case reflect.String:
+		keys = append([]string{"validation." + fe.Tag() + ".string"}, keys...)
+	case reflect.Slice, reflect.Array, reflect.Map:
+		keys = append([]string{"validation." + fe.Tag() + ".slice"}, keys...)
+	}
+
+	for _, key := range keys {
+		if c.Has(key) {
+			return c.T(locale, key, params...)
+		}
+	}
+	return fe.Error()
+}
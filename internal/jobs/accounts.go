@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"github.com/igorzinar/goSocial/internal/media"
+	"github.com/igorzinar/goSocial/internal/store"
+	"go.uber.org/zap"
+	"time"
+)
+
+// PurgeUnactivated deletes the accounts that were never activated once their
+// invitation expired more than grace ago, releasing their username and email.
+func PurgeUnactivated(storage store.Storage, grace time.Duration, logger *zap.SugaredLogger) func(context.Context) error {
+	return func(ctx context.Context) error {
+		count, err := storage.Users.DeleteUnactivated(ctx, time.Now().Add(-grace))
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			logger.Infow("purged unactivated accounts", "count", count)
+		}
+		return nil
+	}
+}
+
+// erasureBatch bounds the accounts erased per run.
+const erasureBatch = 50
+
+// EraseDeleted erases the accounts whose requested deletion passed its grace
+// period. Each account is removed in its own transaction, uploaded files are
+// deleted once it committed.
+func EraseDeleted(storage store.Storage, files media.Storage, logger *zap.SugaredLogger) func(context.Context) error {
+	return func(ctx context.Context) error {
+		ids, err := storage.Users.DueForErasure(ctx, erasureBatch)
+		if err != nil {
+			return err
+		}
+
+		var errs []error
+		for _, id := range ids {
+			keys, err := storage.Users.Erase(ctx, id)
+			switch {
+			case errors.Is(err, store.ErrNotFound):
+				// cancelled or erased by another instance
+				continue
+			case err != nil:
+				errs = append(errs, err)
+				continue
+			}
+
+			for _, key := range keys {
+				if err := files.Delete(key); err != nil {
+					logger.Warnw("deleting media of erased account", "user_id", id, "key", key, "error", err)
+				}
+			}
+			logger.Infow("erased account", "user_id", id, "media", len(keys))
+		}
+		return errors.Join(errs...)
+	}
+}
@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/igorzinar/goSocial/internal/exports"
+	"github.com/igorzinar/goSocial/internal/mailer"
+	"github.com/igorzinar/goSocial/internal/media"
+	"github.com/igorzinar/goSocial/internal/store"
+	"go.uber.org/zap"
+	"io"
+	"time"
+)
+
+type ExportConfig struct {
+	// TTL is how long an archive can be downloaded.
+	TTL time.Duration
+	// Lease is how long a claimed export stays locked before another
+	// instance may build it.
+	Lease       time.Duration
+	MaxAttempts int
+	// BaseURL of the API, download links point to it.
+	BaseURL   string
+	Signer    *exports.Signer
+	Templates *mailer.Templates
+}
+
+// exportBatch bounds the exports built or expired per run.
+const exportBatch = 10
+
+// BuildExports builds the pending data exports and emails their download
+// link to the user.
+func BuildExports(cfg ExportConfig, storage store.Storage, files media.Storage, logger *zap.SugaredLogger) func(context.Context) error {
+	return func(ctx context.Context) error {
+		for i := 0; i < exportBatch; i++ {
+			export, err := storage.Exports.Claim(ctx, cfg.Lease)
+			if errors.Is(err, store.ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := buildExport(ctx, cfg, storage, files, export); err != nil {
+				dead := export.Attempts >= cfg.MaxAttempts
+				logger.Errorw("building data export", "export_id", export.ID, "user_id", export.UserID, "attempt", export.Attempts, "dead", dead, "error", err)
+				if err := storage.Exports.Fail(ctx, export.ID, err.Error(), dead); err != nil {
+					return err
+				}
+				continue
+			}
+			logger.Infow("data export ready", "export_id", export.ID, "user_id", export.UserID, "size", export.Size)
+		}
+		return nil
+	}
+}
+
+func buildExport(ctx context.Context, cfg ExportConfig, storage store.Storage, files media.Storage, export *store.DataExport) error {
+	data, err := storage.Exports.Collect(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+
+	export.StorageKey = fmt.Sprintf("exports/%d/%d-%s.zip", export.UserID, export.ID, uuid.New().String())
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(exports.WriteArchive(pw, data, files))
+	}()
+	export.Size, err = files.Put(export.StorageKey, pr)
+	pr.Close()
+	if err != nil {
+		files.Delete(export.StorageKey)
+		return err
+	}
+
+	expiresAt := time.Now().Add(cfg.TTL)
+	export.ExpiresAt = &expiresAt
+
+	user := data.Profile
+	vars := struct {
+		Username    string
+		DownloadURL string
+		ExpiresAt   string
+	}{
+		Username:    user.Username,
+		DownloadURL: cfg.Signer.URL(cfg.BaseURL, export.ID, expiresAt),
+		ExpiresAt:   expiresAt.UTC().Format("2006-01-02 15:04 MST"),
+	}
+	email, err := store.NewOutboxEmail(cfg.Templates.Localized(mailer.DataExportReadyTemplate, user.PreferredLocale), user.Username, user.Email, vars)
+	if err != nil {
+		files.Delete(export.StorageKey)
+		return err
+	}
+
+	if err := storage.Exports.Complete(ctx, export, email); err != nil {
+		files.Delete(export.StorageKey)
+		return err
+	}
+	return nil
+}
+
+// ExpireExports deletes the archives past their expiry.
+func ExpireExports(storage store.Storage, files media.Storage, logger *zap.SugaredLogger) func(context.Context) error {
+	return func(ctx context.Context) error {
+		expired, err := storage.Exports.Expire(ctx, exportBatch)
+		if err != nil {
+			return err
+		}
+		for _, export := range expired {
+			if err := files.Delete(export.StorageKey); err != nil {
+				logger.Warnw("deleting expired data export", "export_id", export.ID, "key", export.StorageKey, "error", err)
+				continue
+			}
+			logger.Infow("data export expired", "export_id", export.ID, "user_id", export.UserID)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,21 @@
+package jobs
+
+import (
+	"context"
+	"github.com/igorzinar/goSocial/internal/store"
+	"go.uber.org/zap"
+)
+
+// PurgeIdempotencyKeys deletes the idempotency keys past their retention.
+func PurgeIdempotencyKeys(storage store.Storage, logger *zap.SugaredLogger) func(context.Context) error {
+	return func(ctx context.Context) error {
+		count, err := storage.Idempotency.DeleteExpired(ctx)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			logger.Infow("purged expired idempotency keys", "count", count)
+		}
+		return nil
+	}
+}
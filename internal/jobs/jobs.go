@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"context"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// Job is a background task run periodically. Jobs must be safe to run from
+// several API instances at once.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(context.Context) error
+}
+
+// Scheduler runs each registered job on its own ticker.
+type Scheduler struct {
+	logger *zap.SugaredLogger
+	jobs   []Job
+}
+
+func NewScheduler(logger *zap.SugaredLogger) *Scheduler {
+	return &Scheduler{logger: logger.With("component", "jobs")}
+}
+
+func (s *Scheduler) Register(job Job) {
+	s.jobs = append(s.jobs, job)
+}
+
+// Run starts every job and blocks until ctx is cancelled and the running
+// jobs returned.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	logger := s.logger.With("job", job.Name)
+	logger.Infow("job scheduled", "interval", job.Interval)
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		start := time.Now()
+		if err := job.Run(ctx); err != nil {
+			logger.Errorw("job failed", "error", err, "latency", time.Since(start))
+		} else {
+			logger.Debugw("job completed", "latency", time.Since(start))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"context"
+	"github.com/igorzinar/goSocial/internal/store"
+	"go.uber.org/zap"
+	"time"
+)
+
+// PurgeSentEmails deletes the outbox emails sent more than retention ago.
+func PurgeSentEmails(storage store.Storage, retention time.Duration, logger *zap.SugaredLogger) func(context.Context) error {
+	return func(ctx context.Context) error {
+		count, err := storage.Outbox.DeleteSent(ctx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			logger.Infow("purged sent emails", "count", count)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"context"
+	"github.com/igorzinar/goSocial/internal/store"
+	"go.uber.org/zap"
+)
+
+// PrecomputeSuggestions refreshes the follow suggestions of the users
+// following at least minFollowing accounts, keeping size of them.
+func PrecomputeSuggestions(storage store.Storage, minFollowing, size int, logger *zap.SugaredLogger) func(context.Context) error {
+	return func(ctx context.Context) error {
+		count, err := storage.Suggestions.Precompute(ctx, minFollowing, size)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			logger.Infow("precomputed follow suggestions", "users", count)
+		}
+		return nil
+	}
+}
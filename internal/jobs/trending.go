@@ -0,0 +1,20 @@
+package jobs
+
+import (
+	"context"
+	"github.com/igorzinar/goSocial/internal/store"
+	"go.uber.org/zap"
+	"time"
+)
+
+// ComputeTrending refreshes the snapshot of the trending tags and posts.
+func ComputeTrending(storage store.Storage, params store.TrendingParams, logger *zap.SugaredLogger) func(context.Context) error {
+	return func(ctx context.Context) error {
+		start := time.Now()
+		if err := storage.Trending.Compute(ctx, params); err != nil {
+			return err
+		}
+		logger.Debugw("computed trending", "duration", time.Since(start))
+		return nil
+	}
+}
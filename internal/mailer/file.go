@@ -0,0 +1,97 @@
+package mailer
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FileMailer writes every message as an .eml file to dir instead of sending
+// it, for local development without network access or API keys.
+type FileMailer struct {
+	templates *Templates
+	fromEmail string
+	dir       string
+}
+
+func NewFileMailer(templates *Templates, dir, fromEmail string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileMailer{templates: templates, fromEmail: fromEmail, dir: dir}, nil
+}
+
+func (m *FileMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+	msg, err := newMessage(m.templates, templateFile, m.fromEmail, username, email, data)
+	if err != nil {
+		return err
+	}
+
+	raw, err := encodeMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", msg.SentAt.Format("20060102T150405.000000000"), sanitizeFilename(email))
+	return os.WriteFile(filepath.Join(m.dir, name), raw, 0o644)
+}
+
+// Messages returns the stored messages, newest first.
+func (m *FileMailer) Messages() ([]Message, error) {
+	paths, err := filepath.Glob(filepath.Join(m.dir, "*.eml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+
+	messages := make([]Message, 0, len(paths))
+	for _, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		msg, err := decodeMessage(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
+
+// newMessage renders templateFile into a Message addressed to email.
+func newMessage(templates *Templates, templateFile, fromEmail, username, email string, data any) (Message, error) {
+	content, err := templates.Render(templateFile, data)
+	if err != nil {
+		return Message{}, err
+	}
+
+	from := mail.Address{Name: FromName, Address: fromEmail}
+	to := mail.Address{Name: username, Address: email}
+	return Message{
+		ID:       messageID(fromEmail),
+		Template: templateFile,
+		From:     from.String(),
+		To:       to.String(),
+		Subject:  content.Subject,
+		HTML:     content.HTML,
+		Text:     content.Text,
+		SentAt:   time.Now(),
+		Data:     data,
+	}, nil
+}
@@ -3,9 +3,12 @@ package mailer
 import "embed"
 
 const (
-	FromName            = "GopherSocial"
-	maxRetry            = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName                   = "GopherSocial"
+	UserWelcomeTemplate        = "user_invitation.tmpl"
+	EmailChangeConfirmTemplate = "email_change_confirm.tmpl"
+	EmailChangeNoticeTemplate  = "email_change_notice.tmpl"
+	DataExportReadyTemplate    = "data_export_ready.tmpl"
+	PostMentionTemplate        = "post_mention.tmpl"
 )
 
 //go:embed "templates"
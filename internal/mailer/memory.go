@@ -0,0 +1,104 @@
+package mailer
+
+import (
+	"net/mail"
+	"strings"
+	"sync"
+)
+
+// MemoryMailer records rendered messages instead of sending them. It is
+// meant for tests and is safe for concurrent use.
+type MemoryMailer struct {
+	templates *Templates
+	fromEmail string
+	// Err, when set, is returned by Send without recording the message.
+	Err error
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewMemoryMailer(templates *Templates, fromEmail string) *MemoryMailer {
+	return &MemoryMailer{templates: templates, fromEmail: fromEmail}
+}
+
+func (m *MemoryMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Err != nil {
+		return m.Err
+	}
+
+	msg, err := newMessage(m.templates, templateFile, m.fromEmail, username, email, data)
+	if err != nil {
+		return err
+	}
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+// Messages returns the recorded messages, newest first.
+func (m *MemoryMailer) Messages() ([]Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := make([]Message, len(m.messages))
+	for i, msg := range m.messages {
+		messages[len(m.messages)-1-i] = msg
+	}
+	return messages, nil
+}
+
+// Count returns how many messages were recorded.
+func (m *MemoryMailer) Count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.messages)
+}
+
+// Last returns the most recent message, false if nothing was sent.
+func (m *MemoryMailer) Last() (Message, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.messages) == 0 {
+		return Message{}, false
+	}
+	return m.messages[len(m.messages)-1], true
+}
+
+// SentTo returns the messages sent to email, oldest first.
+func (m *MemoryMailer) SentTo(email string) []Message {
+	return m.filter(func(msg Message) bool {
+		addr, err := mail.ParseAddress(msg.To)
+		return err == nil && strings.EqualFold(addr.Address, email)
+	})
+}
+
+// WithTemplate returns the messages rendered from templateFile, oldest first.
+func (m *MemoryMailer) WithTemplate(templateFile string) []Message {
+	return m.filter(func(msg Message) bool {
+		return msg.Template == templateFile
+	})
+}
+
+// Reset forgets every recorded message.
+func (m *MemoryMailer) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = nil
+}
+
+func (m *MemoryMailer) filter(match func(Message) bool) []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out []Message
+	for _, msg := range m.messages {
+		if match(msg) {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
@@ -0,0 +1,190 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// Message is a rendered email as recorded by the development mailers.
+type Message struct {
+	ID       string    `json:"id"`
+	Template string    `json:"template,omitempty"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Subject  string    `json:"subject"`
+	HTML     string    `json:"html"`
+	Text     string    `json:"text"`
+	SentAt   time.Time `json:"sent_at"`
+	Data     any       `json:"-"`
+}
+
+// Mailbox is implemented by mailers that keep what they sent, so it can be
+// browsed in development.
+type Mailbox interface {
+	Messages() ([]Message, error)
+}
+
+// headerOrder keeps the encoded header stable and readable.
+var headerOrder = []string{"Message-Id", "Date", "From", "To", "Subject", "X-Template", "Mime-Version", "Content-Type", "Content-Transfer-Encoding"}
+
+// buildMessage encodes a multipart/alternative message with a plaintext and
+// an HTML part, or a single HTML part when text is empty.
+func buildMessage(from, to mail.Address, subject, html, text string) ([]byte, error) {
+	return encodeMessage(Message{
+		ID:      messageID(from.Address),
+		From:    from.String(),
+		To:      to.String(),
+		Subject: subject,
+		HTML:    html,
+		Text:    text,
+		SentAt:  time.Now(),
+	})
+}
+
+func encodeMessage(msg Message) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	header := textproto.MIMEHeader{}
+	header.Set("Message-ID", msg.ID)
+	header.Set("Date", msg.SentAt.Format(time.RFC1123Z))
+	header.Set("From", msg.From)
+	header.Set("To", msg.To)
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	if msg.Template != "" {
+		header.Set("X-Template", msg.Template)
+	}
+	header.Set("MIME-Version", "1.0")
+
+	if msg.Text == "" {
+		header.Set("Content-Type", "text/html; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "quoted-printable")
+		writeHeader(buf, header)
+		if err := writeQuotedPrintable(buf, msg.HTML); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(buf)
+	header.Set("Content-Type", "multipart/alternative; boundary="+mw.Boundary())
+	writeHeader(buf, header)
+
+	// the preferred alternative goes last
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeMessage parses a message produced by encodeMessage.
+func decodeMessage(raw []byte) (Message, error) {
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return Message{}, err
+	}
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		return Message{}, err
+	}
+	sentAt, _ := m.Header.Date()
+
+	msg := Message{
+		ID:       m.Header.Get("Message-Id"),
+		Template: m.Header.Get("X-Template"),
+		From:     m.Header.Get("From"),
+		To:       m.Header.Get("To"),
+		Subject:  subject,
+		SentAt:   sentAt,
+	}
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		return Message{}, err
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		body, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+		if err != nil {
+			return Message{}, err
+		}
+		msg.HTML = string(body)
+		return msg, nil
+	}
+
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Message{}, err
+		}
+		// NextPart already decodes quoted-printable bodies
+		body, err := io.ReadAll(part)
+		if err != nil {
+			return Message{}, err
+		}
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/plain") {
+			msg.Text = string(body)
+		} else {
+			msg.HTML = string(body)
+		}
+	}
+
+	return msg, nil
+}
+
+func writeHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for _, k := range headerOrder {
+		if v := header.Get(k); v != "" {
+			fmt.Fprintf(buf, "%s: %s\r\n", k, v)
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func messageID(from string) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(b), domain)
+}
@@ -1,27 +1,29 @@
 package mailer
 
 import (
-	"bytes"
 	"fmt"
 	"github.com/sendgrid/sendgrid-go"
 	"github.com/sendgrid/sendgrid-go/helpers/mail"
-	"html/template"
-	"time"
+	"go.uber.org/zap"
 )
 
 type SendGridMailer struct {
+	templates *Templates
 	fromEmail string
 	apiKey    string
 	client    *sendgrid.Client
+	logger    *zap.SugaredLogger
 }
 
-func NewSendGridMailer(apiKey, fromEmail string) *SendGridMailer {
+func NewSendGridMailer(templates *Templates, apiKey, fromEmail string, logger *zap.SugaredLogger) *SendGridMailer {
 	client := sendgrid.NewSendClient(apiKey)
 
 	return &SendGridMailer{
+		templates: templates,
 		fromEmail: fromEmail,
 		apiKey:    apiKey,
 		client:    client,
+		logger:    logger,
 	}
 }
 
@@ -29,23 +31,11 @@ func (m *SendGridMailer) Send(templateFile, username, email string, data any, is
 
 	from := mail.NewEmail(FromName, m.fromEmail)
 	to := mail.NewEmail(username, email)
-	// parse template
-	tmpl, err := template.ParseFS(FS, "templates/"+templateFile)
+	content, err := m.templates.Render(templateFile, data)
 	if err != nil {
 		return err
 	}
-
-	subject := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(subject, "subject", data)
-	if err != nil {
-		return err
-	}
-	body := new(bytes.Buffer)
-	err = tmpl.ExecuteTemplate(body, "body", data)
-	if err != nil {
-		return err
-	}
-	message := mail.NewSingleEmail(from, subject.String(), to, "", body.String())
+	message := mail.NewSingleEmail(from, content.Subject, to, content.Text, content.HTML)
 
 	message.SetMailSettings(&mail.MailSettings{
 		SandboxMode: &mail.Setting{
@@ -53,19 +43,14 @@ func (m *SendGridMailer) Send(templateFile, username, email string, data any, is
 		},
 	})
 
-	for i := 0; i < maxRetry; i++ {
-		response, err := m.client.Send(message)
-		if err != nil {
-			fmt.Printf("Failed to send email %v, attempt %d of %d", email, i+1, maxRetry)
-			fmt.Printf("Error : %v", err.Error())
-
-			// exponential backoff
-			time.Sleep(time.Second * time.Duration(i+1))
-			continue
-		}
-		fmt.Printf("Email sent with status code %v", response.StatusCode)
-		return nil
+	// a single attempt, the outbox retries with its own backoff
+	response, err := m.client.Send(message)
+	if err != nil {
+		return err
 	}
-
-	return fmt.Errorf("failed to send email after %v attempts", maxRetry)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("sendgrid answered %d: %s", response.StatusCode, response.Body)
+	}
+	m.logger.Infow("email sent", "email", email, "status_code", response.StatusCode)
+	return nil
 }
@@ -0,0 +1,234 @@
+package mailer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	SMTPSecurityNone     = "none"
+	SMTPSecurityStartTLS = "starttls"
+	SMTPSecurityTLS      = "tls"
+
+	SMTPAuthNone  = "none"
+	SMTPAuthPlain = "plain"
+	SMTPAuthLogin = "login"
+)
+
+type SMTPConfig struct {
+	Host      string
+	Port      int
+	Username  string
+	Password  string
+	FromEmail string
+	// Security is one of none, starttls or tls (implicit TLS, usually port 465).
+	Security string
+	// Auth is one of none, plain or login.
+	Auth    string
+	Timeout time.Duration
+}
+
+// SMTPMailer sends through an SMTP relay. The connection is kept open and
+// reused between messages, and re-dialed when the server dropped it.
+type SMTPMailer struct {
+	cfg       SMTPConfig
+	templates *Templates
+	logger    *zap.SugaredLogger
+
+	mu     sync.Mutex
+	client *smtp.Client
+}
+
+func NewSMTPMailer(templates *Templates, cfg SMTPConfig, logger *zap.SugaredLogger) (*SMTPMailer, error) {
+	switch cfg.Security {
+	case SMTPSecurityNone, SMTPSecurityStartTLS, SMTPSecurityTLS:
+	default:
+		return nil, fmt.Errorf("unknown smtp security %q", cfg.Security)
+	}
+	switch cfg.Auth {
+	case SMTPAuthNone, SMTPAuthPlain, SMTPAuthLogin:
+	default:
+		return nil, fmt.Errorf("unknown smtp auth %q", cfg.Auth)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &SMTPMailer{cfg: cfg, templates: templates, logger: logger}, nil
+}
+
+// Send renders the template and delivers it. isSandbox is ignored, point the
+// mailer to a local catcher such as MailHog instead.
+func (m *SMTPMailer) Send(templateFile, username, email string, data any, isSandbox bool) error {
+	content, err := m.templates.Render(templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	from := mail.Address{Name: FromName, Address: m.cfg.FromEmail}
+	to := mail.Address{Name: username, Address: email}
+	msg, err := buildMessage(from, to, content.Subject, content.HTML, content.Text)
+	if err != nil {
+		return err
+	}
+
+	// a single attempt, the outbox retries with its own backoff
+	if err := m.deliver(from.Address, to.Address, msg); err != nil {
+		return err
+	}
+	m.logger.Infow("email sent", "email", email, "host", m.cfg.Host)
+	return nil
+}
+
+// Close ends the reused SMTP session.
+func (m *SMTPMailer) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.client == nil {
+		return nil
+	}
+	err := m.client.Quit()
+	m.client = nil
+	return err
+}
+
+func (m *SMTPMailer) deliver(from, to string, msg []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, err := m.conn()
+	if err != nil {
+		return err
+	}
+
+	err = send(c, from, to, msg)
+	if err != nil {
+		// drop the session, the next attempt dials a fresh one
+		c.Close()
+		m.client = nil
+	}
+	return err
+}
+
+func send(c *smtp.Client, from, to string, msg []byte) error {
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// conn returns the open session if the server still answers, dialing a new
+// one otherwise. Must be called with m.mu held.
+func (m *SMTPMailer) conn() (*smtp.Client, error) {
+	if m.client != nil {
+		if err := m.client.Reset(); err == nil {
+			return m.client, nil
+		}
+		m.client.Close()
+		m.client = nil
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+	dialer := &net.Dialer{Timeout: m.cfg.Timeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if m.cfg.Security == SMTPSecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if m.cfg.Security == SMTPSecurityStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			c.Close()
+			return nil, errors.New("smtp server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if auth := m.auth(); auth != nil {
+		if err := c.Auth(auth); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	m.client = c
+	return c, nil
+}
+
+func (m *SMTPMailer) auth() smtp.Auth {
+	switch m.cfg.Auth {
+	case SMTPAuthPlain:
+		return smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	case SMTPAuthLogin:
+		return &loginAuth{username: m.cfg.Username, password: m.cfg.Password, host: m.cfg.Host}
+	default:
+		return nil
+	}
+}
+
+// loginAuth implements the non standard but widely deployed LOGIN mechanism
+// which net/smtp does not ship.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	// same rule as smtp.PlainAuth: never send credentials in clear text to a
+	// remote host
+	if !server.TLS && a.host != "localhost" && a.host != "127.0.0.1" && a.host != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch string(bytes.ToLower(bytes.TrimSpace(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+	}
+}
@@ -0,0 +1,234 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	templatesDir = "templates"
+	layoutsGlob  = "templates/layouts/*.tmpl"
+)
+
+// Templates holds every email template parsed once at startup.
+//
+// A template file defines a "subject" and an "html" block, an optional
+// "text" block (generated from the HTML when missing) and a "sample" block
+// with JSON sample data. Every key of the sample is a required variable and
+// the sample is what the preview command renders. The HTML is wrapped in the
+// "layout" block of templates/layouts/base.tmpl, whose "signature" block can
+// be overridden (e.g. by translations).
+//
+// Translations live next to the default template as <name>.<locale>.tmpl,
+// see Localized.
+type Templates struct {
+	entries map[string]*emailTemplate
+}
+
+type emailTemplate struct {
+	html     *htmltemplate.Template
+	text     *texttemplate.Template
+	hasText  bool
+	required []string
+	sample   map[string]any
+}
+
+// Rendered is the output of a template for a given data.
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// ParseTemplates parses and validates every template embedded in FS.
+func ParseTemplates() (*Templates, error) {
+	return parseTemplates(FS)
+}
+
+func parseTemplates(fsys fs.FS) (*Templates, error) {
+	names, err := fs.Glob(fsys, templatesDir+"/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Templates{entries: map[string]*emailTemplate{}}
+	var errs []error
+	for _, file := range names {
+		name := path.Base(file)
+		entry, err := parseTemplate(fsys, file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		t.entries[name] = entry
+
+		// render the sample so broken templates fail at startup instead of
+		// on the first send
+		if _, err := t.Render(name, entry.sample); err != nil {
+			errs = append(errs, fmt.Errorf("%s: rendering sample: %w", name, err))
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func parseTemplate(fsys fs.FS, file string) (*emailTemplate, error) {
+	html, err := htmltemplate.New(path.Base(file)).ParseFS(fsys, layoutsGlob, file)
+	if err != nil {
+		return nil, err
+	}
+	// subject and text are not HTML, they must not be escaped
+	text, err := texttemplate.New(path.Base(file)).ParseFS(fsys, file)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, block := range []string{"subject", "html", "sample"} {
+		if text.Lookup(block) == nil {
+			return nil, fmt.Errorf("missing %q block", block)
+		}
+	}
+	if html.Lookup("layout") == nil {
+		return nil, errors.New(`missing "layout" block in layouts`)
+	}
+
+	raw := new(bytes.Buffer)
+	if err := text.ExecuteTemplate(raw, "sample", nil); err != nil {
+		return nil, err
+	}
+	var sample map[string]any
+	if err := json.Unmarshal(raw.Bytes(), &sample); err != nil {
+		return nil, fmt.Errorf("invalid sample: %w", err)
+	}
+
+	required := make([]string, 0, len(sample))
+	for k := range sample {
+		required = append(required, k)
+	}
+	sort.Strings(required)
+
+	return &emailTemplate{
+		html:     html,
+		text:     text,
+		hasText:  text.Lookup("text") != nil,
+		required: required,
+		sample:   sample,
+	}, nil
+}
+
+// Names returns the available template names.
+func (t *Templates) Names() []string {
+	names := make([]string, 0, len(t.entries))
+	for name := range t.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Localized returns the variant of name for locale, trying the full tag
+// then its base language (user_invitation.de-AT.tmpl, user_invitation.de.tmpl)
+// and falling back to name itself.
+func (t *Templates) Localized(name, locale string) string {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+
+	for locale != "" {
+		candidate := stem + "." + locale + ext
+		if _, ok := t.entries[candidate]; ok {
+			return candidate
+		}
+		i := strings.LastIndexAny(locale, "-_")
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return name
+}
+
+// Sample returns the sample data of a template.
+func (t *Templates) Sample(name string) (map[string]any, error) {
+	entry, ok := t.entries[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+	return entry.sample, nil
+}
+
+// Render executes a template after checking data provides every required
+// variable.
+func (t *Templates) Render(name string, data any) (Rendered, error) {
+	entry, ok := t.entries[name]
+	if !ok {
+		return Rendered{}, fmt.Errorf("unknown email template %q", name)
+	}
+	if missing := missingVars(entry.required, data); len(missing) > 0 {
+		return Rendered{}, fmt.Errorf("email template %s: missing variables %s", name, strings.Join(missing, ", "))
+	}
+
+	buf := new(bytes.Buffer)
+	if err := entry.text.ExecuteTemplate(buf, "subject", data); err != nil {
+		return Rendered{}, err
+	}
+	r := Rendered{Subject: strings.TrimSpace(buf.String())}
+
+	buf.Reset()
+	if err := entry.html.ExecuteTemplate(buf, "layout", data); err != nil {
+		return Rendered{}, err
+	}
+	r.HTML = buf.String()
+
+	if entry.hasText {
+		buf.Reset()
+		if err := entry.text.ExecuteTemplate(buf, "text", data); err != nil {
+			return Rendered{}, err
+		}
+		r.Text = strings.TrimSpace(buf.String()) + "\n"
+	} else {
+		r.Text = htmlToText(r.HTML)
+	}
+
+	return r, nil
+}
+
+// missingVars returns the required variables that are absent or empty in
+// data, which is either a map or a struct.
+func missingVars(required []string, data any) []string {
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	var missing []string
+	for _, key := range required {
+		var field reflect.Value
+		switch v.Kind() {
+		case reflect.Map:
+			if v.Type().Key().Kind() == reflect.String {
+				field = v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))
+			}
+		case reflect.Struct:
+			field = v.FieldByName(key)
+		}
+		if field.IsValid() && field.Kind() == reflect.Interface {
+			field = field.Elem()
+		}
+		if !field.IsValid() || field.IsZero() {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,92 @@
+package mailer
+
+import (
+	"golang.org/x/net/html"
+	"regexp"
+	"strings"
+)
+
+var (
+	spacesRe   = regexp.MustCompile(`[ \t\r\n]+`)
+	newlinesRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText turns a rendered HTML email into a readable plaintext
+// alternative: scripts and styles are dropped, block elements become line
+// breaks and links keep their URL.
+func htmlToText(s string) string {
+	z := html.NewTokenizer(strings.NewReader(s))
+	out := new(strings.Builder)
+
+	var (
+		skip int
+		href string
+		link strings.Builder
+	)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			lines := strings.Split(out.String(), "\n")
+			for i, line := range lines {
+				lines[i] = strings.TrimSpace(line)
+			}
+			text := newlinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+			return strings.TrimSpace(text) + "\n"
+		case html.TextToken:
+			if skip > 0 {
+				continue
+			}
+			text := spacesRe.ReplaceAllString(string(z.Text()), " ")
+			if href != "" {
+				link.WriteString(text)
+				continue
+			}
+			out.WriteString(text)
+		case html.StartTagToken, html.EndTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			tag := string(name)
+			start := tt != html.EndTagToken
+
+			switch tag {
+			case "script", "style", "head", "title":
+				if tt == html.StartTagToken {
+					skip++
+				} else if tt == html.EndTagToken && skip > 0 {
+					skip--
+				}
+			case "a":
+				if start && hasAttr {
+					for {
+						key, val, more := z.TagAttr()
+						if string(key) == "href" {
+							href = string(val)
+						}
+						if !more {
+							break
+						}
+					}
+					link.Reset()
+				} else if !start && href != "" {
+					text := strings.TrimSpace(link.String())
+					if text == "" || text == href {
+						out.WriteString(href)
+					} else {
+						out.WriteString(text + " (" + href + ")")
+					}
+					href = ""
+				}
+			case "br":
+				out.WriteString("\n")
+			case "p", "div", "h1", "h2", "h3", "h4", "h5", "h6", "table", "tr", "ul", "ol":
+				out.WriteString("\n\n")
+			case "li":
+				if start {
+					out.WriteString("\n- ")
+				}
+			case "td", "th":
+				out.WriteString(" ")
+			}
+		}
+	}
+}
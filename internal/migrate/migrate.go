@@ -0,0 +1,384 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// lockKey is the pg_advisory_lock key shared by every instance so only one
+// of them migrates at a time.
+const lockKey = 7162543001
+
+var (
+	ErrDirty            = errors.New("schema is dirty, fix it manually and force a version")
+	ErrNoChange         = errors.New("no change")
+	ErrChecksumMismatch = errors.New("applied migration does not match its embedded file")
+
+	filenameRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+)
+
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New loads all migrations from source. Files follow the golang-migrate
+// naming scheme: 000001_create_users.up.sql / 000001_create_users.down.sql.
+func New(db *sql.DB, source fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(source, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		matches := filenameRe.FindStringSubmatch(e.Name())
+		if e.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		content, err := fs.ReadFile(source, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = m
+		}
+		if matches[3] == "up" {
+			m.Up = string(content)
+			sum := sha256.Sum256(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrator := &Migrator{db: db}
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrator.migrations = append(migrator.migrations, *m)
+	}
+	sort.Slice(migrator.migrations, func(i, j int) bool {
+		return migrator.migrations[i].Version < migrator.migrations[j].Version
+	})
+
+	return migrator, nil
+}
+
+// Latest returns the highest embedded migration version.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the currently applied version, 0 if nothing was applied.
+func (m *Migrator) Version(ctx context.Context) (int64, bool, error) {
+	return version(ctx, m.db)
+}
+
+// Pending returns the number of embedded migrations not yet applied.
+func (m *Migrator) Pending(ctx context.Context) (int, error) {
+	current, dirty, err := m.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, ErrDirty
+	}
+
+	pending := 0
+	for _, mig := range m.migrations {
+		if mig.Version > current {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.Goto(ctx, m.Latest())
+}
+
+// Down rolls back the given number of migrations, all of them if steps <= 0.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.prepare(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		idx := m.indexOf(current)
+		if idx < 0 {
+			return ErrNoChange
+		}
+		target := int64(0)
+		if steps > 0 && idx-steps >= 0 {
+			target = m.migrations[idx-steps].Version
+		}
+		return m.migrateTo(ctx, conn, current, target)
+	})
+}
+
+// Goto migrates up or down until the schema is at version.
+func (m *Migrator) Goto(ctx context.Context, version int64) error {
+	if version != 0 && m.indexOf(version) < 0 {
+		return fmt.Errorf("migration %d does not exist", version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.prepare(ctx, conn)
+		if err != nil {
+			return err
+		}
+		return m.migrateTo(ctx, conn, current, version)
+	})
+}
+
+// Force sets the version without running migrations and clears the dirty
+// flag, used to recover from a failed migration.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		if err := m.ensureTables(ctx, conn); err != nil {
+			return err
+		}
+		return setVersion(ctx, conn, version, false)
+	})
+}
+
+func (m *Migrator) migrateTo(ctx context.Context, conn *sql.Conn, current, target int64) error {
+	if current == target {
+		return ErrNoChange
+	}
+
+	if target > current {
+		for _, mig := range m.migrations {
+			if mig.Version <= current || mig.Version > target {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if mig.Version > current || mig.Version <= target {
+			continue
+		}
+		if err := m.apply(ctx, conn, mig, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply runs a single migration in its own transaction together with the
+// bookkeeping, so a failure leaves the schema at the previous version.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, mig Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if up {
+		if _, err := tx.ExecContext(ctx, mig.Up); err != nil {
+			return fmt.Errorf("migration %d_%s up: %w", mig.Version, mig.Name, err)
+		}
+		if err := recordApplied(ctx, tx, mig); err != nil {
+			return err
+		}
+		if err := setVersion(ctx, tx, mig.Version, false); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	if mig.Down == "" {
+		return fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+	}
+	if _, err := tx.ExecContext(ctx, mig.Down); err != nil {
+		return fmt.Errorf("migration %d_%s down: %w", mig.Version, mig.Name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations_history WHERE version = $1`, mig.Version); err != nil {
+		return err
+	}
+	previous := int64(0)
+	if idx := m.indexOf(mig.Version); idx > 0 {
+		previous = m.migrations[idx-1].Version
+	}
+	if err := setVersion(ctx, tx, previous, false); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// prepare validates the current state: the schema must not be dirty and
+// every applied migration must match its embedded checksum. Databases
+// migrated by the migrate CLI have no history yet, it is backfilled.
+func (m *Migrator) prepare(ctx context.Context, conn *sql.Conn) (int64, error) {
+	if err := m.ensureTables(ctx, conn); err != nil {
+		return 0, err
+	}
+
+	current, dirty, err := version(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, ErrDirty
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, checksum FROM schema_migrations_history`)
+	if err != nil {
+		return 0, err
+	}
+	applied := map[int64]string{}
+	for rows.Next() {
+		var (
+			v        int64
+			checksum string
+		)
+		if err := rows.Scan(&v, &checksum); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		applied[v] = checksum
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, mig := range m.migrations {
+		if mig.Version > current {
+			break
+		}
+		checksum, ok := applied[mig.Version]
+		if !ok {
+			if err := recordApplied(ctx, conn, mig); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if checksum != mig.Checksum {
+			return 0, fmt.Errorf("%w: %d_%s", ErrChecksumMismatch, mig.Version, mig.Name)
+		}
+	}
+
+	return current, nil
+}
+
+func (m *Migrator) indexOf(version int64) int {
+	for i, mig := range m.migrations {
+		if mig.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Migrator) withLock(ctx context.Context, f func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	return f(conn)
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// ensureTables creates schema_migrations with the same layout the migrate
+// CLI uses, so both tools can be used on the same database.
+func (m *Migrator) ensureTables(ctx context.Context, db execer) error {
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint NOT NULL PRIMARY KEY,
+			dirty boolean NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS schema_migrations_history (
+			version bigint PRIMARY KEY,
+			name text NOT NULL,
+			checksum text NOT NULL,
+			applied_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+		);
+	`
+	_, err := db.ExecContext(ctx, query)
+	return err
+}
+
+func version(ctx context.Context, db execer) (int64, bool, error) {
+	var (
+		v     int64
+		dirty bool
+	)
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&v, &dirty)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.Is(err, sql.ErrNoRows) || (errors.As(err, &pqErr) && pqErr.Code == "42P01") {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return v, dirty, nil
+}
+
+func setVersion(ctx context.Context, db execer, version int64, dirty bool) error {
+	if _, err := db.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version == 0 {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, version, dirty)
+	return err
+}
+
+func recordApplied(ctx context.Context, db execer, mig Migration) error {
+	query := `
+		INSERT INTO schema_migrations_history (version, name, checksum) VALUES ($1, $2, $3)
+		ON CONFLICT (version) DO UPDATE SET name = EXCLUDED.name, checksum = EXCLUDED.checksum, applied_at = NOW()
+	`
+	_, err := db.ExecContext(ctx, query, mig.Version, mig.Name, mig.Checksum)
+	return err
+}
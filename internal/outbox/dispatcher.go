@@ -0,0 +1,130 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/igorzinar/goSocial/internal/mailer"
+	"github.com/igorzinar/goSocial/internal/store"
+	"go.uber.org/zap"
+	"math/rand"
+	"time"
+)
+
+type Config struct {
+	// Interval between polls when the outbox is empty.
+	Interval time.Duration
+	// BatchSize is the number of emails claimed per poll.
+	BatchSize int
+	// Lease is how long a claimed email stays locked before another
+	// dispatcher may retry it.
+	Lease time.Duration
+	// MaxAttempts before an email is dead-lettered.
+	MaxAttempts int
+	// BaseBackoff is doubled on every failed attempt up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Sandbox is passed to the mailer, see mailer.Client.
+	Sandbox bool
+}
+
+// Dispatcher delivers the emails written to the outbox. Several instances
+// can run concurrently, claims skip rows locked by the others.
+type Dispatcher struct {
+	cfg    Config
+	store  store.Storage
+	mailer mailer.Client
+	logger *zap.SugaredLogger
+}
+
+func NewDispatcher(cfg Config, store store.Storage, mailer mailer.Client, logger *zap.SugaredLogger) *Dispatcher {
+	return &Dispatcher{
+		cfg:    cfg,
+		store:  store,
+		mailer: mailer,
+		logger: logger.With("component", "outbox"),
+	}
+}
+
+// Run polls the outbox until ctx is cancelled. A batch in flight is delivered
+// and recorded before Run returns.
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.logger.Infow("outbox dispatcher started", "interval", d.cfg.Interval, "batch_size", d.cfg.BatchSize)
+
+	for {
+		n, err := d.Dispatch(context.WithoutCancel(ctx))
+		if err != nil {
+			d.logger.Errorw("claiming outbox emails", "error", err)
+		}
+
+		// drain the backlog without waiting while batches come back full
+		wait := d.cfg.Interval
+		if err == nil && n == d.cfg.BatchSize {
+			wait = 0
+		}
+
+		select {
+		case <-ctx.Done():
+			d.logger.Info("outbox dispatcher stopped")
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Dispatch delivers one batch of due emails and returns how many were
+// claimed.
+func (d *Dispatcher) Dispatch(ctx context.Context) (int, error) {
+	emails, err := d.store.Outbox.Claim(ctx, d.cfg.BatchSize, d.cfg.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, email := range emails {
+		d.deliver(ctx, email)
+	}
+	return len(emails), nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, email store.OutboxEmail) {
+	logger := d.logger.With("outbox_id", email.ID, "template", email.Template, "attempt", email.Attempts)
+
+	var data map[string]any
+	err := json.Unmarshal(email.Data, &data)
+	if err == nil {
+		err = d.mailer.Send(email.Template, email.Username, email.Email, data, d.cfg.Sandbox)
+	}
+
+	if err == nil {
+		if err := d.store.Outbox.MarkSent(ctx, email.ID); err != nil {
+			logger.Errorw("marking outbox email as sent", "error", err)
+		}
+		return
+	}
+
+	dead := email.Attempts >= d.cfg.MaxAttempts
+	next := time.Now().Add(d.backoff(email.Attempts))
+	if dead {
+		logger.Errorw("outbox email dead-lettered", "error", err)
+	} else {
+		logger.Warnw("outbox email failed", "error", err, "next_attempt_at", next)
+	}
+
+	if err := d.store.Outbox.MarkFailed(ctx, email.ID, err.Error(), next, dead); err != nil {
+		logger.Errorw("marking outbox email as failed", "error", err)
+	}
+}
+
+// backoff returns BaseBackoff * 2^(attempt-1), capped at MaxBackoff, with up
+// to 50% jitter so failed emails don't retry in lockstep.
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.cfg.BaseBackoff
+	for i := 1; i < attempt && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.cfg.MaxBackoff {
+		delay = d.cfg.MaxBackoff
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay + jitter
+}
@@ -0,0 +1,126 @@
+// Package ranking orders the candidates of the ranked feed by a weighted sum
+// of scoring functions.
+package ranking
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+// ScoreFunc scores a candidate as of at, usually between 0 and 1.
+type ScoreFunc func(c *store.FeedCandidate, at time.Time) float64
+
+// Scorer is a named, weighted scoring function.
+type Scorer struct {
+	Name   string
+	Weight float64
+	Score  ScoreFunc
+}
+
+// Ranker sums the weighted scores of its scorers.
+type Ranker struct {
+	scorers []Scorer
+}
+
+func New(scorers ...Scorer) *Ranker {
+	return &Ranker{scorers: scorers}
+}
+
+// Default ranks on recency first, then engagement, affinity, tag overlap and
+// how close the author is in the follow graph.
+func Default(halfLife time.Duration) *Ranker {
+	return New(
+		Scorer{Name: "recency", Weight: 3, Score: Recency(halfLife)},
+		Scorer{Name: "engagement", Weight: 1, Score: Engagement},
+		Scorer{Name: "affinity", Weight: 1, Score: Affinity},
+		Scorer{Name: "tag_overlap", Weight: 1, Score: TagOverlap},
+		Scorer{Name: "proximity", Weight: 1, Score: Proximity},
+	)
+}
+
+// Recency halves the score of a post every halfLife.
+func Recency(halfLife time.Duration) ScoreFunc {
+	return func(c *store.FeedCandidate, at time.Time) float64 {
+		age := max(at.Sub(c.CreatedAt).Seconds(), 0)
+		return math.Pow(0.5, age/halfLife.Seconds())
+	}
+}
+
+// Engagement grows with the comment count, each comment adding less.
+func Engagement(c *store.FeedCandidate, at time.Time) float64 {
+	return saturate(c.CommentCount)
+}
+
+// Affinity grows with the interactions of the viewer with the author.
+func Affinity(c *store.FeedCandidate, at time.Time) float64 {
+	return saturate(c.Affinity)
+}
+
+// TagOverlap is the share of the tags of the post the viewer is interested in.
+func TagOverlap(c *store.FeedCandidate, at time.Time) float64 {
+	if len(c.Tags) == 0 {
+		return 0
+	}
+	return min(float64(c.TagOverlap)/float64(len(c.Tags)), 1)
+}
+
+// Proximity favors the viewer's own posts and the users they follow over
+// second-degree connections.
+func Proximity(c *store.FeedCandidate, at time.Time) float64 {
+	if c.Degree <= 1 {
+		return 1
+	}
+	return 0.5
+}
+
+// saturate maps a count to [0, 1): 0 is 0, 1 is 0.5, 3 is 0.75...
+func saturate(n int) float64 {
+	return float64(n) / float64(n+1)
+}
+
+// Factor is the part of a scorer in a score.
+type Factor struct {
+	Name   string  `json:"name"`
+	Value  float64 `json:"value"`
+	Weight float64 `json:"weight"`
+}
+
+// Explanation details the score of a post.
+type Explanation struct {
+	Score   float64  `json:"score"`
+	Degree  int      `json:"degree"`
+	Factors []Factor `json:"factors"`
+}
+
+// Post is a ranked post, Explanation is only set in debug mode.
+type Post struct {
+	store.PostWithMetadata
+	Explanation *Explanation `json:"explanation,omitempty"`
+}
+
+// Rank scores the candidates as of at and orders them by descending score,
+// the newest post first on a tie, so a ranking is reproducible.
+func (r *Ranker) Rank(candidates []store.FeedCandidate, at time.Time) []Post {
+	posts := make([]Post, len(candidates))
+	for i := range candidates {
+		c := &candidates[i]
+		e := &Explanation{Degree: c.Degree}
+		for _, s := range r.scorers {
+			value := s.Score(c, at)
+			e.Score += s.Weight * value
+			e.Factors = append(e.Factors, Factor{Name: s.Name, Value: value, Weight: s.Weight})
+		}
+		posts[i] = Post{PostWithMetadata: c.PostWithMetadata, Explanation: e}
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		a, b := posts[i], posts[j]
+		if a.Explanation.Score != b.Explanation.Score {
+			return a.Explanation.Score > b.Explanation.Score
+		}
+		return a.ID > b.ID
+	})
+	return posts
+}
@@ -0,0 +1,86 @@
+// Package richtext extracts the #hashtags and @mentions of post content.
+package richtext
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxTagLength is the length of the posts.tags and tags.name columns.
+const MaxTagLength = 100
+
+var (
+	// a hashtag or a mention starts a word: "a#b", "foo@example.com" and
+	// "&#38;" don't count
+	hashtagPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#@/])#([\p{L}\p{N}_]+)`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@/])@([\p{L}\p{N}_][\p{L}\p{N}_.\-]*)`)
+)
+
+// Entities are the hashtags and mentions of a text, in order of appearance
+// and without duplicates.
+type Entities struct {
+	// Hashtags are normalized with NormalizeTag.
+	Hashtags []string
+	// Mentions are usernames, as written.
+	Mentions []string
+}
+
+// Parse extracts the entities of content.
+func Parse(content string) Entities {
+	var e Entities
+	for _, m := range hashtagPattern.FindAllStringSubmatch(content, -1) {
+		if tag, ok := NormalizeTag(m[1]); ok && !slices.Contains(e.Hashtags, tag) {
+			e.Hashtags = append(e.Hashtags, tag)
+		}
+	}
+	for _, m := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		// trailing punctuation ends the sentence, not the username
+		username := strings.TrimRight(m[1], ".-")
+		if username != "" && !slices.Contains(e.Mentions, username) {
+			e.Mentions = append(e.Mentions, username)
+		}
+	}
+	return e
+}
+
+// FoldTag returns tag without a leading '#', NFKC normalized and
+// lower-cased, the form tags are stored and searched in.
+func FoldTag(tag string) string {
+	return strings.ToLower(norm.NFKC.String(strings.TrimPrefix(strings.TrimSpace(tag), "#")))
+}
+
+// NormalizeTag folds tag with FoldTag and checks it is valid: made of
+// letters, digits and underscores, including a letter, and fitting
+// MaxTagLength.
+func NormalizeTag(tag string) (string, bool) {
+	tag = FoldTag(tag)
+	if tag == "" || len(tag) > MaxTagLength {
+		return "", false
+	}
+	letter := false
+	for _, r := range tag {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r), r == '_':
+		default:
+			return "", false
+		}
+	}
+	return tag, letter
+}
+
+// NormalizeTags normalizes tags, dropping the invalid ones and duplicates.
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		if tag, ok := NormalizeTag(tag); ok && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
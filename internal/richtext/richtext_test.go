@@ -0,0 +1,76 @@
+package richtext_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/igorzinar/goSocial/internal/richtext"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		hashtags []string
+		mentions []string
+	}{
+		{"empty", "", nil, nil},
+		{"hashtags", "Learning #Go and #SQL", []string{"go", "sql"}, nil},
+		{"duplicate hashtags", "#go #Go #GO", []string{"go"}, nil},
+		{"hashtag inside a word", "a#tag", nil, nil},
+		{"html entity", "&#38; #go", []string{"go"}, nil},
+		{"url fragment", "example.com/#anchor", nil, nil},
+		{"hashtag without a letter", "#42 #4you", []string{"4you"}, nil},
+		{"unicode hashtag", "#Café #ｇｏ", []string{"café", "go"}, nil},
+		{"mentions", "Thanks @bob and @carol!", nil, []string{"bob", "carol"}},
+		{"duplicate mentions", "@bob @bob", nil, []string{"bob"}},
+		{"email address", "me@alice.example", nil, nil},
+		{"trailing punctuation", "Ask @bob. Or @carol-", nil, []string{"bob", "carol"}},
+		{"dotted username", "@bob.smith says hi", nil, []string{"bob.smith"}},
+		{"both", "@alice on #go", []string{"go"}, []string{"alice"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := richtext.Parse(tt.content)
+			if !slices.Equal(e.Hashtags, tt.hashtags) {
+				t.Errorf("Parse(%q).Hashtags = %q, want %q", tt.content, e.Hashtags, tt.hashtags)
+			}
+			if !slices.Equal(e.Mentions, tt.mentions) {
+				t.Errorf("Parse(%q).Mentions = %q, want %q", tt.content, e.Mentions, tt.mentions)
+			}
+		})
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want string
+		ok   bool
+	}{
+		{"go", "go", true},
+		{"#Go", "go", true},
+		{"  #SQL ", "sql", true},
+		{"web_dev", "web_dev", true},
+		{"go2", "go2", true},
+		{"Ｇｏ", "go", true},
+		{"Café", "café", true},
+		{"", "", false},
+		{"#", "", false},
+		{"42", "", false},
+		{"___", "", false},
+		{"two words", "", false},
+		{"c++", "", false},
+		{"##go", "", false},
+		{strings.Repeat("a", richtext.MaxTagLength), strings.Repeat("a", richtext.MaxTagLength), true},
+		{strings.Repeat("a", richtext.MaxTagLength+1), "", false},
+	}
+	for _, tt := range tests {
+		got, ok := richtext.NormalizeTag(tt.tag)
+		// the tag is only meaningful when valid
+		if ok != tt.ok || ok && got != tt.want {
+			t.Errorf("NormalizeTag(%q) = %q, %v, want %q, %v", tt.tag, got, ok, tt.want, tt.ok)
+		}
+	}
+}
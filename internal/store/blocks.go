@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// BlockedUser is an account blocked by the user.
+type BlockedUser struct {
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+type BlockStore struct {
+	db *sql.DB
+}
+
+// blockedBy lists the users hidden from $1: the ones it blocked and the ones
+// who blocked it.
+const blockedBy = `
+	SELECT blocked_id FROM user_blocks WHERE blocker_id = $1
+	UNION ALL
+	SELECT blocker_id FROM user_blocks WHERE blocked_id = $1
+`
+
+// Block hides two users from each other. Blocking twice is a no-op, an
+// unknown user is ErrNotFound.
+func (s *BlockStore) Block(ctx context.Context, userID, blockedID int64) error {
+	query := `
+		INSERT INTO user_blocks (blocker_id, blocked_id)
+		SELECT $1, id FROM users WHERE id = $2
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, blockedID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil || rows > 0 {
+		return err
+	}
+
+	// nothing inserted: already blocked, or no such user
+	var exists bool
+	err = s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, blockedID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Unblock removes a block, removing one that isn't there is a no-op.
+func (s *BlockStore) Unblock(ctx context.Context, userID, blockedID int64) error {
+	query := `DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, blockedID)
+	return err
+}
+
+// List returns the users blocked by userID, the most recently blocked first.
+func (s *BlockStore) List(ctx context.Context, userID int64) ([]BlockedUser, error) {
+	query := `
+		SELECT u.id, u.username, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC, b.blocked_id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocked []BlockedUser
+	for rows.Next() {
+		var b BlockedUser
+		if err := rows.Scan(&b.UserID, &b.Username, &b.BlockedAt); err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, b)
+	}
+	return blocked, rows.Err()
+}
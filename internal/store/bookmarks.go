@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Bookmark struct {
+	ID           int64            `json:"id"`
+	CollectionID *int64           `json:"collection_id"`
+	CreatedAt    time.Time        `json:"created_at"`
+	Post         PostWithMetadata `json:"post"`
+}
+
+type BookmarkCollection struct {
+	ID            int64     `json:"id"`
+	UserID        int64     `json:"-"`
+	Name          string    `json:"name"`
+	BookmarkCount int64     `json:"bookmark_count"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type BookmarkQuery struct {
+	// Before pages through the bookmarks older than the one with this ID, 0
+	// starts from the newest.
+	Before int64
+	// CollectionID only lists the bookmarks of a collection.
+	CollectionID *int64
+	Limit        int
+}
+
+type BookmarkStore struct {
+	db *sql.DB
+}
+
+// Save bookmarks a post in a collection of the user, or in none when
+// collectionID is nil. Saving a bookmarked post again moves it to the
+// collection and keeps its place in the list. An unknown post or a
+// collection of someone else is ErrNotFound.
+func (s *BookmarkStore) Save(ctx context.Context, userID, postID int64, collectionID *int64) error {
+	query := `
+		INSERT INTO bookmarks (user_id, post_id, collection_id)
+		SELECT $1, $2, $3
+		WHERE $3::bigint IS NULL OR EXISTS (SELECT 1 FROM bookmark_collections WHERE id = $3 AND user_id = $1)
+		ON CONFLICT (user_id, post_id) DO UPDATE
+		SET collection_id = EXCLUDED.collection_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, postID, collectionID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrNotFound
+		}
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes the bookmark of a post, removing one that isn't there is a
+// no-op.
+func (s *BookmarkStore) Delete(ctx context.Context, userID, postID int64) error {
+	query := `DELETE FROM bookmarks WHERE user_id = $1 AND post_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, postID)
+	return err
+}
+
+// List returns the bookmarks of a user, the most recently saved first. A
+// collection of someone else is ErrNotFound.
+func (s *BookmarkStore) List(ctx context.Context, userID int64, q BookmarkQuery) ([]Bookmark, error) {
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	if q.CollectionID != nil {
+		var exists bool
+		err := s.db.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM bookmark_collections WHERE id = $1 AND user_id = $2)`,
+			*q.CollectionID, userID,
+		).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrNotFound
+		}
+	}
+
+	query := `
+		SELECT
+			b.id, b.collection_id, b.created_at,
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+			u.username,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count
+		FROM bookmarks b
+		JOIN posts p ON p.id = b.post_id
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			b.user_id = $1 AND
+			($2::bigint = 0 OR b.id < $2) AND
+			($3::bigint IS NULL OR b.collection_id = $3)
+		ORDER BY b.id DESC
+		LIMIT $4
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userID, q.Before, q.CollectionID, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bookmarks []Bookmark
+	for rows.Next() {
+		var b Bookmark
+		err := rows.Scan(
+			&b.ID,
+			&b.CollectionID,
+			&b.CreatedAt,
+			&b.Post.ID,
+			&b.Post.UserID,
+			&b.Post.Title,
+			&b.Post.Content,
+			&b.Post.CreatedAt,
+			&b.Post.Version,
+			pq.Array(&b.Post.Tags),
+			&b.Post.User.Username,
+			&b.Post.CommentCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		b.Post.Bookmarked = true
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks, rows.Err()
+}
+
+// CreateCollection creates a collection, a name the user already uses is
+// ErrConflict.
+func (s *BookmarkStore) CreateCollection(ctx context.Context, collection *BookmarkCollection) error {
+	query := `
+		INSERT INTO bookmark_collections (user_id, name)
+		VALUES ($1, $2)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(ctx, query, collection.UserID, collection.Name).Scan(&collection.ID, &collection.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// ListCollections returns the collections of a user by name, with the number
+// of bookmarks in each.
+func (s *BookmarkStore) ListCollections(ctx context.Context, userID int64) ([]BookmarkCollection, error) {
+	query := `
+		SELECT c.id, c.user_id, c.name, c.created_at,
+			(SELECT COUNT(*) FROM bookmarks b WHERE b.collection_id = c.id)
+		FROM bookmark_collections c
+		WHERE c.user_id = $1
+		ORDER BY lower(c.name), c.id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []BookmarkCollection
+	for rows.Next() {
+		var c BookmarkCollection
+		if err := rows.Scan(&c.ID, &c.UserID, &c.Name, &c.CreatedAt, &c.BookmarkCount); err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// DeleteCollection deletes a collection of the user, its bookmarks are kept
+// without a collection. A collection of someone else is ErrNotFound.
+func (s *BookmarkStore) DeleteCollection(ctx context.Context, userID, id int64) error {
+	query := `DELETE FROM bookmark_collections WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -22,7 +22,7 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postId int64) ([]Comment
 		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id  FROM comments c
 		JOIN users on users.id = c.user_id
 		WHERE c.post_id = $1
-		ORDER BY c.created_at DESC;
+		ORDER BY c.created_at DESC, c.id DESC;
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
@@ -39,7 +39,7 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postId int64) ([]Comment
 		var c Comment
 		c.User = User{}
 
-		err := rows.Scan(c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
+		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
 		if err != nil {
 			return nil, err
 		}
@@ -47,7 +47,7 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postId int64) ([]Comment
 		comments = append(comments, c)
 
 	}
-	return comments, nil
+	return comments, rows.Err()
 }
 
 func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// RequestEmailChange records newEmail as pending for the user behind the
+// hashed token, replacing any previous request, and enqueues the
+// confirmation and notice emails. The address is only swapped by
+// ConfirmEmailChange.
+func (s *UserStore) RequestEmailChange(ctx context.Context, userID int64, newEmail, token string, exp time.Duration, emails ...*OutboxEmail) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		// citext makes this case insensitive, the unique index still guards
+		// the final swap
+		var taken bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE email = $1)`, newEmail).Scan(&taken)
+		if err != nil {
+			return err
+		}
+		if taken {
+			return ErrDuplicateEmail
+		}
+
+		query := `
+			INSERT INTO email_changes (user_id, new_email, token, expiry)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (user_id) DO UPDATE
+			SET new_email = EXCLUDED.new_email, token = EXCLUDED.token, expiry = EXCLUDED.expiry, created_at = NOW()
+		`
+		if _, err := tx.ExecContext(ctx, query, userID, newEmail, token, time.Now().Add(exp)); err != nil {
+			return err
+		}
+
+		for _, email := range emails {
+			if err := enqueueEmail(ctx, tx, email); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ConfirmEmailChange swaps the email of the user owning the hashed token and
+// signs them out everywhere. It fails with ErrNotFound for unknown tokens,
+// ErrExpired for expired ones and ErrDuplicateEmail when the address was
+// taken in the meantime.
+func (s *UserStore) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	var user *User
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		var (
+			userID   int64
+			newEmail string
+			expiry   time.Time
+		)
+		query := `SELECT user_id, new_email, expiry FROM email_changes WHERE token = $1 FOR UPDATE`
+		err := tx.QueryRowContext(ctx, query, token).Scan(&userID, &newEmail, &expiry)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+		if !expiry.After(time.Now()) {
+			return ErrExpired
+		}
+
+		user = &User{ID: userID, Email: newEmail}
+		err = tx.QueryRowContext(ctx, `UPDATE users SET email = $1 WHERE id = $2 RETURNING username`, newEmail, userID).Scan(&user.Username)
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+				return ErrDuplicateEmail
+			}
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM email_changes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+		return deleteUserSessions(ctx, tx, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,147 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ScheduleDeletion marks the account for erasure at the given time and signs
+// it out everywhere. Logging in again cancels the deletion.
+func (s *UserStore) ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, `UPDATE users SET deletion_scheduled_at = $1 WHERE id = $2`, at, userID)
+		if err != nil {
+			return err
+		}
+		if rows, err := res.RowsAffected(); err != nil {
+			return err
+		} else if rows == 0 {
+			return ErrNotFound
+		}
+		return deleteUserSessions(ctx, tx, userID)
+	})
+}
+
+// CancelDeletion clears a scheduled deletion, it reports whether one was
+// pending.
+func (s *UserStore) CancelDeletion(ctx context.Context, userID int64) (bool, error) {
+	query := `UPDATE users SET deletion_scheduled_at = NULL WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	return rows > 0, err
+}
+
+// DueForErasure returns up to limit accounts whose deletion is due.
+func (s *UserStore) DueForErasure(ctx context.Context, limit int) ([]int64, error) {
+	query := `
+		SELECT id FROM users
+		WHERE deletion_scheduled_at <= $1
+		ORDER BY deletion_scheduled_at
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Erase removes an account whose deletion is due together with everything it
+// owns, in a single transaction. It returns the storage keys of the user's
+// media and data exports, which the caller deletes once the transaction
+// committed. It fails
+// with ErrNotFound when the deletion was cancelled in the meantime.
+func (s *UserStore) Erase(ctx context.Context, userID int64) ([]string, error) {
+	var mediaKeys []string
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		var email string
+		query := `SELECT email FROM users WHERE id = $1 AND deletion_scheduled_at <= $2 FOR UPDATE`
+		err := tx.QueryRowContext(ctx, query, userID, time.Now()).Scan(&email)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		query = `
+			WITH deleted_media AS (
+				DELETE FROM media WHERE user_id = $1 RETURNING storage_key
+			), deleted_exports AS (
+				DELETE FROM data_exports WHERE user_id = $1 AND storage_key IS NOT NULL RETURNING storage_key
+			)
+			SELECT storage_key FROM deleted_media
+			UNION ALL
+			SELECT storage_key FROM deleted_exports
+		`
+		rows, err := tx.QueryContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var key string
+			if err := rows.Scan(&key); err != nil {
+				rows.Close()
+				return err
+			}
+			mediaKeys = append(mediaKeys, key)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// posts and comments have no cascading foreign keys
+		statements := []string{
+			`DELETE FROM comments WHERE user_id = $1 OR post_id IN (SELECT id FROM posts WHERE user_id = $1)`,
+			`DELETE FROM posts WHERE user_id = $1`,
+			`DELETE FROM followers WHERE user_id = $1 OR follower_id = $1`,
+			`DELETE FROM user_invitations WHERE user_id = $1`,
+			`DELETE FROM users WHERE id = $1`,
+		}
+		for _, stmt := range statements {
+			if _, err := tx.ExecContext(ctx, stmt, userID); err != nil {
+				return err
+			}
+		}
+
+		// emails not delivered yet would still carry personal data
+		_, err = tx.ExecContext(ctx, `DELETE FROM email_outbox WHERE email = $1`, email)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mediaKeys, nil
+}
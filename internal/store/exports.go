@@ -0,0 +1,364 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+const (
+	ExportPending    = "pending"
+	ExportProcessing = "processing"
+	ExportReady      = "ready"
+	ExportFailed     = "failed"
+	ExportExpired    = "expired"
+)
+
+// DataExport is a personal data archive requested by a user. It is built in
+// the background and stored under StorageKey until ExpiresAt.
+type DataExport struct {
+	ID          int64      `json:"id"`
+	UserID      int64      `json:"user_id"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"-"`
+	StorageKey  string     `json:"-"`
+	Size        int64      `json:"size"`
+	RequestedAt time.Time  `json:"requested_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// UserData is everything stored about a user, as written to an export.
+type UserData struct {
+	Profile   *User             `json:"profile"`
+	Posts     []Post            `json:"posts"`
+	Comments  []Comment         `json:"comments"`
+	Following []Follow          `json:"following"`
+	Followers []Follow          `json:"followers"`
+	Media     []Media           `json:"media"`
+	Sessions  []Session         `json:"sessions"`
+	Usernames []UsernameHistory `json:"previous_usernames"`
+}
+
+// Follow is one side of a follow relationship.
+type Follow struct {
+	UserID    int64     `json:"user_id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UsernameHistory struct {
+	Username  string    `json:"username"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+type ExportStore struct {
+	db *sql.DB
+}
+
+const exportColumns = `id, user_id, status, attempts, COALESCE(storage_key, ''), size, requested_at, completed_at, expires_at`
+
+func scanExport(row interface{ Scan(...any) error }) (*DataExport, error) {
+	var e DataExport
+	err := row.Scan(&e.ID, &e.UserID, &e.Status, &e.Attempts, &e.StorageKey, &e.Size, &e.RequestedAt, &e.CompletedAt, &e.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Request queues a new export. It fails with ErrConflict while another
+// export of the user is being built.
+func (s *ExportStore) Request(ctx context.Context, userID int64) (*DataExport, error) {
+	query := `INSERT INTO data_exports (user_id) VALUES ($1) RETURNING ` + exportColumns
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	export, err := scanExport(s.db.QueryRowContext(ctx, query, userID))
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+	return export, nil
+}
+
+func (s *ExportStore) GetByID(ctx context.Context, id int64) (*DataExport, error) {
+	query := `SELECT ` + exportColumns + ` FROM data_exports WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	export, err := scanExport(s.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return export, nil
+}
+
+func (s *ExportStore) ListByUser(ctx context.Context, userID int64) ([]DataExport, error) {
+	query := `SELECT ` + exportColumns + ` FROM data_exports WHERE user_id = $1 ORDER BY requested_at DESC, id DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exports := []DataExport{}
+	for rows.Next() {
+		e, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, *e)
+	}
+	return exports, rows.Err()
+}
+
+// Claim locks the oldest pending export for lease. An export whose builder
+// died is claimed again once its lease expired. It returns ErrNotFound when
+// there is nothing to build.
+func (s *ExportStore) Claim(ctx context.Context, lease time.Duration) (*DataExport, error) {
+	query := `
+		UPDATE data_exports
+		SET status = 'processing', attempts = attempts + 1, claimed_until = $1
+		WHERE id = (
+			SELECT id FROM data_exports
+			WHERE status = 'pending' OR (status = 'processing' AND claimed_until <= NOW())
+			ORDER BY requested_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + exportColumns
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	export, err := scanExport(s.db.QueryRowContext(ctx, query, time.Now().Add(lease)))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return export, nil
+}
+
+// Complete marks the export ready and enqueues the email announcing it.
+func (s *ExportStore) Complete(ctx context.Context, export *DataExport, email *OutboxEmail) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE data_exports
+			SET status = 'ready', storage_key = $1, size = $2, expires_at = $3, completed_at = NOW(), last_error = NULL
+			WHERE id = $4
+			RETURNING completed_at
+		`
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, export.StorageKey, export.Size, export.ExpiresAt, export.ID).Scan(&export.CompletedAt)
+		if err != nil {
+			return err
+		}
+		export.Status = ExportReady
+
+		return enqueueEmail(ctx, tx, email)
+	})
+}
+
+// Fail records a build error, the export is retried unless dead is set.
+func (s *ExportStore) Fail(ctx context.Context, id int64, lastErr string, dead bool) error {
+	status := ExportPending
+	if dead {
+		status = ExportFailed
+	}
+	query := `UPDATE data_exports SET status = $1, last_error = $2, claimed_until = NULL WHERE id = $3`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, status, lastErr, id)
+	return err
+}
+
+// Expire marks up to limit ready exports past their expiry as expired and
+// returns them so their archive can be deleted.
+func (s *ExportStore) Expire(ctx context.Context, limit int) ([]DataExport, error) {
+	query := `
+		UPDATE data_exports
+		SET status = 'expired'
+		WHERE id IN (
+			SELECT id FROM data_exports
+			WHERE status = 'ready' AND expires_at <= NOW()
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + exportColumns
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var exports []DataExport
+	for rows.Next() {
+		e, err := scanExport(rows)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, *e)
+	}
+	return exports, rows.Err()
+}
+
+// Collect gathers the personal data of a user in a single read only
+// transaction so the export is consistent.
+func (s *ExportStore) Collect(ctx context.Context, userID int64) (*UserData, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	profile, err := getUserBy(ctx, tx, "u.id", userID)
+	if err != nil {
+		return nil, err
+	}
+	data := &UserData{Profile: profile}
+
+	err = collect(ctx, tx, `
+		SELECT id, user_id, title, content, tags, created_at, updated_at, version
+		FROM posts WHERE user_id = $1 ORDER BY id`, userID,
+		func(rows *sql.Rows) error {
+			var p Post
+			if err := rows.Scan(&p.ID, &p.UserID, &p.Title, &p.Content, pq.Array(&p.Tags), &p.CreatedAt, &p.UpdatedAt, &p.Version); err != nil {
+				return err
+			}
+			data.Posts = append(data.Posts, p)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	err = collect(ctx, tx, `
+		SELECT id, post_id, user_id, content, created_at
+		FROM comments WHERE user_id = $1 ORDER BY id`, userID,
+		func(rows *sql.Rows) error {
+			var c Comment
+			if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt); err != nil {
+				return err
+			}
+			data.Comments = append(data.Comments, c)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	follows := []struct {
+		query string
+		dst   *[]Follow
+	}{
+		{`SELECT u.id, u.username, f.created_at FROM followers f JOIN users u ON u.id = f.user_id WHERE f.follower_id = $1 ORDER BY f.created_at`, &data.Following},
+		{`SELECT u.id, u.username, f.created_at FROM followers f JOIN users u ON u.id = f.follower_id WHERE f.user_id = $1 ORDER BY f.created_at`, &data.Followers},
+	}
+	for _, f := range follows {
+		err = collect(ctx, tx, f.query, userID, func(rows *sql.Rows) error {
+			var follow Follow
+			if err := rows.Scan(&follow.UserID, &follow.Username, &follow.CreatedAt); err != nil {
+				return err
+			}
+			*f.dst = append(*f.dst, follow)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = collect(ctx, tx, `
+		SELECT id, user_id, kind, storage_key, content_type, size, created_at
+		FROM media WHERE user_id = $1 ORDER BY id`, userID,
+		func(rows *sql.Rows) error {
+			var m Media
+			if err := rows.Scan(&m.ID, &m.UserID, &m.Kind, &m.StorageKey, &m.ContentType, &m.Size, &m.CreatedAt); err != nil {
+				return err
+			}
+			data.Media = append(data.Media, m)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	err = collect(ctx, tx, `
+		SELECT user_id, expiry, created_at
+		FROM sessions WHERE user_id = $1 ORDER BY created_at`, userID,
+		func(rows *sql.Rows) error {
+			var session Session
+			if err := rows.Scan(&session.UserID, &session.Expiry, &session.CreatedAt); err != nil {
+				return err
+			}
+			data.Sessions = append(data.Sessions, session)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	err = collect(ctx, tx, `
+		SELECT username, changed_at
+		FROM username_history WHERE user_id = $1 ORDER BY changed_at`, userID,
+		func(rows *sql.Rows) error {
+			var h UsernameHistory
+			if err := rows.Scan(&h.Username, &h.ChangedAt); err != nil {
+				return err
+			}
+			data.Usernames = append(data.Usernames, h)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return data, tx.Commit()
+}
+
+func collect(ctx context.Context, tx *sql.Tx, query string, userID int64, scan func(*sql.Rows) error) error {
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
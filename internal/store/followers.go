@@ -24,9 +24,15 @@ func (s *FollowerStore) Follow(ctx context.Context, followerID, userID int64) er
 
 	_, err := s.db.ExecContext(ctx, query, userID, followerID)
 	if err != nil {
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
-			return ErrConflict
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code {
+			case "23505":
+				return ErrConflict
+			case "23503":
+				return ErrNotFound
+			}
 		}
+		return err
 	}
 	return nil
 }
@@ -0,0 +1,160 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyKey is a request sent with an Idempotency-Key header and, once
+// handled, the response replayed to its retries.
+type IdempotencyKey struct {
+	// Scope keeps the keys of different clients apart.
+	Scope string
+	Key   string
+	// Fingerprint identifies the request the key was first used for.
+	Fingerprint string
+	// Status is 0 while the original request is being handled.
+	Status    int
+	Header    map[string][]string
+	Body      []byte
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// Completed reports whether the response of the original request is stored.
+func (k *IdempotencyKey) Completed() bool {
+	return k.Status != 0
+}
+
+type IdempotencyStore struct {
+	db *sql.DB
+}
+
+// Begin claims key.Key for a new request. It returns nil when the caller
+// owns the key and must Complete or Release it, or the stored key when
+// another request used it first. Expired keys, and keys whose request was
+// abandoned for longer than lease, can be claimed again.
+func (s *IdempotencyStore) Begin(ctx context.Context, key *IdempotencyKey, ttl, lease time.Duration) (*IdempotencyKey, error) {
+	var existing *IdempotencyKey
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		// the conflicting row stays locked until the transaction ends, even
+		// when it isn't updated
+		query := `
+			INSERT INTO idempotency_keys (scope, idempotency_key, fingerprint, locked_until, expires_at)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (scope, idempotency_key) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint, status = NULL, header = NULL, body = NULL,
+				locked_until = EXCLUDED.locked_until, created_at = NOW(), expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at <= NOW()
+				OR (idempotency_keys.status IS NULL AND idempotency_keys.locked_until <= NOW()
+					AND idempotency_keys.fingerprint = EXCLUDED.fingerprint)
+			RETURNING created_at, expires_at`
+
+		now := time.Now()
+		err := tx.QueryRowContext(ctx, query, key.Scope, key.Key, key.Fingerprint, now.Add(lease), now.Add(ttl)).Scan(&key.CreatedAt, &key.ExpiresAt)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		existing, err = getIdempotencyKey(ctx, tx, key.Scope, key.Key)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+func getIdempotencyKey(ctx context.Context, tx *sql.Tx, scope, key string) (*IdempotencyKey, error) {
+	query := `
+		SELECT scope, idempotency_key, fingerprint, COALESCE(status, 0), header, body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE scope = $1 AND idempotency_key = $2`
+
+	k := &IdempotencyKey{}
+	var header []byte
+	err := tx.QueryRowContext(ctx, query, scope, key).Scan(
+		&k.Scope,
+		&k.Key,
+		&k.Fingerprint,
+		&k.Status,
+		&header,
+		&k.Body,
+		&k.CreatedAt,
+		&k.ExpiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if header != nil {
+		if err := json.Unmarshal(header, &k.Header); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// Complete stores the response of the request owning key. It returns
+// ErrNotFound when the key was claimed again in the meantime.
+func (s *IdempotencyStore) Complete(ctx context.Context, key *IdempotencyKey) error {
+	header, err := json.Marshal(key.Header)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE idempotency_keys
+		SET status = $1, header = $2, body = $3, locked_until = NULL
+		WHERE scope = $4 AND idempotency_key = $5 AND fingerprint = $6 AND status IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, key.Status, header, key.Body, key.Scope, key.Key, key.Fingerprint)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Release forgets a key whose request failed, so it can be retried. Completed
+// keys are kept.
+func (s *IdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	query := `DELETE FROM idempotency_keys WHERE scope = $1 AND idempotency_key = $2 AND status IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, scope, key)
+	return err
+}
+
+// DeleteExpired removes the keys past their retention.
+func (s *IdempotencyStore) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const MediaAvatar = "avatar"
+
+// Media is an uploaded file, the content lives in a media.Storage under
+// StorageKey.
+type Media struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Kind        string    `json:"kind"`
+	StorageKey  string    `json:"-"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type MediaStore struct {
+	db *sql.DB
+}
+
+func (s *MediaStore) Create(ctx context.Context, m *Media) error {
+	query := `
+		INSERT INTO media (user_id, kind, storage_key, content_type, size)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, m.UserID, m.Kind, m.StorageKey, m.ContentType, m.Size).Scan(&m.ID, &m.CreatedAt)
+}
+
+func (s *MediaStore) GetByID(ctx context.Context, id int64) (*Media, error) {
+	query := `SELECT id, user_id, kind, storage_key, content_type, size, created_at FROM media WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	var m Media
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&m.ID, &m.UserID, &m.Kind, &m.StorageKey, &m.ContentType, &m.Size, &m.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &m, nil
+}
+
+func (s *MediaStore) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM media WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
@@ -0,0 +1,76 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type block struct {
+	blockerID int64
+	blockedID int64
+	createdAt time.Time
+}
+
+type BlockStore struct {
+	db *db
+}
+
+func (s *BlockStore) Block(ctx context.Context, userID, blockedID int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.user(blockedID) == nil {
+		return store.ErrNotFound
+	}
+	if s.db.user(userID) == nil {
+		return errForeignKey
+	}
+	if userID == blockedID {
+		return errCheck
+	}
+	if !slices.ContainsFunc(s.db.blocks, func(b *block) bool { return b.blockerID == userID && b.blockedID == blockedID }) {
+		s.db.blocks = append(s.db.blocks, &block{blockerID: userID, blockedID: blockedID, createdAt: s.db.now()})
+	}
+	return nil
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, userID, blockedID int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.blocks = remove(s.db.blocks, func(b *block) bool { return b.blockerID == userID && b.blockedID == blockedID })
+	return nil
+}
+
+func (s *BlockStore) List(ctx context.Context, userID int64) ([]store.BlockedUser, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var blocked []store.BlockedUser
+	for _, b := range s.db.blocks {
+		if b.blockerID != userID {
+			continue
+		}
+		if u := s.db.user(b.blockedID); u != nil {
+			blocked = append(blocked, store.BlockedUser{UserID: u.ID, Username: u.Username, BlockedAt: b.createdAt})
+		}
+	}
+	sort.Slice(blocked, func(i, j int) bool {
+		if !blocked[i].BlockedAt.Equal(blocked[j].BlockedAt) {
+			return blocked[i].BlockedAt.After(blocked[j].BlockedAt)
+		}
+		return blocked[i].UserID > blocked[j].UserID
+	})
+	return blocked, nil
+}
+
+// blocked reports whether either user blocked the other.
+func (d *db) blocked(userID, otherID int64) bool {
+	return slices.ContainsFunc(d.blocks, func(b *block) bool {
+		return b.blockerID == userID && b.blockedID == otherID || b.blockerID == otherID && b.blockedID == userID
+	})
+}
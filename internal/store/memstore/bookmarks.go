@@ -0,0 +1,182 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type bookmark struct {
+	id           int64
+	userID       int64
+	postID       int64
+	collectionID *int64
+	createdAt    time.Time
+}
+
+type BookmarkStore struct {
+	db *db
+}
+
+func (s *BookmarkStore) Save(ctx context.Context, userID, postID int64, collectionID *int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.post(postID) == nil || s.db.user(userID) == nil {
+		return store.ErrNotFound
+	}
+	if collectionID != nil {
+		if c := s.db.collection(*collectionID); c == nil || c.UserID != userID {
+			return store.ErrNotFound
+		}
+	}
+	if b := s.db.bookmark(userID, postID); b != nil {
+		b.collectionID = copyID(collectionID)
+		return nil
+	}
+	s.db.bookmarks = append(s.db.bookmarks, &bookmark{
+		id:           s.db.nextID("bookmarks"),
+		userID:       userID,
+		postID:       postID,
+		collectionID: copyID(collectionID),
+		createdAt:    s.db.now(),
+	})
+	return nil
+}
+
+func (s *BookmarkStore) Delete(ctx context.Context, userID, postID int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.bookmarks = remove(s.db.bookmarks, func(b *bookmark) bool { return b.userID == userID && b.postID == postID })
+	return nil
+}
+
+func (s *BookmarkStore) List(ctx context.Context, userID int64, q store.BookmarkQuery) ([]store.Bookmark, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if q.CollectionID != nil {
+		if c := s.db.collection(*q.CollectionID); c == nil || c.UserID != userID {
+			return nil, store.ErrNotFound
+		}
+	}
+
+	var bookmarks []store.Bookmark
+	for _, b := range s.db.bookmarks {
+		if b.userID != userID || q.Before != 0 && b.id >= q.Before {
+			continue
+		}
+		if q.CollectionID != nil && (b.collectionID == nil || *b.collectionID != *q.CollectionID) {
+			continue
+		}
+		item, ok := s.db.postWithMetadata(s.db.post(b.postID))
+		if !ok {
+			continue
+		}
+		item.Bookmarked = true
+		bookmarks = append(bookmarks, store.Bookmark{
+			ID:           b.id,
+			CollectionID: copyID(b.collectionID),
+			CreatedAt:    b.createdAt,
+			Post:         item,
+		})
+	}
+	sort.Slice(bookmarks, func(i, j int) bool { return bookmarks[i].ID > bookmarks[j].ID })
+	return page(bookmarks, q.Limit, 0), nil
+}
+
+func (s *BookmarkStore) CreateCollection(ctx context.Context, collection *store.BookmarkCollection) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.user(collection.UserID) == nil {
+		return errForeignKey
+	}
+	for _, c := range s.db.collections {
+		if c.UserID == collection.UserID && c.Name == collection.Name {
+			return store.ErrConflict
+		}
+	}
+	collection.ID = s.db.nextID("bookmark_collections")
+	collection.CreatedAt = s.db.now()
+	collection.BookmarkCount = 0
+	c := *collection
+	s.db.collections = append(s.db.collections, &c)
+	return nil
+}
+
+func (s *BookmarkStore) ListCollections(ctx context.Context, userID int64) ([]store.BookmarkCollection, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var collections []store.BookmarkCollection
+	for _, c := range s.db.collections {
+		if c.UserID != userID {
+			continue
+		}
+		collection := *c
+		for _, b := range s.db.bookmarks {
+			if b.collectionID != nil && *b.collectionID == c.ID {
+				collection.BookmarkCount++
+			}
+		}
+		collections = append(collections, collection)
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		a, b := strings.ToLower(collections[i].Name), strings.ToLower(collections[j].Name)
+		if a != b {
+			return a < b
+		}
+		return collections[i].ID < collections[j].ID
+	})
+	return collections, nil
+}
+
+func (s *BookmarkStore) DeleteCollection(ctx context.Context, userID, id int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if c := s.db.collection(id); c == nil || c.UserID != userID {
+		return store.ErrNotFound
+	}
+	s.db.deleteCollections(func(c *store.BookmarkCollection) bool { return c.ID == id })
+	return nil
+}
+
+func (d *db) bookmark(userID, postID int64) *bookmark {
+	for _, b := range d.bookmarks {
+		if b.userID == userID && b.postID == postID {
+			return b
+		}
+	}
+	return nil
+}
+
+func (d *db) collection(id int64) *store.BookmarkCollection {
+	for _, c := range d.collections {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// deleteCollections removes the matching collections, their bookmarks are
+// kept without a collection like ON DELETE SET NULL does.
+func (d *db) deleteCollections(match func(*store.BookmarkCollection) bool) {
+	for _, c := range d.collections {
+		if !match(c) {
+			continue
+		}
+		for _, b := range d.bookmarks {
+			if b.collectionID != nil && *b.collectionID == c.ID {
+				b.collectionID = nil
+			}
+		}
+	}
+	d.collections = remove(d.collections, match)
+}
@@ -0,0 +1,64 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type CommentStore struct {
+	db *db
+}
+
+func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]store.Comment, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var comments []store.Comment
+	for _, c := range s.db.comments {
+		if c.PostID != postID {
+			continue
+		}
+		author := s.db.user(c.UserID)
+		if author == nil {
+			continue
+		}
+		comment := *c
+		comment.User = store.User{ID: author.ID, Username: author.Username}
+		comments = append(comments, comment)
+	}
+
+	// newest first, comments are appended in id order
+	sort.SliceStable(comments, func(i, j int) bool {
+		a, _ := time.Parse(time.RFC3339Nano, comments[i].CreatedAt)
+		b, _ := time.Parse(time.RFC3339Nano, comments[j].CreatedAt)
+		if !a.Equal(b) {
+			return a.After(b)
+		}
+		return comments[i].ID > comments[j].ID
+	})
+	return comments, nil
+}
+
+// Create doesn't check the post or the user exist, the comments table has no
+// foreign keys.
+func (s *CommentStore) Create(ctx context.Context, comment *store.Comment) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	comment.ID = s.db.nextID("comments")
+	// database/sql formats a scanned timestamp as RFC 3339 when the
+	// destination is a string
+	comment.CreatedAt = s.db.now().Format(time.RFC3339Nano)
+
+	s.db.comments = append(s.db.comments, &store.Comment{
+		ID:        comment.ID,
+		UserID:    comment.UserID,
+		PostID:    comment.PostID,
+		Content:   comment.Content,
+		CreatedAt: comment.CreatedAt,
+	})
+	return nil
+}
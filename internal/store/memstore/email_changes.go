@@ -0,0 +1,58 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+func (s *UserStore) RequestEmailChange(ctx context.Context, userID int64, newEmail, token string, exp time.Duration, emails ...*store.OutboxEmail) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.userByEmail(newEmail) != nil {
+		return store.ErrDuplicateEmail
+	}
+	if s.db.user(userID) == nil {
+		return errForeignKey
+	}
+
+	s.db.emailChanges = remove(s.db.emailChanges, func(c *emailChange) bool { return c.userID == userID })
+	s.db.emailChanges = append(s.db.emailChanges, &emailChange{
+		userID:    userID,
+		newEmail:  newEmail,
+		token:     token,
+		expiry:    s.db.clock().Add(exp).Round(time.Second),
+		createdAt: s.db.now(),
+	})
+
+	for _, email := range emails {
+		s.db.enqueueEmail(email)
+	}
+	return nil
+}
+
+func (s *UserStore) ConfirmEmailChange(ctx context.Context, token string) (*store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, c := range s.db.emailChanges {
+		if c.token != token {
+			continue
+		}
+		if !c.expiry.After(s.db.clock()) {
+			return nil, store.ErrExpired
+		}
+		if other := s.db.userByEmail(c.newEmail); other != nil && other.ID != c.userID {
+			return nil, store.ErrDuplicateEmail
+		}
+
+		u := s.db.user(c.userID)
+		u.Email = c.newEmail
+		s.db.emailChanges = remove(s.db.emailChanges, func(e *emailChange) bool { return e.userID == u.ID })
+		s.db.sessions = remove(s.db.sessions, func(s *session) bool { return s.UserID == u.ID })
+		return &store.User{ID: u.ID, Username: u.Username, Email: u.Email}, nil
+	}
+	return nil, store.ErrNotFound
+}
@@ -0,0 +1,98 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+func (s *UserStore) ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u := s.db.user(userID)
+	if u == nil {
+		return store.ErrNotFound
+	}
+	at = at.Round(time.Second)
+	u.DeletionScheduledAt = &at
+	s.db.sessions = remove(s.db.sessions, func(s *session) bool { return s.UserID == userID })
+	return nil
+}
+
+func (s *UserStore) CancelDeletion(ctx context.Context, userID int64) (bool, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u := s.db.user(userID)
+	if u == nil || u.DeletionScheduledAt == nil {
+		return false, nil
+	}
+	u.DeletionScheduledAt = nil
+	return true, nil
+}
+
+func (s *UserStore) DueForErasure(ctx context.Context, limit int) ([]int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var due []*store.User
+	for _, u := range s.db.users {
+		if s.dueForErasure(u) {
+			due = append(due, u)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].DeletionScheduledAt.Before(*due[j].DeletionScheduledAt)
+	})
+
+	var ids []int64
+	for _, u := range page(due, limit, 0) {
+		ids = append(ids, u.ID)
+	}
+	return ids, nil
+}
+
+func (s *UserStore) dueForErasure(u *store.User) bool {
+	return u.DeletionScheduledAt != nil && !u.DeletionScheduledAt.After(s.db.clock())
+}
+
+func (s *UserStore) Erase(ctx context.Context, userID int64) ([]string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u := s.db.user(userID)
+	if u == nil || !s.dueForErasure(u) {
+		return nil, store.ErrNotFound
+	}
+
+	var keys []string
+	for _, m := range s.db.media {
+		if m.UserID == userID {
+			keys = append(keys, m.StorageKey)
+		}
+	}
+	for _, e := range s.db.exports {
+		if e.UserID == userID && e.StorageKey != "" {
+			keys = append(keys, e.StorageKey)
+		}
+	}
+
+	posts := map[int64]bool{}
+	for _, p := range s.db.posts {
+		if p.UserID == userID {
+			posts[p.ID] = true
+		}
+	}
+	s.db.comments = remove(s.db.comments, func(c *store.Comment) bool { return c.UserID == userID || posts[c.PostID] })
+	s.db.deletePosts(func(p *store.Post) bool { return p.UserID == userID })
+	s.deleteInvitations(userID)
+	if err := s.db.deleteUser(userID); err != nil {
+		return nil, err
+	}
+	s.db.outbox = remove(s.db.outbox, func(e *outboxEmail) bool { return strings.EqualFold(e.Email, u.Email) })
+	return keys, nil
+}
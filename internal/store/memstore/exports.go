@@ -0,0 +1,220 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type ExportStore struct {
+	db *db
+}
+
+func (s *ExportStore) Request(ctx context.Context, userID int64) (*store.DataExport, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, e := range s.db.exports {
+		if e.UserID == userID && (e.Status == store.ExportPending || e.Status == store.ExportProcessing) {
+			return nil, store.ErrConflict
+		}
+	}
+	if s.db.user(userID) == nil {
+		return nil, errForeignKey
+	}
+
+	row := &dataExport{DataExport: store.DataExport{
+		ID:          s.db.nextID("data_exports"),
+		UserID:      userID,
+		Status:      store.ExportPending,
+		RequestedAt: s.db.now(),
+	}}
+	s.db.exports = append(s.db.exports, row)
+	return row.copy(), nil
+}
+
+func (e *dataExport) copy() *store.DataExport {
+	export := e.DataExport
+	export.CompletedAt = copyTime(e.CompletedAt)
+	export.ExpiresAt = copyTime(e.ExpiresAt)
+	return &export
+}
+
+func (d *db) export(id int64) *dataExport {
+	for _, e := range d.exports {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+func (s *ExportStore) GetByID(ctx context.Context, id int64) (*store.DataExport, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	e := s.db.export(id)
+	if e == nil {
+		return nil, store.ErrNotFound
+	}
+	return e.copy(), nil
+}
+
+func (s *ExportStore) ListByUser(ctx context.Context, userID int64) ([]store.DataExport, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	exports := []store.DataExport{}
+	for i := len(s.db.exports) - 1; i >= 0; i-- {
+		if e := s.db.exports[i]; e.UserID == userID {
+			exports = append(exports, *e.copy())
+		}
+	}
+	sort.SliceStable(exports, func(i, j int) bool { return exports[i].RequestedAt.After(exports[j].RequestedAt) })
+	return exports, nil
+}
+
+func (s *ExportStore) Claim(ctx context.Context, lease time.Duration) (*store.DataExport, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := s.db.clock()
+	var next *dataExport
+	for _, e := range s.db.exports {
+		claimable := e.Status == store.ExportPending ||
+			(e.Status == store.ExportProcessing && e.claimedUntil != nil && !e.claimedUntil.After(now))
+		if claimable && (next == nil || e.RequestedAt.Before(next.RequestedAt)) {
+			next = e
+		}
+	}
+	if next == nil {
+		return nil, store.ErrNotFound
+	}
+
+	until := now.Add(lease).Round(time.Second)
+	next.Status = store.ExportProcessing
+	next.Attempts++
+	next.claimedUntil = &until
+	return next.copy(), nil
+}
+
+func (s *ExportStore) Complete(ctx context.Context, export *store.DataExport, email *store.OutboxEmail) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	e := s.db.export(export.ID)
+	if e == nil {
+		return store.ErrNotFound
+	}
+
+	now := s.db.now()
+	e.Status = store.ExportReady
+	e.StorageKey = export.StorageKey
+	e.Size = export.Size
+	e.ExpiresAt = copyTime(export.ExpiresAt)
+	if e.ExpiresAt != nil {
+		*e.ExpiresAt = e.ExpiresAt.Round(time.Second)
+	}
+	e.CompletedAt = &now
+	e.lastErr = ""
+
+	export.CompletedAt = copyTime(&now)
+	export.Status = store.ExportReady
+	s.db.enqueueEmail(email)
+	return nil
+}
+
+func (s *ExportStore) Fail(ctx context.Context, id int64, lastErr string, dead bool) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if e := s.db.export(id); e != nil {
+		e.Status = store.ExportPending
+		if dead {
+			e.Status = store.ExportFailed
+		}
+		e.lastErr = lastErr
+		e.claimedUntil = nil
+	}
+	return nil
+}
+
+func (s *ExportStore) Expire(ctx context.Context, limit int) ([]store.DataExport, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := s.db.clock()
+	var expired []store.DataExport
+	for _, e := range s.db.exports {
+		if len(expired) == limit {
+			break
+		}
+		if e.Status == store.ExportReady && e.ExpiresAt != nil && !e.ExpiresAt.After(now) {
+			e.Status = store.ExportExpired
+			expired = append(expired, *e.copy())
+		}
+	}
+	return expired, nil
+}
+
+func (s *ExportStore) Collect(ctx context.Context, userID int64) (*store.UserData, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u := s.db.user(userID)
+	if u == nil {
+		return nil, store.ErrNotFound
+	}
+	profile := s.db.copyUser(u)
+	data := &store.UserData{Profile: &profile}
+
+	for _, p := range s.db.posts {
+		if p.UserID == userID {
+			post := *p
+			post.Tags = copyTags(p.Tags)
+			data.Posts = append(data.Posts, post)
+		}
+	}
+	for _, c := range s.db.comments {
+		if c.UserID == userID {
+			data.Comments = append(data.Comments, *c)
+		}
+	}
+
+	follows := append([]*follower(nil), s.db.followers...)
+	sort.SliceStable(follows, func(i, j int) bool { return follows[i].createdAt.Before(follows[j].createdAt) })
+	for _, f := range follows {
+		switch userID {
+		case f.followerID:
+			if other := s.db.user(f.userID); other != nil {
+				data.Following = append(data.Following, store.Follow{UserID: other.ID, Username: other.Username, CreatedAt: f.createdAt})
+			}
+		case f.userID:
+			if other := s.db.user(f.followerID); other != nil {
+				data.Followers = append(data.Followers, store.Follow{UserID: other.ID, Username: other.Username, CreatedAt: f.createdAt})
+			}
+		}
+	}
+
+	for _, m := range s.db.media {
+		if m.UserID == userID {
+			data.Media = append(data.Media, *m)
+		}
+	}
+	for _, row := range s.db.sessions {
+		if row.UserID == userID {
+			data.Sessions = append(data.Sessions, row.Session)
+		}
+	}
+
+	history := append([]*usernameChange(nil), s.db.usernames...)
+	sort.SliceStable(history, func(i, j int) bool { return history[i].changedAt.Before(history[j].changedAt) })
+	for _, h := range history {
+		if h.userID == userID {
+			data.Usernames = append(data.Usernames, store.UsernameHistory{Username: h.username, ChangedAt: h.changedAt})
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,42 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type FollowerStore struct {
+	db *db
+}
+
+func (s *FollowerStore) Follow(ctx context.Context, followerID, userID int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, f := range s.db.followers {
+		if f.userID == userID && f.followerID == followerID {
+			return store.ErrConflict
+		}
+	}
+	if s.db.user(userID) == nil || s.db.user(followerID) == nil {
+		return store.ErrNotFound
+	}
+
+	s.db.followers = append(s.db.followers, &follower{
+		userID:     userID,
+		followerID: followerID,
+		createdAt:  s.db.now(),
+	})
+	return nil
+}
+
+func (s *FollowerStore) UnFollow(ctx context.Context, followerID, userID int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.followers = remove(s.db.followers, func(f *follower) bool {
+		return f.userID == userID && f.followerID == followerID
+	})
+	return nil
+}
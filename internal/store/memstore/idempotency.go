@@ -0,0 +1,102 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type IdempotencyStore struct {
+	db *db
+}
+
+func (s *IdempotencyStore) Begin(ctx context.Context, key *store.IdempotencyKey, ttl, lease time.Duration) (*store.IdempotencyKey, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := s.db.clock()
+	row := s.find(key.Scope, key.Key)
+	if row != nil {
+		expired := !row.ExpiresAt.After(now)
+		abandoned := !row.Completed() && !row.lockedUntil.After(now) && row.Fingerprint == key.Fingerprint
+		if !expired && !abandoned {
+			existing := copyIdempotencyKey(row.IdempotencyKey)
+			return &existing, nil
+		}
+		s.db.idempotency = remove(s.db.idempotency, func(k *idempotencyKey) bool { return k == row })
+	}
+
+	key.CreatedAt = s.db.now()
+	key.ExpiresAt = now.Add(ttl).Round(time.Second)
+	s.db.idempotency = append(s.db.idempotency, &idempotencyKey{
+		IdempotencyKey: store.IdempotencyKey{
+			Scope:       key.Scope,
+			Key:         key.Key,
+			Fingerprint: key.Fingerprint,
+			CreatedAt:   key.CreatedAt,
+			ExpiresAt:   key.ExpiresAt,
+		},
+		lockedUntil: now.Add(lease).Round(time.Second),
+	})
+	return nil, nil
+}
+
+func (s *IdempotencyStore) Complete(ctx context.Context, key *store.IdempotencyKey) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	row := s.find(key.Scope, key.Key)
+	if row == nil || row.Completed() || row.Fingerprint != key.Fingerprint {
+		return store.ErrNotFound
+	}
+	completed := copyIdempotencyKey(*key)
+	row.Status = completed.Status
+	row.Header = completed.Header
+	row.Body = completed.Body
+	row.lockedUntil = time.Time{}
+	return nil
+}
+
+func (s *IdempotencyStore) Release(ctx context.Context, scope, key string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.idempotency = remove(s.db.idempotency, func(k *idempotencyKey) bool {
+		return k.Scope == scope && k.Key == key && !k.Completed()
+	})
+	return nil
+}
+
+func (s *IdempotencyStore) DeleteExpired(ctx context.Context) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	before := len(s.db.idempotency)
+	now := s.db.clock()
+	s.db.idempotency = remove(s.db.idempotency, func(k *idempotencyKey) bool { return !k.ExpiresAt.After(now) })
+	return int64(before - len(s.db.idempotency)), nil
+}
+
+func (s *IdempotencyStore) find(scope, key string) *idempotencyKey {
+	for _, k := range s.db.idempotency {
+		if k.Scope == scope && k.Key == key {
+			return k
+		}
+	}
+	return nil
+}
+
+func copyIdempotencyKey(k store.IdempotencyKey) store.IdempotencyKey {
+	if k.Header != nil {
+		header := make(map[string][]string, len(k.Header))
+		for name, values := range k.Header {
+			header[name] = append([]string(nil), values...)
+		}
+		k.Header = header
+	}
+	if k.Body != nil {
+		k.Body = append([]byte(nil), k.Body...)
+	}
+	return k
+}
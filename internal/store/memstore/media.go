@@ -0,0 +1,56 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type MediaStore struct {
+	db *db
+}
+
+func (s *MediaStore) Create(ctx context.Context, m *store.Media) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.user(m.UserID) == nil {
+		return errForeignKey
+	}
+
+	m.ID = s.db.nextID("media")
+	m.CreatedAt = s.db.now()
+
+	row := *m
+	s.db.media = append(s.db.media, &row)
+	return nil
+}
+
+func (s *MediaStore) GetByID(ctx context.Context, id int64) (*store.Media, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	m := s.db.mediaByID(id)
+	if m == nil {
+		return nil, store.ErrNotFound
+	}
+	media := *m
+	return &media, nil
+}
+
+func (d *db) mediaByID(id int64) *store.Media {
+	for _, m := range d.media {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+func (s *MediaStore) Delete(ctx context.Context, id int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.deleteMedia(id)
+	return nil
+}
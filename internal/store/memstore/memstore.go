@@ -0,0 +1,288 @@
+// Package memstore is an in-memory store.Storage for tests. It mirrors the
+// semantics of the Postgres implementation, including its errors, second
+// precision timestamps, case insensitive emails and cascading deletes, and is
+// kept in line with it by the storetest conformance suite.
+package memstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+// errForeignKey is returned where Postgres would reject a write with a
+// foreign key violation.
+var errForeignKey = errors.New("memstore: foreign key violation")
+
+// errCheck is returned where Postgres would reject a write with a check
+// constraint violation.
+var errCheck = errors.New("memstore: check constraint violation")
+
+type invitation struct {
+	token     string
+	userID    int64
+	expiry    time.Time
+	createdAt time.Time
+}
+
+type emailChange struct {
+	userID    int64
+	newEmail  string
+	token     string
+	expiry    time.Time
+	createdAt time.Time
+}
+
+type session struct {
+	token string
+	store.Session
+}
+
+type follower struct {
+	userID     int64
+	followerID int64
+	createdAt  time.Time
+}
+
+type usernameChange struct {
+	username  string
+	userID    int64
+	changedAt time.Time
+}
+
+type dataExport struct {
+	store.DataExport
+	lastErr      string
+	claimedUntil *time.Time
+}
+
+type idempotencyKey struct {
+	store.IdempotencyKey
+	lockedUntil time.Time
+}
+
+type outboxEmail struct {
+	store.OutboxEmail
+	sentAt *time.Time
+}
+
+// db holds every table. A single mutex makes each store method atomic, the
+// way the Postgres implementation uses transactions.
+type db struct {
+	mu    sync.Mutex
+	clock func() time.Time
+
+	seq map[string]int64
+
+	roles         []store.Role
+	users         []*store.User
+	invitations   []*invitation
+	emailChanges  []*emailChange
+	sessions      []*session
+	usernames     []*usernameChange
+	media         []*store.Media
+	posts         []*store.Post
+	bookmarks     []*bookmark
+	collections   []*store.BookmarkCollection
+	tags          []*store.Tag
+	postTags      []postTag
+	mentions      []*mention
+	trendingTags  []*trendingTag
+	trendingPosts []*trendingPost
+	comments      []*store.Comment
+	followers     []*follower
+	blocks        []*block
+	suggestions   []*followSuggestion
+	dismissals    []*dismissal
+	exports       []*dataExport
+	outbox        []*outboxEmail
+	idempotency   []*idempotencyKey
+}
+
+// New returns an empty storage seeded with the default roles. clock is used
+// wherever Postgres would call NOW(), nil means time.Now.
+func New(clock func() time.Time) store.Storage {
+	if clock == nil {
+		clock = time.Now
+	}
+	d := &db{
+		clock: clock,
+		seq:   map[string]int64{},
+		roles: []store.Role{
+			{ID: 1, Name: "user", Level: 1, Description: "A user can create posts and comments"},
+			{ID: 2, Name: "moderator", Level: 2, Description: "A moderator can update other users posts"},
+			{ID: 3, Name: "admin", Level: 3, Description: "An admin can update and delete other users posts"},
+		},
+	}
+	d.seq["roles"] = 3
+
+	return store.Storage{
+		Posts:       &PostStore{db: d},
+		Bookmarks:   &BookmarkStore{db: d},
+		Tags:        &TagStore{db: d},
+		Trending:    &TrendingStore{db: d},
+		Users:       &UserStore{db: d},
+		Sessions:    &SessionStore{db: d},
+		Media:       &MediaStore{db: d},
+		Exports:     &ExportStore{db: d},
+		Comments:    &CommentStore{db: d},
+		Followers:   &FollowerStore{db: d},
+		Blocks:      &BlockStore{db: d},
+		Suggestions: &SuggestionStore{db: d},
+		Roles:       &RoleStore{db: d},
+		Stats:       &StatsStore{db: d},
+		Outbox:      &OutboxStore{db: d},
+		Idempotency: &IdempotencyStore{db: d},
+	}
+}
+
+// now returns the current time at the precision of a timestamp(0) column.
+func (d *db) now() time.Time {
+	return d.clock().Round(time.Second)
+}
+
+func (d *db) nextID(table string) int64 {
+	d.seq[table]++
+	return d.seq[table]
+}
+
+func (d *db) user(id int64) *store.User {
+	for _, u := range d.users {
+		if u.ID == id {
+			return u
+		}
+	}
+	return nil
+}
+
+func (d *db) userByEmail(email string) *store.User {
+	for _, u := range d.users {
+		if strings.EqualFold(u.Email, email) {
+			return u
+		}
+	}
+	return nil
+}
+
+func (d *db) role(id int64) *store.Role {
+	for i := range d.roles {
+		if d.roles[i].ID == id {
+			return &d.roles[i]
+		}
+	}
+	return nil
+}
+
+// deleteUser removes a user and the rows referencing it with ON DELETE
+// CASCADE. Posts have no cascading key, so a user with posts can't be
+// deleted.
+func (d *db) deleteUser(id int64) error {
+	for _, p := range d.posts {
+		if p.UserID == id {
+			return errForeignKey
+		}
+	}
+
+	d.users = remove(d.users, func(u *store.User) bool { return u.ID == id })
+	d.sessions = remove(d.sessions, func(s *session) bool { return s.UserID == id })
+	d.emailChanges = remove(d.emailChanges, func(c *emailChange) bool { return c.userID == id })
+	d.usernames = remove(d.usernames, func(h *usernameChange) bool { return h.userID == id })
+	d.followers = remove(d.followers, func(f *follower) bool { return f.userID == id || f.followerID == id })
+	d.blocks = remove(d.blocks, func(b *block) bool { return b.blockerID == id || b.blockedID == id })
+	d.bookmarks = remove(d.bookmarks, func(b *bookmark) bool { return b.userID == id })
+	d.deleteCollections(func(c *store.BookmarkCollection) bool { return c.UserID == id })
+	d.suggestions = remove(d.suggestions, func(fs *followSuggestion) bool { return fs.userID == id || fs.suggested.UserID == id })
+	d.dismissals = remove(d.dismissals, func(ds *dismissal) bool { return ds.userID == id || ds.suggestedID == id })
+	d.mentions = remove(d.mentions, func(m *mention) bool { return m.userID == id })
+	d.exports = remove(d.exports, func(e *dataExport) bool { return e.UserID == id })
+	d.media = remove(d.media, func(m *store.Media) bool { return m.UserID == id })
+	return nil
+}
+
+// deleteMedia removes a media row, avatars pointing to it are cleared like
+// ON DELETE SET NULL does.
+func (d *db) deleteMedia(id int64) {
+	d.media = remove(d.media, func(m *store.Media) bool { return m.ID == id })
+	for _, u := range d.users {
+		if u.AvatarID != nil && *u.AvatarID == id {
+			u.AvatarID = nil
+		}
+	}
+}
+
+func (d *db) enqueueEmail(email *store.OutboxEmail) {
+	email.ID = d.nextID("email_outbox")
+	email.Status = store.OutboxPending
+	email.NextAttemptAt = d.clock().Truncate(time.Second)
+	email.CreatedAt = d.now()
+
+	row := &outboxEmail{OutboxEmail: *email}
+	row.Data = append([]byte(nil), email.Data...)
+	row.Attempts = 0
+	row.LastError = ""
+	d.outbox = append(d.outbox, row)
+}
+
+func remove[T any](rows []T, match func(T) bool) []T {
+	kept := rows[:0]
+	for _, row := range rows {
+		if !match(row) {
+			kept = append(kept, row)
+		}
+	}
+	clear(rows[len(kept):])
+	return kept
+}
+
+// ilike matches like ILIKE '%' || substr || '%'.
+func ilike(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// page applies LIMIT and OFFSET.
+func page[T any](rows []T, limit, offset int) []T {
+	if offset >= len(rows) {
+		return nil
+	}
+	rows = rows[offset:]
+	if limit < len(rows) {
+		rows = rows[:limit]
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return rows
+}
+
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	c := *t
+	return &c
+}
+
+func copyID(id *int64) *int64 {
+	if id == nil {
+		return nil
+	}
+	c := *id
+	return &c
+}
+
+func copyTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	return append([]string{}, tags...)
+}
@@ -0,0 +1,15 @@
+package memstore_test
+
+import (
+	"testing"
+
+	"github.com/igorzinar/goSocial/internal/store"
+	"github.com/igorzinar/goSocial/internal/store/memstore"
+	"github.com/igorzinar/goSocial/internal/store/storetest"
+)
+
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Storage {
+		return memstore.New(nil)
+	})
+}
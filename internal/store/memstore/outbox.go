@@ -0,0 +1,82 @@
+package memstore
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type OutboxStore struct {
+	db *db
+}
+
+func (s *OutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]store.OutboxEmail, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := s.db.clock()
+	var due []*outboxEmail
+	for _, e := range s.db.outbox {
+		if e.Status == store.OutboxPending && !e.NextAttemptAt.After(now) {
+			due = append(due, e)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+
+	var emails []store.OutboxEmail
+	for _, e := range page(due, limit, 0) {
+		e.Attempts++
+		e.NextAttemptAt = now.Add(lease).Round(time.Second)
+
+		email := e.OutboxEmail
+		email.Data = append([]byte(nil), e.Data...)
+		emails = append(emails, email)
+	}
+	return emails, nil
+}
+
+func (s *OutboxStore) MarkSent(ctx context.Context, id int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, e := range s.db.outbox {
+		if e.ID == id {
+			now := s.db.now()
+			e.Status = store.OutboxSent
+			e.sentAt = &now
+			e.Data = []byte("{}")
+			e.LastError = ""
+		}
+	}
+	return nil
+}
+
+func (s *OutboxStore) MarkFailed(ctx context.Context, id int64, lastErr string, nextAttemptAt time.Time, dead bool) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, e := range s.db.outbox {
+		if e.ID == id {
+			e.Status = store.OutboxPending
+			if dead {
+				e.Status = store.OutboxDead
+			}
+			e.LastError = lastErr
+			e.NextAttemptAt = nextAttemptAt.Round(time.Second)
+		}
+	}
+	return nil
+}
+
+func (s *OutboxStore) DeleteSent(ctx context.Context, sentBefore time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	before := len(s.db.outbox)
+	s.db.outbox = remove(s.db.outbox, func(e *outboxEmail) bool {
+		return e.Status == store.OutboxSent && e.sentAt != nil && !e.sentAt.After(sentBefore)
+	})
+	return int64(before - len(s.db.outbox)), nil
+}
@@ -0,0 +1,313 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type PostStore struct {
+	db *db
+}
+
+func (s *PostStore) Create(ctx context.Context, post *store.Post, notify store.MentionNotifier) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.user(post.UserID) == nil {
+		return errForeignKey
+	}
+
+	now := s.db.now()
+	post.ID = s.db.nextID("posts")
+	post.CreatedAt = now
+	post.UpdatedAt = now
+
+	// notify runs first, its failure rolls everything back
+	mentioned, emails, err := s.db.mentionEmails(post, notify)
+	if err != nil {
+		return err
+	}
+	s.db.posts = append(s.db.posts, &store.Post{
+		ID:        post.ID,
+		Content:   post.Content,
+		Title:     post.Title,
+		UserID:    post.UserID,
+		Tags:      copyTags(post.Tags),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	s.db.linkTags(post)
+	s.db.linkMentions(post, mentioned, emails)
+	return nil
+}
+
+func (s *PostStore) GetByID(ctx context.Context, id int64) (*store.Post, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	p := s.db.post(id)
+	if p == nil {
+		return nil, store.ErrNotFound
+	}
+	post := *p
+	post.Tags = copyTags(p.Tags)
+	post.Mentions = s.db.mentionUsernames(p.ID)
+	return &post, nil
+}
+
+func (d *db) post(id int64) *store.Post {
+	for _, p := range d.posts {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+// Delete leaves the comments of the post behind, comments have no foreign
+// key in the schema.
+func (s *PostStore) Delete(ctx context.Context, id int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.post(id) == nil {
+		return store.ErrNotFound
+	}
+	s.db.deletePosts(func(p *store.Post) bool { return p.ID == id })
+	return nil
+}
+
+// Update only applies when post.Version is the stored version, a stale
+// version is reported as ErrNotFound.
+func (s *PostStore) Update(ctx context.Context, post *store.Post, notify store.MentionNotifier) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	p := s.db.post(post.ID)
+	if p == nil || p.Version != post.Version {
+		return store.ErrNotFound
+	}
+	updated := *post
+	updated.Version++
+	mentioned, emails, err := s.db.mentionEmails(&updated, notify)
+	if err != nil {
+		return err
+	}
+
+	p.Title = post.Title
+	p.Content = post.Content
+	p.Tags = copyTags(post.Tags)
+	p.Version++
+	post.Version = p.Version
+	s.db.linkTags(post)
+	s.db.linkMentions(post, mentioned, emails)
+	return nil
+}
+
+func (s *PostStore) GetUserFeed(ctx context.Context, id int64, fq store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	followed := map[int64]bool{id: true}
+	for _, f := range s.db.followers {
+		if f.followerID == id {
+			followed[f.userID] = true
+		}
+	}
+
+	var feed []store.PostWithMetadata
+	for _, p := range s.db.posts {
+		if !followed[p.UserID] {
+			continue
+		}
+		if !ilike(p.Title, fq.Search) && !ilike(p.Content, fq.Search) {
+			continue
+		}
+		if !containsAll(p.Tags, fq.Tags) {
+			continue
+		}
+		if item, ok := s.db.postWithMetadata(p); ok {
+			item.Bookmarked = s.db.bookmark(id, p.ID) != nil
+			feed = append(feed, item)
+		}
+	}
+	return sortFeed(feed, fq), nil
+}
+
+func (s *PostStore) GetFeedCandidates(ctx context.Context, id int64, at time.Time, fq store.PaginatedFeedQuery, limit int) ([]store.FeedCandidate, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	degrees := map[int64]int{id: 0}
+	for _, f := range s.db.followers {
+		if f.followerID == id && !f.createdAt.After(at) {
+			if _, ok := degrees[f.userID]; !ok {
+				degrees[f.userID] = 1
+			}
+		}
+	}
+	for _, f := range s.db.followers {
+		if degrees[f.followerID] == 1 && !f.createdAt.After(at) {
+			if _, ok := degrees[f.userID]; !ok {
+				degrees[f.userID] = 2
+			}
+		}
+	}
+
+	// the posts the viewer commented on, and how often per author
+	commented := map[int64]bool{}
+	affinity := map[int64]int{}
+	for _, c := range s.db.comments {
+		createdAt, _ := time.Parse(time.RFC3339Nano, c.CreatedAt)
+		if c.UserID != id || createdAt.After(at) {
+			continue
+		}
+		commented[c.PostID] = true
+		if p := s.db.post(c.PostID); p != nil {
+			affinity[p.UserID]++
+		}
+	}
+	for _, m := range s.db.mentions {
+		if p := s.db.post(m.postID); p != nil && p.UserID == id && !m.createdAt.After(at) {
+			affinity[m.userID]++
+		}
+	}
+
+	interests := map[int64]bool{}
+	for _, pt := range s.db.postTags {
+		p := s.db.post(pt.postID)
+		if p != nil && !p.CreatedAt.After(at) && (p.UserID == id || commented[p.ID]) {
+			interests[pt.tagID] = true
+		}
+	}
+
+	var candidates []store.FeedCandidate
+	for _, p := range s.db.posts {
+		degree, ok := degrees[p.UserID]
+		if !ok || p.CreatedAt.After(at) {
+			continue
+		}
+		if !ilike(p.Title, fq.Search) && !ilike(p.Content, fq.Search) {
+			continue
+		}
+		if !containsAll(p.Tags, fq.Tags) {
+			continue
+		}
+		item, ok := s.db.postWithMetadata(p)
+		if !ok {
+			continue
+		}
+		// comments made after the snapshot don't count
+		item.CommentCount = 0
+		for _, c := range s.db.comments {
+			createdAt, _ := time.Parse(time.RFC3339Nano, c.CreatedAt)
+			if c.PostID == p.ID && !createdAt.After(at) {
+				item.CommentCount++
+			}
+		}
+		item.Bookmarked = s.db.bookmark(id, p.ID) != nil
+		c := store.FeedCandidate{PostWithMetadata: item, Degree: degree, Affinity: affinity[p.UserID]}
+		for _, pt := range s.db.postTags {
+			if pt.postID == p.ID && interests[pt.tagID] {
+				c.TagOverlap++
+			}
+		}
+		candidates = append(candidates, c)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.ID > b.ID
+	})
+	return page(candidates, limit, 0), nil
+}
+
+func (s *PostStore) GetByTag(ctx context.Context, tag string, fq store.PaginatedFeedQuery) ([]store.PostWithMetadata, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	t := s.db.tag(tag)
+	if t == nil {
+		return nil, nil
+	}
+	tagged := map[int64]bool{}
+	for _, pt := range s.db.postTags {
+		if pt.tagID == t.ID {
+			tagged[pt.postID] = true
+		}
+	}
+
+	var feed []store.PostWithMetadata
+	for _, p := range s.db.posts {
+		if !tagged[p.ID] {
+			continue
+		}
+		if !ilike(p.Title, fq.Search) && !ilike(p.Content, fq.Search) {
+			continue
+		}
+		if !containsAll(p.Tags, fq.Tags) {
+			continue
+		}
+		if item, ok := s.db.postWithMetadata(p); ok {
+			feed = append(feed, item)
+		}
+	}
+	return sortFeed(feed, fq), nil
+}
+
+// postWithMetadata joins a post with its author and comment count, it
+// reports false for the posts of a missing author like the inner join does.
+func (d *db) postWithMetadata(p *store.Post) (store.PostWithMetadata, bool) {
+	author := d.user(p.UserID)
+	if author == nil {
+		return store.PostWithMetadata{}, false
+	}
+
+	item := store.PostWithMetadata{Post: store.Post{
+		ID:        p.ID,
+		UserID:    p.UserID,
+		Title:     p.Title,
+		Content:   p.Content,
+		CreatedAt: p.CreatedAt,
+		Version:   p.Version,
+		Tags:      copyTags(p.Tags),
+	}}
+	item.User.Username = author.Username
+	for _, c := range d.comments {
+		if c.PostID == p.ID {
+			item.CommentCount++
+		}
+	}
+	return item, true
+}
+
+// sortFeed applies the ORDER BY, LIMIT and OFFSET of the feed queries.
+func sortFeed(feed []store.PostWithMetadata, fq store.PaginatedFeedQuery) []store.PostWithMetadata {
+	desc := strings.EqualFold(fq.Sort, "desc")
+	sort.SliceStable(feed, func(i, j int) bool {
+		a, b := feed[i], feed[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt) != desc
+		}
+		return (a.ID < b.ID) != desc
+	})
+	return page(feed, fq.Limit, fq.Offset)
+}
+
+// containsAll matches like tags @> want, an empty want matches everything.
+func containsAll(tags, want []string) bool {
+	for _, t := range want {
+		if !slices.Contains(tags, t) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+func (s *UserStore) UpdateProfile(ctx context.Context, user *store.User, cooldown time.Duration) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u := s.db.user(user.ID)
+	if u == nil {
+		return store.ErrNotFound
+	}
+
+	if user.Username != u.Username {
+		if u.UsernameChangedAt != nil && s.db.clock().Sub(*u.UsernameChangedAt) < cooldown {
+			return store.ErrUsernameCooldown
+		}
+		if s.usernameTaken(user.Username, u.ID) {
+			return store.ErrDuplicateUsername
+		}
+
+		now := s.db.now()
+		s.db.usernames = remove(s.db.usernames, func(h *usernameChange) bool {
+			return h.username == u.Username && h.userID == u.ID
+		})
+		s.db.usernames = append(s.db.usernames, &usernameChange{username: u.Username, userID: u.ID, changedAt: now})
+		user.UsernameChangedAt = &now
+	}
+
+	u.Username = user.Username
+	u.DisplayName = user.DisplayName
+	u.Bio = user.Bio
+	u.Website = user.Website
+	u.Location = user.Location
+	u.PreferredLocale = user.PreferredLocale
+	u.UsernameChangedAt = copyTime(user.UsernameChangedAt)
+	return nil
+}
+
+func (s *UserStore) ResolveUsername(ctx context.Context, username string) (string, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var latest *usernameChange
+	for _, h := range s.db.usernames {
+		if h.username == username && (latest == nil || !h.changedAt.Before(latest.changedAt)) {
+			latest = h
+		}
+	}
+	if latest == nil {
+		return "", store.ErrNotFound
+	}
+	return s.db.user(latest.userID).Username, nil
+}
+
+func (s *UserStore) SetAvatar(ctx context.Context, userID int64, mediaID *int64) (*int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u := s.db.user(userID)
+	if u == nil {
+		return nil, store.ErrNotFound
+	}
+	if mediaID != nil && s.db.mediaByID(*mediaID) == nil {
+		return nil, errForeignKey
+	}
+
+	previous := u.AvatarID
+	u.AvatarID = copyID(mediaID)
+	return previous, nil
+}
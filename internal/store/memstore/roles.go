@@ -0,0 +1,24 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type RoleStore struct {
+	db *db
+}
+
+func (s *RoleStore) GetByName(ctx context.Context, name string) (*store.Role, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, r := range s.db.roles {
+		if r.Name == name {
+			role := r
+			return &role, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
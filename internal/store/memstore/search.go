@@ -0,0 +1,94 @@
+package memstore
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+// similarityThreshold is the default pg_trgm.similarity_threshold used by %.
+const similarityThreshold = 0.3
+
+func (s *UserStore) Search(ctx context.Context, q store.UserSearchQuery) ([]store.UserSearchResult, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	prefix := strings.ToLower(q.Query)
+	var results []store.UserSearchResult
+	for _, u := range s.db.users {
+		if !u.IsActive || u.DeletionScheduledAt != nil || s.db.blocked(q.ViewerID, u.ID) {
+			continue
+		}
+		sml := max(similarity(u.Username, q.Query), similarity(u.DisplayName, q.Query))
+		match := strings.HasPrefix(strings.ToLower(u.Username), prefix) ||
+			strings.HasPrefix(strings.ToLower(u.DisplayName), prefix)
+		if !match && (q.Autocomplete || sml < similarityThreshold) {
+			continue
+		}
+
+		r := store.UserSearchResult{
+			ID:          u.ID,
+			Username:    u.Username,
+			DisplayName: u.DisplayName,
+			AvatarID:    copyID(u.AvatarID),
+			Following:   s.db.follows(q.ViewerID, u.ID),
+			FollowsYou:  s.db.follows(u.ID, q.ViewerID),
+		}
+		for _, f := range s.db.followers {
+			if f.userID == u.ID {
+				r.FollowerCount++
+			}
+		}
+		r.Score = sml + store.SearchPopularityBoost*math.Log(1+float64(r.FollowerCount))
+		if r.Following {
+			r.Score += store.SearchFollowingBoost
+		}
+		if r.FollowsYou {
+			r.Score += store.SearchFollowerBoost
+		}
+		results = append(results, r)
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Username < results[j].Username
+	})
+	return page(results, q.Limit, 0), nil
+}
+
+// similarity mirrors pg_trgm's similarity, in its single precision.
+func similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	shared := 0
+	for t := range ta {
+		if tb[t] {
+			shared++
+		}
+	}
+	return float64(float32(shared) / float32(len(ta)+len(tb)-shared))
+}
+
+// trigrams mirrors pg_trgm's show_trgm: the lowercased alphanumeric words,
+// padded with two spaces before and one after, cut into three runes.
+func trigrams(s string) map[string]bool {
+	set := map[string]bool{}
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		padded := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,51 @@
+package memstore
+
+import (
+	"context"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type SessionStore struct {
+	db *db
+}
+
+func (s *SessionStore) Create(ctx context.Context, userID int64, token string, exp time.Duration) (*store.Session, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.user(userID) == nil {
+		return nil, errForeignKey
+	}
+
+	row := &session{token: token, Session: store.Session{
+		UserID:    userID,
+		Expiry:    s.db.clock().Add(exp).Round(time.Second),
+		CreatedAt: s.db.now(),
+	}}
+	s.db.sessions = append(s.db.sessions, row)
+
+	created := row.Session
+	return &created, nil
+}
+
+func (s *SessionStore) GetUserID(ctx context.Context, token string) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, row := range s.db.sessions {
+		if row.token == token && row.Expiry.After(s.db.clock()) {
+			return row.UserID, nil
+		}
+	}
+	return 0, store.ErrNotFound
+}
+
+func (s *SessionStore) Delete(ctx context.Context, token string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	s.db.sessions = remove(s.db.sessions, func(row *session) bool { return row.token == token })
+	return nil
+}
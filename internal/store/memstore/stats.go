@@ -0,0 +1,34 @@
+package memstore
+
+import (
+	"context"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type StatsStore struct {
+	db *db
+}
+
+// Tables reports the exact row count of every table, the store has no dead
+// rows and no on disk size.
+func (s *StatsStore) Tables(ctx context.Context) ([]store.TableStat, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	// ordered by name like pg_stat_user_tables
+	return []store.TableStat{
+		{Name: "comments", LiveRows: int64(len(s.db.comments))},
+		{Name: "data_exports", LiveRows: int64(len(s.db.exports))},
+		{Name: "email_changes", LiveRows: int64(len(s.db.emailChanges))},
+		{Name: "email_outbox", LiveRows: int64(len(s.db.outbox))},
+		{Name: "followers", LiveRows: int64(len(s.db.followers))},
+		{Name: "media", LiveRows: int64(len(s.db.media))},
+		{Name: "posts", LiveRows: int64(len(s.db.posts))},
+		{Name: "roles", LiveRows: int64(len(s.db.roles))},
+		{Name: "sessions", LiveRows: int64(len(s.db.sessions))},
+		{Name: "user_invitations", LiveRows: int64(len(s.db.invitations))},
+		{Name: "username_history", LiveRows: int64(len(s.db.usernames))},
+		{Name: "users", LiveRows: int64(len(s.db.users))},
+	}, nil
+}
@@ -0,0 +1,193 @@
+package memstore
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type followSuggestion struct {
+	userID     int64
+	suggested  store.Suggestion
+	computedAt time.Time
+}
+
+type dismissal struct {
+	userID      int64
+	suggestedID int64
+	createdAt   time.Time
+}
+
+type SuggestionStore struct {
+	db *db
+}
+
+func (s *SuggestionStore) List(ctx context.Context, userID int64, limit int) ([]store.Suggestion, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var suggestions []store.Suggestion
+	for _, fs := range s.db.suggestions {
+		if fs.userID != userID || !s.db.suggestible(userID, fs.suggested.UserID) {
+			continue
+		}
+		suggestion := fs.suggested
+		suggestion.Username = s.db.user(suggestion.UserID).Username
+		suggestion.Reasons = copyTags(suggestion.Reasons)
+		suggestions = append(suggestions, suggestion)
+	}
+	if len(suggestions) > 0 {
+		return page(sortSuggestions(suggestions), limit, 0), nil
+	}
+	return s.db.computeSuggestions(userID, limit), nil
+}
+
+func (s *SuggestionStore) Precompute(ctx context.Context, minFollowing, limit int) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	following := map[int64]int{}
+	for _, f := range s.db.followers {
+		following[f.followerID]++
+	}
+	s.db.suggestions = remove(s.db.suggestions, func(fs *followSuggestion) bool { return following[fs.userID] < minFollowing })
+	var count int64
+	for userID, n := range following {
+		if n < minFollowing {
+			continue
+		}
+		s.db.suggestions = remove(s.db.suggestions, func(fs *followSuggestion) bool { return fs.userID == userID })
+		for _, suggestion := range s.db.computeSuggestions(userID, limit) {
+			s.db.suggestions = append(s.db.suggestions, &followSuggestion{userID: userID, suggested: suggestion, computedAt: s.db.now()})
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (s *SuggestionStore) Dismiss(ctx context.Context, userID, suggestedID int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if s.db.user(suggestedID) == nil {
+		return store.ErrNotFound
+	}
+	if s.db.user(userID) == nil {
+		return errForeignKey
+	}
+	if !s.db.dismissed(userID, suggestedID) {
+		s.db.dismissals = append(s.db.dismissals, &dismissal{userID: userID, suggestedID: suggestedID, createdAt: s.db.now()})
+	}
+	return nil
+}
+
+func (d *db) dismissed(userID, suggestedID int64) bool {
+	return slices.ContainsFunc(d.dismissals, func(ds *dismissal) bool { return ds.userID == userID && ds.suggestedID == suggestedID })
+}
+
+func (d *db) follows(followerID, userID int64) bool {
+	return slices.ContainsFunc(d.followers, func(f *follower) bool { return f.followerID == followerID && f.userID == userID })
+}
+
+// suggestible reports whether suggestedID can be suggested to userID: not
+// itself, active, not leaving, not followed, not dismissed and not blocked.
+func (d *db) suggestible(userID, suggestedID int64) bool {
+	u := d.user(suggestedID)
+	return u != nil && u.ID != userID && u.IsActive && u.DeletionScheduledAt == nil &&
+		!d.follows(userID, suggestedID) && !d.dismissed(userID, suggestedID) && !d.blocked(userID, suggestedID)
+}
+
+// computeSuggestions mirrors the suggestions query.
+func (d *db) computeSuggestions(userID int64, limit int) []store.Suggestion {
+	scores := map[int64]float64{}
+	reasons := map[int64][]string{}
+	add := func(id int64, reason string, score float64) {
+		scores[id] += score
+		reasons[id] = append(reasons[id], reason)
+	}
+
+	friends := map[int64]int{}
+	for _, f := range d.followers {
+		if d.follows(userID, f.followerID) {
+			friends[f.userID]++
+		}
+	}
+	for id, n := range friends {
+		add(id, store.SuggestionFriendsOfFriends, store.SuggestionFriendWeight*float64(n))
+	}
+
+	commented := map[int64]bool{}
+	for _, c := range d.comments {
+		if c.UserID == userID {
+			commented[c.PostID] = true
+		}
+	}
+	interests := map[int64]bool{}
+	for _, pt := range d.postTags {
+		if p := d.post(pt.postID); p != nil && (p.UserID == userID || commented[p.ID]) {
+			interests[pt.tagID] = true
+		}
+	}
+	sharedTags := map[int64]map[int64]bool{}
+	for _, pt := range d.postTags {
+		p := d.post(pt.postID)
+		if p == nil || !interests[pt.tagID] {
+			continue
+		}
+		if sharedTags[p.UserID] == nil {
+			sharedTags[p.UserID] = map[int64]bool{}
+		}
+		sharedTags[p.UserID][pt.tagID] = true
+	}
+	for id, tags := range sharedTags {
+		add(id, store.SuggestionSharedTags, store.SuggestionTagWeight*float64(len(tags)))
+	}
+
+	followerCounts := map[int64]int{}
+	for _, f := range d.followers {
+		followerCounts[f.userID]++
+	}
+	popular := make([]int64, 0, len(followerCounts))
+	for id := range followerCounts {
+		popular = append(popular, id)
+	}
+	sort.Slice(popular, func(i, j int) bool {
+		a, b := popular[i], popular[j]
+		if followerCounts[a] != followerCounts[b] {
+			return followerCounts[a] > followerCounts[b]
+		}
+		return a < b
+	})
+	for _, id := range page(popular, store.SuggestionPopularPool, 0) {
+		add(id, store.SuggestionPopular, store.SuggestionPopularityWeight*math.Log(1+float64(followerCounts[id])))
+	}
+
+	var suggestions []store.Suggestion
+	for id, score := range scores {
+		if !d.suggestible(userID, id) {
+			continue
+		}
+		sort.Strings(reasons[id])
+		suggestions = append(suggestions, store.Suggestion{
+			UserID:   id,
+			Username: d.user(id).Username,
+			Score:    score,
+			Reasons:  reasons[id],
+		})
+	}
+	return page(sortSuggestions(suggestions), limit, 0)
+}
+
+func sortSuggestions(suggestions []store.Suggestion) []store.Suggestion {
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].UserID < suggestions[j].UserID
+	})
+	return suggestions
+}
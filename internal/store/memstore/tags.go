@@ -0,0 +1,194 @@
+package memstore
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type postTag struct {
+	postID int64
+	tagID  int64
+}
+
+type mention struct {
+	postID    int64
+	userID    int64
+	createdAt time.Time
+}
+
+type TagStore struct {
+	db *db
+}
+
+func (s *TagStore) GetByName(ctx context.Context, name string) (*store.Tag, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	t := s.db.tag(name)
+	if t == nil || s.db.tagPostCount(t.ID) == 0 {
+		return nil, store.ErrNotFound
+	}
+	tag := *t
+	tag.PostCount = s.db.tagPostCount(t.ID)
+	return &tag, nil
+}
+
+func (s *TagStore) Search(ctx context.Context, prefix string, limit int) ([]store.Tag, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var tags []store.Tag
+	for _, t := range s.db.tags {
+		if !strings.HasPrefix(t.Name, prefix) {
+			continue
+		}
+		tag := *t
+		tag.PostCount = s.db.tagPostCount(t.ID)
+		if tag.PostCount > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].PostCount != tags[j].PostCount {
+			return tags[i].PostCount > tags[j].PostCount
+		}
+		return tags[i].Name < tags[j].Name
+	})
+	return page(tags, limit, 0), nil
+}
+
+func (d *db) tag(name string) *store.Tag {
+	for _, t := range d.tags {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (d *db) tagByID(id int64) *store.Tag {
+	for _, t := range d.tags {
+		if t.ID == id {
+			return t
+		}
+	}
+	return nil
+}
+
+// tagPostCount counts the posts of a tag, what the post_tags trigger keeps
+// in tags.post_count.
+func (d *db) tagPostCount(id int64) int64 {
+	var count int64
+	for _, pt := range d.postTags {
+		if pt.tagID == id {
+			count++
+		}
+	}
+	return count
+}
+
+// linkTags makes the tags of a post match post.Tags, creating the missing
+// tags.
+func (d *db) linkTags(post *store.Post) {
+	d.postTags = remove(d.postTags, func(pt postTag) bool { return pt.postID == post.ID })
+	for _, name := range post.Tags {
+		t := d.tag(name)
+		if t == nil {
+			t = &store.Tag{ID: d.nextID("tags"), Name: name, CreatedAt: d.now()}
+			d.tags = append(d.tags, t)
+		}
+		if !slices.Contains(d.postTags, postTag{post.ID, t.ID}) {
+			d.postTags = append(d.postTags, postTag{post.ID, t.ID})
+		}
+	}
+}
+
+// mentionEmails resolves post.Mentions to active users and returns them with
+// the notifications of the newly mentioned ones but the author. Nothing is
+// written, so a failing notify leaves the tables untouched.
+func (d *db) mentionEmails(post *store.Post, notify store.MentionNotifier) ([]*store.User, []*store.OutboxEmail, error) {
+	var mentioned []*store.User
+	for _, u := range d.users {
+		if u.IsActive && slices.Contains(post.Mentions, u.Username) {
+			mentioned = append(mentioned, u)
+		}
+	}
+	sort.Slice(mentioned, func(i, j int) bool { return mentioned[i].Username < mentioned[j].Username })
+
+	var added []store.User
+	usernames := []string{}
+	for _, u := range mentioned {
+		usernames = append(usernames, u.Username)
+		if u.ID != post.UserID && !d.mentioned(post.ID, u.ID) {
+			added = append(added, store.User{ID: u.ID, Username: u.Username, Email: u.Email, PreferredLocale: u.PreferredLocale})
+		}
+	}
+	if notify == nil || len(added) == 0 {
+		return mentioned, nil, nil
+	}
+
+	notified := *post
+	notified.Mentions = usernames
+	emails, err := notify(&notified, added)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mentioned, emails, nil
+}
+
+// linkMentions makes the mentions of a post match mentioned, enqueues emails
+// and sets post.Mentions to the linked usernames.
+func (d *db) linkMentions(post *store.Post, mentioned []*store.User, emails []*store.OutboxEmail) {
+	d.mentions = remove(d.mentions, func(m *mention) bool {
+		return m.postID == post.ID && !slices.ContainsFunc(mentioned, func(u *store.User) bool { return u.ID == m.userID })
+	})
+	for _, u := range mentioned {
+		if !d.mentioned(post.ID, u.ID) {
+			d.mentions = append(d.mentions, &mention{postID: post.ID, userID: u.ID, createdAt: d.now()})
+		}
+	}
+	for _, email := range emails {
+		d.enqueueEmail(email)
+	}
+	post.Mentions = d.mentionUsernames(post.ID)
+}
+
+func (d *db) mentioned(postID, userID int64) bool {
+	return slices.ContainsFunc(d.mentions, func(m *mention) bool { return m.postID == postID && m.userID == userID })
+}
+
+// mentionUsernames returns the usernames mentioned by a post, sorted.
+func (d *db) mentionUsernames(postID int64) []string {
+	usernames := []string{}
+	for _, m := range d.mentions {
+		if m.postID != postID {
+			continue
+		}
+		if u := d.user(m.userID); u != nil {
+			usernames = append(usernames, u.Username)
+		}
+	}
+	sort.Strings(usernames)
+	return usernames
+}
+
+// deletePosts removes the matching posts with their tags, mentions and
+// trending rows, which reference them with ON DELETE CASCADE.
+func (d *db) deletePosts(match func(*store.Post) bool) {
+	deleted := map[int64]bool{}
+	for _, p := range d.posts {
+		if match(p) {
+			deleted[p.ID] = true
+		}
+	}
+	d.posts = remove(d.posts, match)
+	d.postTags = remove(d.postTags, func(pt postTag) bool { return deleted[pt.postID] })
+	d.mentions = remove(d.mentions, func(m *mention) bool { return deleted[m.postID] })
+	d.trendingPosts = remove(d.trendingPosts, func(t *trendingPost) bool { return deleted[t.postID] })
+	d.bookmarks = remove(d.bookmarks, func(b *bookmark) bool { return deleted[b.postID] })
+}
@@ -0,0 +1,119 @@
+package memstore
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type trendingTag struct {
+	tagID      int64
+	score      float64
+	computedAt time.Time
+}
+
+type trendingPost struct {
+	postID     int64
+	score      float64
+	computedAt time.Time
+}
+
+type TrendingStore struct {
+	db *db
+}
+
+func (s *TrendingStore) Compute(ctx context.Context, params store.TrendingParams) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := s.db.now()
+	since := now.Add(-params.Window)
+	weigh := func(weight float64, createdAt time.Time) float64 {
+		age := max(now.Sub(createdAt).Seconds(), 0)
+		return weight * math.Pow(0.5, age/params.HalfLife.Seconds())
+	}
+
+	postScores := map[int64]float64{}
+	for _, p := range s.db.posts {
+		if p.CreatedAt.After(since) {
+			postScores[p.ID] += weigh(store.TrendingPostWeight, p.CreatedAt)
+		}
+	}
+	for _, c := range s.db.comments {
+		createdAt, _ := time.Parse(time.RFC3339Nano, c.CreatedAt)
+		if createdAt.After(since) && s.db.post(c.PostID) != nil {
+			postScores[c.PostID] += weigh(store.TrendingCommentWeight, createdAt)
+		}
+	}
+
+	var posts []*trendingPost
+	tagScores := map[int64]float64{}
+	for id, score := range postScores {
+		posts = append(posts, &trendingPost{postID: id, score: score, computedAt: now})
+		for _, pt := range s.db.postTags {
+			if pt.postID == id {
+				tagScores[pt.tagID] += score
+			}
+		}
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if posts[i].score != posts[j].score {
+			return posts[i].score > posts[j].score
+		}
+		return posts[i].postID > posts[j].postID
+	})
+
+	var tags []*trendingTag
+	for id, score := range tagScores {
+		tags = append(tags, &trendingTag{tagID: id, score: score, computedAt: now})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].score != tags[j].score {
+			return tags[i].score > tags[j].score
+		}
+		return s.db.tagByID(tags[i].tagID).Name < s.db.tagByID(tags[j].tagID).Name
+	})
+
+	// rows are kept in rank order
+	s.db.trendingPosts = page(posts, params.Limit, 0)
+	s.db.trendingTags = page(tags, params.Limit, 0)
+	return nil
+}
+
+func (s *TrendingStore) Tags(ctx context.Context, limit int) ([]store.TrendingTag, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var tags []store.TrendingTag
+	for _, t := range s.db.trendingTags {
+		count := s.db.tagPostCount(t.tagID)
+		if count == 0 {
+			continue
+		}
+		tags = append(tags, store.TrendingTag{
+			Name:       s.db.tagByID(t.tagID).Name,
+			PostCount:  count,
+			Score:      t.score,
+			ComputedAt: t.computedAt,
+		})
+	}
+	return page(tags, limit, 0), nil
+}
+
+func (s *TrendingStore) Posts(ctx context.Context, limit int) ([]store.TrendingPost, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var posts []store.TrendingPost
+	for _, t := range s.db.trendingPosts {
+		item, ok := s.db.postWithMetadata(s.db.post(t.postID))
+		if !ok {
+			continue
+		}
+		posts = append(posts, store.TrendingPost{PostWithMetadata: item, Score: t.score, ComputedAt: t.computedAt})
+	}
+	return page(posts, limit, 0), nil
+}
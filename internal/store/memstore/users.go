@@ -0,0 +1,298 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+type UserStore struct {
+	db *db
+}
+
+// Create ignores tx, the store has no transactions to take part in.
+func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *store.User) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.create(user)
+}
+
+func (s *UserStore) create(user *store.User) error {
+	if user.PreferredLocale == "" {
+		user.PreferredLocale = store.DefaultLocale
+	}
+	if s.db.userByEmail(user.Email) != nil {
+		return store.ErrDuplicateEmail
+	}
+	if s.usernameTaken(user.Username, 0) {
+		return store.ErrDuplicateUsername
+	}
+
+	user.ID = s.db.nextID("users")
+	user.CreatedAt = s.db.now()
+
+	s.db.users = append(s.db.users, &store.User{
+		ID:              user.ID,
+		Username:        user.Username,
+		Email:           user.Email,
+		Password:        user.Password,
+		CreatedAt:       user.CreatedAt,
+		RoleID:          1,
+		PreferredLocale: user.PreferredLocale,
+	})
+	return nil
+}
+
+func (s *UserStore) usernameTaken(username string, except int64) bool {
+	for _, u := range s.db.users {
+		if u.Username == username && u.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete removes the user and its invitations, it is not an error when the
+// user doesn't exist.
+func (s *UserStore) Delete(ctx context.Context, id int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if err := s.db.deleteUser(id); err != nil {
+		return err
+	}
+	s.deleteInvitations(id)
+	return nil
+}
+
+func (s *UserStore) GetByID(ctx context.Context, id int64) (*store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.get(s.db.user(id))
+}
+
+func (s *UserStore) GetByUsername(ctx context.Context, username string) (*store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	for _, u := range s.db.users {
+		if u.Username == username {
+			return s.get(u)
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	return s.get(s.db.userByEmail(email))
+}
+
+func (s *UserStore) get(u *store.User) (*store.User, error) {
+	if u == nil {
+		return nil, store.ErrNotFound
+	}
+	user := s.db.copyUser(u)
+	return &user, nil
+}
+
+// copyUser returns a detached copy of u with its role, as loaded by
+// getUserBy.
+func (d *db) copyUser(u *store.User) store.User {
+	user := *u
+	user.DeletionScheduledAt = copyTime(u.DeletionScheduledAt)
+	user.AvatarID = copyID(u.AvatarID)
+	user.UsernameChangedAt = copyTime(u.UsernameChangedAt)
+	user.Role = store.Role{ID: u.RoleID}
+	if role := d.role(u.RoleID); role != nil {
+		user.Role.Name = role.Name
+		user.Role.Level = role.Level
+	}
+	return user
+}
+
+// List mirrors the columns selected by the Postgres List, the password hash
+// and the scheduled deletion are not loaded.
+func (s *UserStore) List(ctx context.Context, q store.UserListQuery) ([]store.User, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var matches []store.User
+	for _, u := range s.db.users {
+		if !ilike(u.Username, q.Search) && !ilike(u.Email, q.Search) {
+			continue
+		}
+		if q.Active != nil && u.IsActive != *q.Active {
+			continue
+		}
+		user := s.db.copyUser(u)
+		user.Password = store.User{}.Password
+		user.DeletionScheduledAt = nil
+		matches = append(matches, user)
+	}
+	return page(matches, q.Limit, q.Offset), nil
+}
+
+func (s *UserStore) SetActive(ctx context.Context, id int64, active bool) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u := s.db.user(id)
+	if u == nil {
+		return store.ErrNotFound
+	}
+	u.IsActive = active
+	if !active {
+		s.db.sessions = remove(s.db.sessions, func(s *session) bool { return s.UserID == id })
+	}
+	return nil
+}
+
+func (s *UserStore) SetRole(ctx context.Context, id int64, roleID int64) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u := s.db.user(id)
+	if u == nil {
+		return store.ErrNotFound
+	}
+	if s.db.role(roleID) == nil {
+		return errForeignKey
+	}
+	u.RoleID = roleID
+	return nil
+}
+
+func (s *UserStore) ResendInvitation(ctx context.Context, userID int64, token string, invitationExp, cooldown time.Duration, email *store.OutboxEmail) (time.Duration, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	u := s.db.user(userID)
+	if u == nil || u.IsActive {
+		return 0, store.ErrNotFound
+	}
+
+	var issuedAt time.Time
+	for _, inv := range s.db.invitations {
+		if inv.userID == userID && inv.createdAt.After(issuedAt) {
+			issuedAt = inv.createdAt
+		}
+	}
+	if elapsed := s.db.clock().Sub(issuedAt); cooldown > 0 && !issuedAt.IsZero() && elapsed < cooldown {
+		return cooldown - elapsed, store.ErrRateLimited
+	}
+
+	s.deleteInvitations(userID)
+	s.createInvitation(token, invitationExp, userID)
+	s.db.enqueueEmail(email)
+	return 0, nil
+}
+
+func (s *UserStore) DeleteUnactivated(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	expired := map[int64]bool{}
+	for _, inv := range s.db.invitations {
+		if u := s.db.user(inv.userID); u != nil && !u.IsActive && !inv.expiry.After(expiredBefore) {
+			expired[u.ID] = true
+		}
+	}
+	for id := range expired {
+		if err := s.db.deleteUser(id); err != nil {
+			return 0, err
+		}
+	}
+	s.db.invitations = remove(s.db.invitations, func(inv *invitation) bool { return expired[inv.userID] })
+	return int64(len(expired)), nil
+}
+
+func (s *UserStore) CountExpiredInvitations(ctx context.Context) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	var count int64
+	now := s.db.clock()
+	for _, inv := range s.db.invitations {
+		if s.expiredInvitation(inv, now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	now := s.db.clock()
+	before := len(s.db.invitations)
+	s.db.invitations = remove(s.db.invitations, func(inv *invitation) bool { return s.expiredInvitation(inv, now) })
+	return int64(before - len(s.db.invitations)), nil
+}
+
+// expiredInvitation mirrors the SQL store, the invitations of users who never
+// activated their account are left to DeleteUnactivated.
+func (s *UserStore) expiredInvitation(inv *invitation, now time.Time) bool {
+	if inv.expiry.After(now) {
+		return false
+	}
+	u := s.db.user(inv.userID)
+	return u == nil || u.IsActive
+}
+
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *store.User, token string, invitationExp time.Duration, email *store.OutboxEmail) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	if err := s.create(user); err != nil {
+		return err
+	}
+	s.createInvitation(token, invitationExp, user.ID)
+	s.db.enqueueEmail(email)
+	return nil
+}
+
+// Activate takes the plain token and hashes it, like the Postgres
+// implementation does.
+func (s *UserStore) Activate(ctx context.Context, token string) error {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+
+	hash := hashToken(token)
+	for _, inv := range s.db.invitations {
+		if inv.token != hash {
+			continue
+		}
+		u := s.db.user(inv.userID)
+		if u == nil {
+			break
+		}
+		if !inv.expiry.After(s.db.clock()) {
+			return store.ErrExpired
+		}
+		u.IsActive = true
+		s.deleteInvitations(u.ID)
+		return nil
+	}
+	return store.ErrNotFound
+}
+
+func (s *UserStore) createInvitation(token string, invitationExp time.Duration, userID int64) {
+	s.db.invitations = append(s.db.invitations, &invitation{
+		token:     token,
+		userID:    userID,
+		expiry:    s.db.clock().Add(invitationExp).Round(time.Second),
+		createdAt: s.db.now(),
+	})
+}
+
+func (s *UserStore) deleteInvitations(userID int64) {
+	s.db.invitations = remove(s.db.invitations, func(inv *invitation) bool { return inv.userID == userID })
+}
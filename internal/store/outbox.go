@@ -0,0 +1,159 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+)
+
+// OutboxEmail is an email waiting to be delivered by the outbox dispatcher.
+// It is written in the same transaction as the change that triggers it.
+type OutboxEmail struct {
+	ID            int64           `json:"id"`
+	Template      string          `json:"template"`
+	Username      string          `json:"username"`
+	Email         string          `json:"email"`
+	Data          json.RawMessage `json:"data"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	LastError     string          `json:"last_error"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// NewOutboxEmail encodes the template data of an email for the outbox.
+func NewOutboxEmail(template, username, email string, data any) (*OutboxEmail, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	return &OutboxEmail{
+		Template: template,
+		Username: username,
+		Email:    email,
+		Data:     raw,
+	}, nil
+}
+
+type OutboxStore struct {
+	db *sql.DB
+}
+
+func enqueueEmail(ctx context.Context, tx *sql.Tx, email *OutboxEmail) error {
+	// the timestamp(0) column would round NOW() up to half a second ahead,
+	// truncating it makes the email due right away
+	query := `
+		INSERT INTO email_outbox (template, username, email, data, next_attempt_at)
+		VALUES ($1, $2, $3, $4, date_trunc('second', NOW()))
+		RETURNING id, status, next_attempt_at, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	return tx.QueryRowContext(ctx, query, email.Template, email.Username, email.Email, []byte(email.Data)).Scan(
+		&email.ID,
+		&email.Status,
+		&email.NextAttemptAt,
+		&email.CreatedAt,
+	)
+}
+
+// Claim locks up to limit due emails for lease. Rows locked by another
+// dispatcher are skipped, and a claim that is never completed (e.g. the
+// process died) becomes due again once the lease expires.
+func (s *OutboxStore) Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxEmail, error) {
+	query := `
+		UPDATE email_outbox
+		SET attempts = attempts + 1, next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE status = 'pending' AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, template, username, email, data, status, attempts, COALESCE(last_error, ''), next_attempt_at, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit, time.Now().Add(lease))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []OutboxEmail
+	for rows.Next() {
+		var e OutboxEmail
+		err := rows.Scan(
+			&e.ID,
+			&e.Template,
+			&e.Username,
+			&e.Email,
+			&e.Data,
+			&e.Status,
+			&e.Attempts,
+			&e.LastError,
+			&e.NextAttemptAt,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		emails = append(emails, e)
+	}
+	return emails, rows.Err()
+}
+
+// MarkSent completes an email. The template data is dropped since it may
+// hold secrets such as activation tokens.
+func (s *OutboxStore) MarkSent(ctx context.Context, id int64) error {
+	query := `UPDATE email_outbox SET status = 'sent', sent_at = NOW(), data = '{}', last_error = NULL WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// MarkFailed records a failed attempt and schedules the next one, or moves
+// the email to the dead letter status when dead is set.
+func (s *OutboxStore) MarkFailed(ctx context.Context, id int64, lastErr string, nextAttemptAt time.Time, dead bool) error {
+	status := OutboxPending
+	if dead {
+		status = OutboxDead
+	}
+	query := `UPDATE email_outbox SET status = $1, last_error = $2, next_attempt_at = $3 WHERE id = $4`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, status, lastErr, nextAttemptAt, id)
+	return err
+}
+
+// DeleteSent removes the emails sent before sentBefore. Dead emails are kept
+// for inspection.
+func (s *OutboxStore) DeleteSent(ctx context.Context, sentBefore time.Time) (int64, error) {
+	query := `DELETE FROM email_outbox WHERE status = 'sent' AND sent_at <= $1`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, sentBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
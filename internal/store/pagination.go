@@ -7,6 +7,13 @@ import (
 	"time"
 )
 
+// Feed modes. The chronological feed is ordered by Sort, the ranked one by
+// score.
+const (
+	FeedChronological = "chronological"
+	FeedRanked        = "ranked"
+)
+
 type PaginatedFeedQuery struct {
 	Limit  int      `json:"limit" validate:"gte=1,lte=20"`
 	Offset int      `json:"offset" validate:"gte=0"`
@@ -15,6 +22,12 @@ type PaginatedFeedQuery struct {
 	Search string   `json:"search" validate:"max=100"`
 	Since  string   `json:"since"`
 	Until  string   `json:"until"`
+	Mode   string   `json:"mode" validate:"omitempty,oneof=chronological ranked"`
+	// Snapshot is the Unix time the ranked feed is computed at, the pages of
+	// one snapshot don't overlap.
+	Snapshot int64 `json:"snapshot" validate:"gte=0"`
+	// Debug adds the explanation of their score to ranked posts.
+	Debug bool `json:"debug"`
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error) {
@@ -61,6 +74,29 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 	if until != "" {
 		fq.Until = parseTime(until)
 	}
+
+	mode := qs.Get("mode")
+	if mode != "" {
+		fq.Mode = mode
+	}
+
+	snapshot := qs.Get("snapshot")
+	if snapshot != "" {
+		s, err := strconv.ParseInt(snapshot, 10, 64)
+		if err != nil {
+			return fq, err
+		}
+		fq.Snapshot = s
+	}
+
+	debug := qs.Get("debug")
+	if debug != "" {
+		d, err := strconv.ParseBool(debug)
+		if err != nil {
+			return fq, err
+		}
+		fq.Debug = d
+	}
 	return fq, nil
 }
 
@@ -15,6 +15,7 @@ type Post struct {
 	Title     string    `json:"title"`
 	UserID    int64     `json:"user_id"`
 	Tags      []string  `json:"tags"`
+	Mentions  []string  `json:"mentions,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Version   int       `json:"version"`
@@ -25,34 +26,68 @@ type Post struct {
 type PostWithMetadata struct {
 	Post
 	CommentCount int `json:"comment_count"`
+	// Bookmarked is set in the feeds and the bookmarks, when the viewer
+	// bookmarked the post.
+	Bookmarked bool `json:"bookmarked,omitempty"`
 }
 
+// FeedCandidate is a post the ranked feed considers, with the signals it is
+// ranked on.
+type FeedCandidate struct {
+	PostWithMetadata
+	// Degree is 0 for the viewer's own posts, 1 for the users they follow and
+	// 2 for the users those follow.
+	Degree int
+	// Affinity counts the viewer's comments on posts of the author and the
+	// mentions of the author in the viewer's posts.
+	Affinity int
+	// TagOverlap counts the tags of the post the viewer posted or commented
+	// on.
+	TagOverlap int
+}
+
+// MentionNotifier builds the notifications of the users a post newly
+// mentions, they are enqueued in the transaction writing the post.
+type MentionNotifier func(post *Post, mentioned []User) ([]*OutboxEmail, error)
+
 type PostStore struct {
 	db *sql.DB
 }
 
-func (s *PostStore) Create(ctx context.Context, post *Post) error {
-	query := `INSERT INTO posts (content, title, user_id, tags)
+// Create inserts post, links its tags and the active users among
+// post.Mentions, and notifies them with notify, which may be nil. On return
+// post.Mentions holds the usernames actually linked.
+func (s *PostStore) Create(ctx context.Context, post *Post, notify MentionNotifier) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO posts (content, title, user_id, tags)
 Values ($1, $2, $3, $4) RETURNING id, created_at, updated_at`
-	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
-	defer cancel()
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
 
-	err := s.db.QueryRowContext(ctx,
-		query,
-		post.Content,
-		post.Title,
-		post.UserID,
-		pq.Array(post.Tags),
-	).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+		err := tx.QueryRowContext(ctx,
+			query,
+			post.Content,
+			post.Title,
+			post.UserID,
+			pq.Array(post.Tags),
+		).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
+		if err != nil {
+			return err
+		}
 
-	if err != nil {
-		return err
-	}
-	return nil
+		if err := linkTags(ctx, tx, post); err != nil {
+			return err
+		}
+		return linkMentions(ctx, tx, post, notify)
+	})
 }
 
 func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
-	query := `SELECT id, user_id, title, content, created_at,  updated_at, tags, version
+	query := `SELECT id, user_id, title, content, created_at,  updated_at, tags, version,
+			ARRAY(
+				SELECT u.username FROM post_mentions m JOIN users u ON u.id = m.user_id
+				WHERE m.post_id = posts.id ORDER BY u.username
+			)
 		FROM posts
 		WHERE id = $1
 	`
@@ -70,6 +105,7 @@ func (s *PostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
 		&post.UpdatedAt,
 		pq.Array(&post.Tags),
 		&post.Version,
+		pq.Array(&post.Mentions),
 	)
 	if err != nil {
 		switch {
@@ -106,96 +142,294 @@ func (s *PostStore) Delete(ctx context.Context, id int64) error {
 	return nil
 }
 
-func (s *PostStore) Update(ctx context.Context, post *Post) error {
-	query := `
-		UPDATE posts
-		SET title = $1, content = $2, version = version + 1
-		WHERE id = $3 AND version = $4
-		RETURNING version
-	`
+// Update only applies when post.Version is the stored version, a stale
+// version is reported as ErrNotFound. Tags and mentions are replaced, only
+// the users not mentioned before are notified.
+func (s *PostStore) Update(ctx context.Context, post *Post, notify MentionNotifier) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE posts
+			SET title = $1, content = $2, tags = $3, version = version + 1
+			WHERE id = $4 AND version = $5
+			RETURNING version
+		`
 
-	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
-	defer cancel()
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Title,
+			post.Content,
+			pq.Array(post.Tags),
+			post.ID,
+			post.Version,
+		).Scan(&post.Version)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
 
-	err := s.db.QueryRowContext(
-		ctx,
-		query,
-		post.Title,
-		post.Content,
-		post.ID,
-		post.Version,
-	).Scan(&post.Version)
+		if err := linkTags(ctx, tx, post); err != nil {
+			return err
+		}
+		return linkMentions(ctx, tx, post, notify)
+	})
+}
+
+// linkTags makes post_tags match post.Tags, creating the missing tags.
+func linkTags(ctx context.Context, tx *sql.Tx, post *Post) error {
+	tags := pq.Array(post.Tags)
+
+	_, err := tx.ExecContext(ctx, `INSERT INTO tags (name) SELECT unnest($1::varchar[]) ON CONFLICT (name) DO NOTHING`, tags)
 	if err != nil {
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		default:
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM post_tags WHERE post_id = $1
+			AND tag_id NOT IN (SELECT id FROM tags WHERE name = ANY ($2::varchar[]))`,
+		post.ID, tags)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO post_tags (post_id, tag_id)
+		SELECT $1, id FROM tags WHERE name = ANY ($2::varchar[])
+		ON CONFLICT DO NOTHING`,
+		post.ID, tags)
+	return err
+}
+
+// linkMentions makes post_mentions match the active users named in
+// post.Mentions, notifies the newly linked ones but the author, and sets
+// post.Mentions to the linked usernames.
+func linkMentions(ctx context.Context, tx *sql.Tx, post *Post, notify MentionNotifier) error {
+	mentions := pq.Array(post.Mentions)
+	_, err := tx.ExecContext(ctx, `
+		DELETE FROM post_mentions WHERE post_id = $1
+			AND user_id NOT IN (SELECT id FROM users WHERE username = ANY ($2::varchar[]) AND is_active)`,
+		post.ID, mentions)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		WITH linked AS (
+			INSERT INTO post_mentions (post_id, user_id)
+			SELECT $1, id FROM users WHERE username = ANY ($2::varchar[]) AND is_active
+			ON CONFLICT DO NOTHING
+			RETURNING user_id
+		)
+		SELECT u.id, u.username, u.email, u.preferred_locale
+		FROM users u JOIN linked l ON l.user_id = u.id
+		WHERE u.id <> $3
+		ORDER BY u.username`
+
+	rows, err := tx.QueryContext(ctx, query, post.ID, mentions, post.UserID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var mentioned []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.PreferredLocale); err != nil {
 			return err
 		}
+		mentioned = append(mentioned, u)
+	}
+	if err := rows.Err(); err != nil {
+		return err
 	}
 
+	err = tx.QueryRowContext(ctx, `
+		SELECT ARRAY(
+			SELECT u.username FROM post_mentions m JOIN users u ON u.id = m.user_id
+			WHERE m.post_id = $1 ORDER BY u.username
+		)`, post.ID).Scan(pq.Array(&post.Mentions))
+	if err != nil {
+		return err
+	}
+
+	if notify == nil || len(mentioned) == 0 {
+		return nil
+	}
+	emails, err := notify(post, mentioned)
+	if err != nil {
+		return err
+	}
+	for _, email := range emails {
+		if err := enqueueEmail(ctx, tx, email); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// GetUserFeed returns the posts of the user and of the users they follow,
+// optionally filtered by a search term and by tags, flagging the ones the
+// user bookmarked.
 func (s *PostStore) GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
-	//	query := `
-	//SELECT
-	//    p.id,
-	//    p.user_id,
-	//    p.title,
-	//    p.content,
-	//    p.created_at,
-	//    p.version,
-	//    p.tags,
-	//    u.username,
-	//    COUNT(c.id) AS comments_count
-	//
-	//FROM
-	//    posts p
-	//LEFT JOIN
-	//    comments c ON c.post_id = p.id
-	//LEFT JOIN
-	//    users u ON p.user_id = u.id
-	//JOIN
-	//    followers f ON (f.follower_id = p.user_id OR p.user_id = $1)
-	//WHERE
-	//    f.user_id = $1 AND
-	//    (p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-	//    (p.tags @> $5 OR $5 = '{}')
-	//GROUP BY
-	//    p.id, p.user_id, p.title, p.content, p.version, p.tags, u.username, u.email
-	//ORDER BY
-	//    p.created_at ` + fq.Sort + `
-	//LIMIT $2 OFFSET $3
-	//`
-
 	query := `
-		SELECT 
+		SELECT
 			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
 			u.username,
-			COUNT(c.id) AS comments_count
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			EXISTS (SELECT 1 FROM bookmarks b WHERE b.user_id = $1 AND b.post_id = p.id) AS bookmarked
 		FROM posts p
-		LEFT JOIN comments c ON c.post_id = p.id
-		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
-		WHERE 
-			f.user_id = $1 AND
-			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
-		  AND (p.tags @> $5 OR $5 = '{}')
-		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.Sort + `
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			(p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1)) AND
+			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
+			(COALESCE(cardinality($5::varchar[]), 0) = 0 OR p.tags @> $5::varchar[])
+		ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
 		LIMIT $2 OFFSET $3
 	`
 
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
 	rows, err := s.db.QueryContext(ctx, query, id, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
 	if err != nil {
 		return nil, err
 	}
+	return scanPostsWithMetadata(rows)
+}
+
+// GetFeedCandidates returns the newest posts of the user, of the users they
+// follow and of the users those follow, as of at: later posts, comments,
+// follows and mentions are ignored so the same at gives the same candidates.
+func (s *PostStore) GetFeedCandidates(ctx context.Context, id int64, at time.Time, fq PaginatedFeedQuery, limit int) ([]FeedCandidate, error) {
+	query := `
+		WITH followed AS (
+			SELECT user_id FROM followers WHERE follower_id = $1 AND created_at <= $2
+		), network AS (
+			SELECT $1::bigint AS user_id, 0 AS degree
+			UNION ALL
+			SELECT user_id, 1 FROM followed
+			UNION ALL
+			SELECT f.user_id, 2
+			FROM followers f
+			JOIN followed ON followed.user_id = f.follower_id
+			WHERE f.created_at <= $2
+		), degrees AS (
+			SELECT user_id, MIN(degree) AS degree FROM network GROUP BY user_id
+		), interests AS (
+			SELECT DISTINCT pt.tag_id
+			FROM post_tags pt
+			JOIN posts ip ON ip.id = pt.post_id
+			WHERE ip.created_at <= $2 AND (
+				ip.user_id = $1 OR
+				ip.id IN (SELECT post_id FROM comments WHERE user_id = $1 AND created_at <= $2)
+			)
+		)
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+			u.username,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.created_at <= $2) AS comments_count,
+			EXISTS (SELECT 1 FROM bookmarks b WHERE b.user_id = $1 AND b.post_id = p.id) AS bookmarked,
+			d.degree,
+			(
+				SELECT COUNT(*) FROM comments c JOIN posts ap ON ap.id = c.post_id
+				WHERE c.user_id = $1 AND ap.user_id = p.user_id AND c.created_at <= $2
+			) + (
+				SELECT COUNT(*) FROM post_mentions m JOIN posts vp ON vp.id = m.post_id
+				WHERE vp.user_id = $1 AND m.user_id = p.user_id AND m.created_at <= $2
+			) AS affinity,
+			(
+				SELECT COUNT(*) FROM post_tags pt
+				WHERE pt.post_id = p.id AND pt.tag_id IN (SELECT tag_id FROM interests)
+			) AS tag_overlap
+		FROM posts p
+		JOIN degrees d ON d.user_id = p.user_id
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			p.created_at <= $2 AND
+			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
+			(COALESCE(cardinality($5::varchar[]), 0) = 0 OR p.tags @> $5::varchar[])
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, id, at, limit, fq.Search, pq.Array(fq.Tags))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []FeedCandidate
+	for rows.Next() {
+		var c FeedCandidate
+		err := rows.Scan(
+			&c.ID,
+			&c.UserID,
+			&c.Title,
+			&c.Content,
+			&c.CreatedAt,
+			&c.Version,
+			pq.Array(&c.Tags),
+			&c.User.Username,
+			&c.CommentCount,
+			&c.Bookmarked,
+			&c.Degree,
+			&c.Affinity,
+			&c.TagOverlap,
+		)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// GetByTag returns the posts tagged with tag, optionally filtered by a search
+// term and by more tags.
+func (s *PostStore) GetByTag(ctx context.Context, tag string, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+	query := `
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+			u.username,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			FALSE AS bookmarked
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		JOIN post_tags pt ON pt.post_id = p.id
+		JOIN tags t ON t.id = pt.tag_id
+		WHERE
+			t.name = $1 AND
+			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
+			(COALESCE(cardinality($5::varchar[]), 0) = 0 OR p.tags @> $5::varchar[])
+		ORDER BY p.created_at ` + fq.Sort + `, p.id ` + fq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, tag, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	if err != nil {
+		return nil, err
+	}
+	return scanPostsWithMetadata(rows)
+}
+
+func scanPostsWithMetadata(rows *sql.Rows) ([]PostWithMetadata, error) {
 	defer rows.Close()
 	var feed []PostWithMetadata
 	for rows.Next() {
 		var p PostWithMetadata
-		err = rows.Scan(
+		err := rows.Scan(
 			&p.ID,
 			&p.UserID,
 			&p.Title,
@@ -205,11 +439,12 @@ func (s *PostStore) GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQ
 			pq.Array(&p.Tags),
 			&p.User.Username,
 			&p.CommentCount,
+			&p.Bookmarked,
 		)
 		if err != nil {
 			return nil, err
 		}
 		feed = append(feed, p)
 	}
-	return feed, nil
+	return feed, rows.Err()
 }
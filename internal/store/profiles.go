@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/lib/pq"
+	"time"
+)
+
+// UpdateProfile saves the profile, username and locale of user. A username
+// change is refused with ErrUsernameCooldown when the previous one happened
+// less than cooldown ago, and the old handle is kept for redirects.
+func (s *UserStore) UpdateProfile(ctx context.Context, user *User, cooldown time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		var (
+			current   string
+			changedAt *time.Time
+		)
+		query := `SELECT username, username_changed_at FROM users WHERE id = $1 FOR UPDATE`
+		if err := tx.QueryRowContext(ctx, query, user.ID).Scan(&current, &changedAt); err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if user.Username != current {
+			if changedAt != nil && time.Since(*changedAt) < cooldown {
+				return ErrUsernameCooldown
+			}
+			query := `
+				INSERT INTO username_history (username, user_id) VALUES ($1, $2)
+				ON CONFLICT (username, user_id) DO UPDATE SET changed_at = NOW()
+			`
+			if _, err := tx.ExecContext(ctx, query, current, user.ID); err != nil {
+				return err
+			}
+			now := time.Now()
+			user.UsernameChangedAt = &now
+		}
+
+		query = `
+			UPDATE users
+			SET username = $1, display_name = $2, bio = $3, website = $4, location = $5,
+				preferred_locale = $6, username_changed_at = $7
+			WHERE id = $8
+		`
+		_, err := tx.ExecContext(ctx, query,
+			user.Username,
+			user.DisplayName,
+			user.Bio,
+			user.Website,
+			user.Location,
+			user.PreferredLocale,
+			user.UsernameChangedAt,
+			user.ID,
+		)
+		if err != nil {
+			var pqErr *pq.Error
+			if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+				return ErrDuplicateUsername
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// ResolveUsername returns the current handle of the user who most recently
+// gave up username.
+func (s *UserStore) ResolveUsername(ctx context.Context, username string) (string, error) {
+	query := `
+		SELECT u.username
+		FROM username_history h
+		JOIN users u ON u.id = h.user_id
+		WHERE h.username = $1
+		ORDER BY h.changed_at DESC
+		LIMIT 1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	var current string
+	err := s.db.QueryRowContext(ctx, query, username).Scan(&current)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return "", ErrNotFound
+		default:
+			return "", err
+		}
+	}
+	return current, nil
+}
+
+// SetAvatar points the avatar of the user to mediaID, nil clears it. It
+// returns the previous avatar so the caller can delete it.
+func (s *UserStore) SetAvatar(ctx context.Context, userID int64, mediaID *int64) (*int64, error) {
+	var previous *int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, `SELECT avatar_id FROM users WHERE id = $1 FOR UPDATE`, userID).Scan(&previous)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE users SET avatar_id = $1 WHERE id = $2`, mediaID, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return previous, nil
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"context"
+	"strings"
+)
+
+// Boosts added to the text similarity of a user search result.
+const (
+	// SearchFollowingBoost: the viewer follows the user.
+	SearchFollowingBoost = 0.5
+	// SearchFollowerBoost: the user follows the viewer.
+	SearchFollowerBoost = 0.25
+	// SearchPopularityBoost is multiplied by the logarithm of the follower
+	// count.
+	SearchPopularityBoost = 0.1
+)
+
+type UserSearchQuery struct {
+	// ViewerID is the user searching, whose relationships boost the results.
+	ViewerID int64
+	Query    string
+	// Autocomplete only matches the usernames and display names starting
+	// with Query, not the similar ones.
+	Autocomplete bool
+	Limit        int
+}
+
+type UserSearchResult struct {
+	ID            int64   `json:"id"`
+	Username      string  `json:"username"`
+	DisplayName   string  `json:"display_name"`
+	AvatarID      *int64  `json:"avatar_id"`
+	FollowerCount int64   `json:"follower_count"`
+	Following     bool    `json:"following"`
+	FollowsYou    bool    `json:"follows_you"`
+	Score         float64 `json:"score"`
+}
+
+// Search finds the active users matching q.Query, the closest and most
+// connected to the viewer first, leaving out the accounts blocked by or
+// blocking the viewer.
+func (s *UserStore) Search(ctx context.Context, q UserSearchQuery) ([]UserSearchResult, error) {
+	// prefixes and similar names are matched by the text_pattern_ops and
+	// trigram indexes, a short prefix is rarely similar enough
+	prefix := `lower(u.username) LIKE $3 || '%' OR lower(u.display_name) LIKE $3 || '%'`
+	match := `(u.username % $2 OR u.display_name % $2 OR ` + prefix + `)`
+	if q.Autocomplete {
+		match = `(` + prefix + `)`
+	}
+
+	query := `
+		WITH matches AS (
+			SELECT
+				u.id, u.username, u.display_name, u.avatar_id,
+				GREATEST(similarity(u.username, $2), similarity(u.display_name, $2)) AS similarity,
+				(SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id) AS follower_count,
+				EXISTS (SELECT 1 FROM followers f WHERE f.follower_id = $1 AND f.user_id = u.id) AS following,
+				EXISTS (SELECT 1 FROM followers f WHERE f.follower_id = u.id AND f.user_id = $1) AS follows_you
+			FROM users u
+			WHERE u.is_active AND u.deletion_scheduled_at IS NULL AND ` + match + ` AND
+				u.id NOT IN (` + blockedBy + `)
+		)
+		SELECT id, username, display_name, avatar_id, follower_count, following, follows_you,
+			similarity
+			+ CASE WHEN following THEN $4::float8 ELSE 0 END
+			+ CASE WHEN follows_you THEN $5::float8 ELSE 0 END
+			+ $6::float8 * LN(1 + follower_count::float8) AS score
+		FROM matches
+		ORDER BY score DESC, username
+		LIMIT $7
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query,
+		q.ViewerID,
+		q.Query,
+		escapeLike(strings.ToLower(q.Query)),
+		SearchFollowingBoost,
+		SearchFollowerBoost,
+		SearchPopularityBoost,
+		q.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []UserSearchResult
+	for rows.Next() {
+		var r UserSearchResult
+		err := rows.Scan(&r.ID, &r.Username, &r.DisplayName, &r.AvatarID, &r.FollowerCount, &r.Following, &r.FollowsYou, &r.Score)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
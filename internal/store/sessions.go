@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Session is an opaque bearer token issued on login. Only the hash of the
+// token is stored.
+type Session struct {
+	UserID    int64     `json:"user_id"`
+	Expiry    time.Time `json:"expiry"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SessionStore struct {
+	db *sql.DB
+}
+
+func (s *SessionStore) Create(ctx context.Context, userID int64, token string, exp time.Duration) (*Session, error) {
+	query := `INSERT INTO sessions (token, user_id, expiry) VALUES ($1, $2, $3) RETURNING expiry, created_at`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	session := &Session{UserID: userID}
+	err := s.db.QueryRowContext(ctx, query, token, userID, time.Now().Add(exp)).Scan(&session.Expiry, &session.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// GetUserID returns the user owning a valid session token.
+func (s *SessionStore) GetUserID(ctx context.Context, token string) (int64, error) {
+	query := `SELECT user_id FROM sessions WHERE token = $1 AND expiry > $2`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	var userID int64
+	err := s.db.QueryRowContext(ctx, query, token, time.Now()).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+	return userID, nil
+}
+
+func (s *SessionStore) Delete(ctx context.Context, token string) error {
+	query := `DELETE FROM sessions WHERE token = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, token)
+	return err
+}
+
+func deleteUserSessions(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM sessions WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
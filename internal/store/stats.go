@@ -0,0 +1,45 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type TableStat struct {
+	Name       string `json:"name"`
+	LiveRows   int64  `json:"live_rows"`
+	DeadRows   int64  `json:"dead_rows"`
+	TotalBytes int64  `json:"total_bytes"`
+}
+
+type StatsStore struct {
+	db *sql.DB
+}
+
+// Tables returns row estimates and on disk size for every user table.
+func (s *StatsStore) Tables(ctx context.Context) ([]TableStat, error) {
+	query := `
+		SELECT relname, n_live_tup, n_dead_tup, pg_total_relation_size(relid)
+		FROM pg_stat_user_tables
+		ORDER BY relname
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []TableStat
+	for rows.Next() {
+		var t TableStat
+		if err := rows.Scan(&t.Name, &t.LiveRows, &t.DeadRows, &t.TotalBytes); err != nil {
+			return nil, err
+		}
+		stats = append(stats, t)
+	}
+	return stats, rows.Err()
+}
@@ -10,23 +10,83 @@ import (
 var (
 	ErrNotFound     = errors.New("resource  not found")
 	ErrConflict     = errors.New("resource already exists")
+	ErrExpired      = errors.New("resource expired")
+	ErrRateLimited  = errors.New("too many requests")
 	TimeoutDuration = time.Second * 5
 )
 
 type Storage struct {
 	Posts interface {
-		Create(context.Context, *Post) error
+		Create(context.Context, *Post, MentionNotifier) error
 		GetByID(context.Context, int64) (*Post, error)
 		Delete(ctx context.Context, id int64) error
-		Update(context.Context, *Post) error
+		Update(context.Context, *Post, MentionNotifier) error
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+		GetFeedCandidates(ctx context.Context, userID int64, at time.Time, fq PaginatedFeedQuery, limit int) ([]FeedCandidate, error)
+		GetByTag(ctx context.Context, tag string, fq PaginatedFeedQuery) ([]PostWithMetadata, error)
+	}
+	Bookmarks interface {
+		Save(ctx context.Context, userID, postID int64, collectionID *int64) error
+		Delete(ctx context.Context, userID, postID int64) error
+		List(ctx context.Context, userID int64, q BookmarkQuery) ([]Bookmark, error)
+		CreateCollection(context.Context, *BookmarkCollection) error
+		ListCollections(ctx context.Context, userID int64) ([]BookmarkCollection, error)
+		DeleteCollection(ctx context.Context, userID, id int64) error
+	}
+	Tags interface {
+		GetByName(context.Context, string) (*Tag, error)
+		Search(ctx context.Context, prefix string, limit int) ([]Tag, error)
+	}
+	Trending interface {
+		Compute(context.Context, TrendingParams) error
+		Tags(ctx context.Context, limit int) ([]TrendingTag, error)
+		Posts(ctx context.Context, limit int) ([]TrendingPost, error)
 	}
 	Users interface {
 		Create(context.Context, *sql.Tx, *User) error
 		GetByID(context.Context, int64) (*User, error)
-		CreateAndInvite(context.Context, *User, string, time.Duration) error
+		GetByEmail(context.Context, string) (*User, error)
+		GetByUsername(context.Context, string) (*User, error)
+		CreateAndInvite(context.Context, *User, string, time.Duration, *OutboxEmail) error
 		Activate(context.Context, string) error
 		Delete(context.Context, int64) error
+		List(context.Context, UserListQuery) ([]User, error)
+		Search(context.Context, UserSearchQuery) ([]UserSearchResult, error)
+		SetActive(context.Context, int64, bool) error
+		SetRole(context.Context, int64, int64) error
+		ResendInvitation(ctx context.Context, userID int64, token string, invitationExp, cooldown time.Duration, email *OutboxEmail) (time.Duration, error)
+		DeleteUnactivated(ctx context.Context, expiredBefore time.Time) (int64, error)
+		CountExpiredInvitations(context.Context) (int64, error)
+		DeleteExpiredInvitations(context.Context) (int64, error)
+		RequestEmailChange(ctx context.Context, userID int64, newEmail, token string, exp time.Duration, emails ...*OutboxEmail) error
+		ConfirmEmailChange(ctx context.Context, token string) (*User, error)
+		UpdateProfile(ctx context.Context, user *User, usernameCooldown time.Duration) error
+		ResolveUsername(ctx context.Context, username string) (string, error)
+		SetAvatar(ctx context.Context, userID int64, mediaID *int64) (*int64, error)
+		ScheduleDeletion(ctx context.Context, userID int64, at time.Time) error
+		CancelDeletion(ctx context.Context, userID int64) (bool, error)
+		DueForErasure(ctx context.Context, limit int) ([]int64, error)
+		Erase(ctx context.Context, userID int64) ([]string, error)
+	}
+	Exports interface {
+		Request(ctx context.Context, userID int64) (*DataExport, error)
+		GetByID(context.Context, int64) (*DataExport, error)
+		ListByUser(ctx context.Context, userID int64) ([]DataExport, error)
+		Claim(ctx context.Context, lease time.Duration) (*DataExport, error)
+		Complete(ctx context.Context, export *DataExport, email *OutboxEmail) error
+		Fail(ctx context.Context, id int64, lastErr string, dead bool) error
+		Expire(ctx context.Context, limit int) ([]DataExport, error)
+		Collect(ctx context.Context, userID int64) (*UserData, error)
+	}
+	Media interface {
+		Create(context.Context, *Media) error
+		GetByID(context.Context, int64) (*Media, error)
+		Delete(context.Context, int64) error
+	}
+	Sessions interface {
+		Create(ctx context.Context, userID int64, token string, exp time.Duration) (*Session, error)
+		GetUserID(ctx context.Context, token string) (int64, error)
+		Delete(ctx context.Context, token string) error
 	}
 	Comments interface {
 		GetByPostID(context.Context, int64) ([]Comment, error)
@@ -37,6 +97,34 @@ type Storage struct {
 		Follow(ctx context.Context, followerID, userID int64) error
 		UnFollow(ctx context.Context, followerID, userID int64) error
 	}
+	Blocks interface {
+		Block(ctx context.Context, userID, blockedID int64) error
+		Unblock(ctx context.Context, userID, blockedID int64) error
+		List(ctx context.Context, userID int64) ([]BlockedUser, error)
+	}
+	Suggestions interface {
+		List(ctx context.Context, userID int64, limit int) ([]Suggestion, error)
+		Precompute(ctx context.Context, minFollowing, limit int) (int64, error)
+		Dismiss(ctx context.Context, userID, suggestedID int64) error
+	}
+	Roles interface {
+		GetByName(context.Context, string) (*Role, error)
+	}
+	Stats interface {
+		Tables(context.Context) ([]TableStat, error)
+	}
+	Outbox interface {
+		Claim(ctx context.Context, limit int, lease time.Duration) ([]OutboxEmail, error)
+		MarkSent(context.Context, int64) error
+		MarkFailed(ctx context.Context, id int64, lastErr string, nextAttemptAt time.Time, dead bool) error
+		DeleteSent(ctx context.Context, sentBefore time.Time) (int64, error)
+	}
+	Idempotency interface {
+		Begin(ctx context.Context, key *IdempotencyKey, ttl, lease time.Duration) (*IdempotencyKey, error)
+		Complete(context.Context, *IdempotencyKey) error
+		Release(ctx context.Context, scope, key string) error
+		DeleteExpired(context.Context) (int64, error)
+	}
 }
 
 func NewStorage(db *sql.DB) Storage {
@@ -44,9 +132,21 @@ func NewStorage(db *sql.DB) Storage {
 		Posts: &PostStore{
 			db: db,
 		},
-		Users:     &UserStore{db: db},
-		Comments:  &CommentStore{db: db},
-		Followers: &FollowerStore{db: db},
+		Bookmarks:   &BookmarkStore{db: db},
+		Tags:        &TagStore{db: db},
+		Trending:    &TrendingStore{db: db},
+		Users:       &UserStore{db: db},
+		Sessions:    &SessionStore{db: db},
+		Media:       &MediaStore{db: db},
+		Exports:     &ExportStore{db: db},
+		Comments:    &CommentStore{db: db},
+		Followers:   &FollowerStore{db: db},
+		Blocks:      &BlockStore{db: db},
+		Suggestions: &SuggestionStore{db: db},
+		Roles:       &RoleStore{db: db},
+		Stats:       &StatsStore{db: db},
+		Outbox:      &OutboxStore{db: db},
+		Idempotency: &IdempotencyStore{db: db},
 	}
 }
 
@@ -0,0 +1,17 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/igorzinar/goSocial/internal/store"
+	"github.com/igorzinar/goSocial/internal/store/storetest"
+	"github.com/igorzinar/goSocial/internal/testdb"
+)
+
+// TestConformance runs the storage conformance suite against Postgres, it is
+// skipped unless TEST_DB_ADDR is set.
+func TestConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) store.Storage {
+		return store.NewStorage(testdb.New(t))
+	})
+}
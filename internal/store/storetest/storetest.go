@@ -0,0 +1,1537 @@
+// Package storetest is a conformance suite for store.Storage implementations.
+// It runs against both Postgres and the in-memory store so they can't drift
+// apart.
+package storetest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/igorzinar/goSocial/internal/store"
+)
+
+// Run exercises storage implementations returned by newStorage, which is
+// called once per subtest and must return an empty, migrated storage.
+func Run(t *testing.T, newStorage func(t *testing.T) store.Storage) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s store.Storage)
+	}{
+		{"Users", testUsers},
+		{"DuplicateUsers", testDuplicateUsers},
+		{"ListUsers", testListUsers},
+		{"UserSearch", testUserSearch},
+		{"Invitations", testInvitations},
+		{"ResendInvitation", testResendInvitation},
+		{"DeleteUnactivated", testDeleteUnactivated},
+		{"Posts", testPosts},
+		{"PostVersion", testPostVersion},
+		{"Comments", testComments},
+		{"Followers", testFollowers},
+		{"Blocks", testBlocks},
+		{"Suggestions", testSuggestions},
+		{"Feed", testFeed},
+		{"FeedCandidates", testFeedCandidates},
+		{"Bookmarks", testBookmarks},
+		{"Tags", testTags},
+		{"Mentions", testMentions},
+		{"Trending", testTrending},
+		{"Roles", testRoles},
+		{"Sessions", testSessions},
+		{"EmailChange", testEmailChange},
+		{"Profile", testProfile},
+		{"Avatar", testAvatar},
+		{"Erasure", testErasure},
+		{"Exports", testExports},
+		{"Outbox", testOutbox},
+		{"Idempotency", testIdempotency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStorage(t))
+		})
+	}
+}
+
+var ctx = context.Background()
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func invitationEmail(t *testing.T, user *store.User) *store.OutboxEmail {
+	t.Helper()
+	email, err := store.NewOutboxEmail("user_invitation", user.Username, user.Email, map[string]string{"username": user.Username})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return email
+}
+
+// invite creates an inactive user whose activation token is its username.
+func invite(t *testing.T, s store.Storage, username string, exp time.Duration) *store.User {
+	t.Helper()
+	user := &store.User{Username: username, Email: username + "@example.com"}
+	if err := user.Password.Set("password"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Users.CreateAndInvite(ctx, user, hash(username), exp, invitationEmail(t, user)); err != nil {
+		t.Fatalf("creating %s: %v", username, err)
+	}
+	return user
+}
+
+// createUser creates an active user.
+func createUser(t *testing.T, s store.Storage, username string) *store.User {
+	t.Helper()
+	user := invite(t, s, username, time.Hour)
+	if err := s.Users.Activate(ctx, username); err != nil {
+		t.Fatalf("activating %s: %v", username, err)
+	}
+	user.IsActive = true
+	return user
+}
+
+func createPost(t *testing.T, s store.Storage, userID int64, title string, tags ...string) *store.Post {
+	t.Helper()
+	post := &store.Post{UserID: userID, Title: title, Content: "content of " + title, Tags: tags}
+	if err := s.Posts.Create(ctx, post, nil); err != nil {
+		t.Fatalf("creating post %q: %v", title, err)
+	}
+	return post
+}
+
+func wantErr(t *testing.T, got, want error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Fatalf("got error %v, want %v", got, want)
+	}
+}
+
+func noErr(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// near reports whether two timestamps are within the rounding of a
+// timestamp(0) column and the duration of the test.
+func near(a, b time.Time) bool {
+	d := a.Sub(b)
+	return d > -5*time.Second && d < 5*time.Second
+}
+
+func testUsers(t *testing.T, s store.Storage) {
+	user := invite(t, s, "alice", time.Hour)
+	if user.ID == 0 || user.CreatedAt.IsZero() {
+		t.Fatalf("Create did not set id and created_at: %+v", user)
+	}
+	if user.PreferredLocale != store.DefaultLocale {
+		t.Errorf("preferred locale = %q, want %q", user.PreferredLocale, store.DefaultLocale)
+	}
+	if user.CreatedAt.Nanosecond() != 0 {
+		t.Errorf("created_at %v has sub second precision", user.CreatedAt)
+	}
+
+	lookups := map[string]func() (*store.User, error){
+		"GetByID":       func() (*store.User, error) { return s.Users.GetByID(ctx, user.ID) },
+		"GetByEmail":    func() (*store.User, error) { return s.Users.GetByEmail(ctx, "ALICE@example.com") },
+		"GetByUsername": func() (*store.User, error) { return s.Users.GetByUsername(ctx, "alice") },
+	}
+	for name, lookup := range lookups {
+		got, err := lookup()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got.ID != user.ID || got.Email != "alice@example.com" || got.IsActive {
+			t.Errorf("%s = %+v", name, got)
+		}
+		if got.Role.Name != "user" || got.Role.Level != 1 || got.Role.ID != got.RoleID {
+			t.Errorf("%s role = %+v", name, got.Role)
+		}
+		if !got.Password.Matches("password") || got.Password.Matches("wrong") {
+			t.Errorf("%s did not load the password hash", name)
+		}
+	}
+
+	_, err := s.Users.GetByID(ctx, user.ID+100)
+	wantErr(t, err, store.ErrNotFound)
+	_, err = s.Users.GetByUsername(ctx, "ALICE")
+	wantErr(t, err, store.ErrNotFound)
+
+	// deactivating ends the sessions
+	_, err = s.Sessions.Create(ctx, user.ID, hash("session"), time.Hour)
+	noErr(t, err)
+	noErr(t, s.Users.SetActive(ctx, user.ID, false))
+	_, err = s.Sessions.GetUserID(ctx, hash("session"))
+	wantErr(t, err, store.ErrNotFound)
+
+	noErr(t, s.Users.SetActive(ctx, user.ID, true))
+	wantErr(t, s.Users.SetActive(ctx, user.ID+100, true), store.ErrNotFound)
+
+	admin, err := s.Roles.GetByName(ctx, "admin")
+	noErr(t, err)
+	noErr(t, s.Users.SetRole(ctx, user.ID, admin.ID))
+	wantErr(t, s.Users.SetRole(ctx, user.ID+100, admin.ID), store.ErrNotFound)
+
+	got, err := s.Users.GetByID(ctx, user.ID)
+	noErr(t, err)
+	if !got.IsActive || got.Role.Name != "admin" {
+		t.Errorf("SetActive/SetRole not applied: %+v", got)
+	}
+
+	noErr(t, s.Users.Delete(ctx, user.ID))
+	_, err = s.Users.GetByID(ctx, user.ID)
+	wantErr(t, err, store.ErrNotFound)
+}
+
+func testDuplicateUsers(t *testing.T, s store.Storage) {
+	invite(t, s, "alice", time.Hour)
+
+	dupEmail := &store.User{Username: "other", Email: "Alice@Example.com"}
+	err := s.Users.CreateAndInvite(ctx, dupEmail, hash("other"), time.Hour, invitationEmail(t, dupEmail))
+	wantErr(t, err, store.ErrDuplicateEmail)
+
+	dupUsername := &store.User{Username: "alice", Email: "other@example.com"}
+	err = s.Users.CreateAndInvite(ctx, dupUsername, hash("other"), time.Hour, invitationEmail(t, dupUsername))
+	wantErr(t, err, store.ErrDuplicateUsername)
+
+	// a failed CreateAndInvite leaves nothing behind
+	_, err = s.Users.GetByUsername(ctx, "other")
+	wantErr(t, err, store.ErrNotFound)
+	invite(t, s, "other", time.Hour)
+}
+
+func testListUsers(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	invite(t, s, "bob", time.Hour)
+	carol := createUser(t, s, "carol")
+
+	users, err := s.Users.List(ctx, store.UserListQuery{Limit: 10})
+	noErr(t, err)
+	if len(users) != 3 || users[0].ID != alice.ID || users[2].ID != carol.ID {
+		t.Fatalf("List = %+v", users)
+	}
+
+	active := true
+	users, err = s.Users.List(ctx, store.UserListQuery{Active: &active, Limit: 10})
+	noErr(t, err)
+	if len(users) != 2 {
+		t.Errorf("List(active) returned %d users, want 2", len(users))
+	}
+
+	users, err = s.Users.List(ctx, store.UserListQuery{Search: "CAR", Limit: 10})
+	noErr(t, err)
+	if len(users) != 1 || users[0].ID != carol.ID {
+		t.Errorf("List(search) = %+v", users)
+	}
+	// wildcards are matched literally
+	users, err = s.Users.List(ctx, store.UserListQuery{Search: "c_r%", Limit: 10})
+	noErr(t, err)
+	if len(users) != 0 {
+		t.Errorf("List(search with wildcards) = %+v, want none", users)
+	}
+
+	users, err = s.Users.List(ctx, store.UserListQuery{Limit: 1, Offset: 1})
+	noErr(t, err)
+	if len(users) != 1 || users[0].Username != "bob" {
+		t.Errorf("List(page) = %+v", users)
+	}
+}
+
+func testUserSearch(t *testing.T, s store.Storage) {
+	viewer := createUser(t, s, "viewer")
+	createUser(t, s, "alice")
+	alicia := createUser(t, s, "alicia")
+	malice := createUser(t, s, "malice")
+	bob := createUser(t, s, "bob")
+	bob.DisplayName = "Alice Cooper"
+	noErr(t, s.Users.UpdateProfile(ctx, bob, time.Hour))
+	invite(t, s, "alina", time.Hour)
+	alix := createUser(t, s, "alix")
+	noErr(t, s.Users.ScheduleDeletion(ctx, alix.ID, time.Now().Add(time.Hour)))
+
+	noErr(t, s.Followers.Follow(ctx, viewer.ID, alicia.ID))
+	noErr(t, s.Followers.Follow(ctx, malice.ID, viewer.ID))
+
+	type result struct {
+		username string
+		score    float64
+	}
+	check := func(name string, got []store.UserSearchResult, want ...result) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s = %+v, want %d results", name, got, len(want))
+			return
+		}
+		for i, g := range got {
+			if g.Username != want[i].username || math.Abs(g.Score-want[i].score) > 0.001 {
+				t.Errorf("%s[%d] = %+v, want %+v", name, i, g, want[i])
+			}
+		}
+	}
+
+	// alina isn't active and alix is leaving, the followed alicia comes first
+	results, err := s.Users.Search(ctx, store.UserSearchQuery{ViewerID: viewer.ID, Query: "alice", Limit: 10})
+	noErr(t, err)
+	check("Search", results,
+		result{"alicia", 4.0/9 + store.SearchFollowingBoost + store.SearchPopularityBoost*math.Log(2)},
+		result{"alice", 1},
+		result{"malice", 4.0/9 + store.SearchFollowerBoost},
+		result{"bob", 6.0 / 13},
+	)
+	if r := results[0]; !r.Following || r.FollowsYou || r.FollowerCount != 1 {
+		t.Errorf("Search[0] = %+v, want followed once by the viewer", r)
+	}
+	if r := results[2]; r.Following || !r.FollowsYou || r.FollowerCount != 0 {
+		t.Errorf("Search[2] = %+v, want following the viewer", r)
+	}
+	if r := results[3]; r.DisplayName != "Alice Cooper" {
+		t.Errorf("Search[3] = %+v, want the display name", r)
+	}
+
+	// malice doesn't start with ali
+	results, err = s.Users.Search(ctx, store.UserSearchQuery{ViewerID: viewer.ID, Query: "Ali", Autocomplete: true, Limit: 2})
+	noErr(t, err)
+	check("Search with autocomplete", results,
+		result{"alicia", 3.0/8 + store.SearchFollowingBoost + store.SearchPopularityBoost*math.Log(2)},
+		result{"alice", 3.0 / 7},
+	)
+	results, err = s.Users.Search(ctx, store.UserSearchQuery{ViewerID: viewer.ID, Query: "al%", Autocomplete: true, Limit: 10})
+	noErr(t, err)
+	check("Search with autocomplete and a wildcard", results)
+
+	// blocks hide the users from each other, either way
+	noErr(t, s.Blocks.Block(ctx, viewer.ID, alicia.ID))
+	noErr(t, s.Blocks.Block(ctx, bob.ID, viewer.ID))
+	results, err = s.Users.Search(ctx, store.UserSearchQuery{ViewerID: viewer.ID, Query: "alice", Limit: 10})
+	noErr(t, err)
+	check("Search with blocks", results,
+		result{"alice", 1},
+		result{"malice", 4.0/9 + store.SearchFollowerBoost},
+	)
+	noErr(t, s.Blocks.Unblock(ctx, viewer.ID, alicia.ID))
+	results, err = s.Users.Search(ctx, store.UserSearchQuery{ViewerID: viewer.ID, Query: "alicia", Autocomplete: true, Limit: 10})
+	noErr(t, err)
+	if len(results) != 1 || results[0].Username != "alicia" {
+		t.Errorf("Search after Unblock = %+v, want alicia", results)
+	}
+}
+
+func testInvitations(t *testing.T, s store.Storage) {
+	invite(t, s, "alice", time.Hour)
+	invite(t, s, "bob", -time.Hour)
+
+	wantErr(t, s.Users.Activate(ctx, "unknown"), store.ErrNotFound)
+	wantErr(t, s.Users.Activate(ctx, "bob"), store.ErrExpired)
+
+	// bob never activated, the invitation is left to DeleteUnactivated
+	count, err := s.Users.CountExpiredInvitations(ctx)
+	noErr(t, err)
+	if count != 0 {
+		t.Errorf("CountExpiredInvitations = %d, want 0", count)
+	}
+
+	noErr(t, s.Users.Activate(ctx, "alice"))
+	// the invitation is consumed
+	wantErr(t, s.Users.Activate(ctx, "alice"), store.ErrNotFound)
+
+	user, err := s.Users.GetByUsername(ctx, "alice")
+	noErr(t, err)
+	if !user.IsActive {
+		t.Error("user not active after activation")
+	}
+
+	bob, err := s.Users.GetByUsername(ctx, "bob")
+	noErr(t, err)
+	_, err = s.Users.ResendInvitation(ctx, bob.ID, hash("bob-again"), time.Hour, 0, invitationEmail(t, bob))
+	noErr(t, err)
+	wantErr(t, s.Users.Activate(ctx, "bob"), store.ErrNotFound)
+	noErr(t, s.Users.Activate(ctx, "bob-again"))
+
+	deleted, err := s.Users.DeleteExpiredInvitations(ctx)
+	noErr(t, err)
+	if deleted != 0 {
+		t.Errorf("DeleteExpiredInvitations = %d, want 0", deleted)
+	}
+
+	// an admin activated dave, the invitation is no longer needed
+	dave := invite(t, s, "dave", -time.Hour)
+	noErr(t, s.Users.SetActive(ctx, dave.ID, true))
+	count, err = s.Users.CountExpiredInvitations(ctx)
+	noErr(t, err)
+	if count != 1 {
+		t.Errorf("CountExpiredInvitations = %d, want 1", count)
+	}
+	deleted, err = s.Users.DeleteExpiredInvitations(ctx)
+	noErr(t, err)
+	if deleted != 1 {
+		t.Errorf("DeleteExpiredInvitations = %d, want 1", deleted)
+	}
+	wantErr(t, s.Users.Activate(ctx, "dave"), store.ErrNotFound)
+
+	// carol and the invitation wait for the grace period
+	invite(t, s, "carol", -time.Hour)
+	deleted, err = s.Users.DeleteExpiredInvitations(ctx)
+	noErr(t, err)
+	if deleted != 0 {
+		t.Errorf("DeleteExpiredInvitations = %d, want 0", deleted)
+	}
+	deleted, err = s.Users.DeleteUnactivated(ctx, time.Now().Add(-2*time.Hour))
+	noErr(t, err)
+	if deleted != 0 {
+		t.Errorf("DeleteUnactivated within the grace period = %d, want 0", deleted)
+	}
+	deleted, err = s.Users.DeleteUnactivated(ctx, time.Now())
+	noErr(t, err)
+	if deleted != 1 {
+		t.Errorf("DeleteUnactivated = %d, want 1", deleted)
+	}
+	_, err = s.Users.GetByUsername(ctx, "carol")
+	wantErr(t, err, store.ErrNotFound)
+}
+
+func testResendInvitation(t *testing.T, s store.Storage) {
+	alice := invite(t, s, "alice", time.Hour)
+	active := createUser(t, s, "bob")
+
+	retryAfter, err := s.Users.ResendInvitation(ctx, alice.ID, hash("new"), time.Hour, time.Hour, invitationEmail(t, alice))
+	wantErr(t, err, store.ErrRateLimited)
+	if retryAfter <= 59*time.Minute || retryAfter > time.Hour+time.Second {
+		t.Errorf("ResendInvitation retry after %v, want about an hour", retryAfter)
+	}
+
+	_, err = s.Users.ResendInvitation(ctx, active.ID, hash("new"), time.Hour, -time.Hour, invitationEmail(t, active))
+	wantErr(t, err, store.ErrNotFound)
+
+	_, err = s.Users.ResendInvitation(ctx, alice.ID, hash("new"), time.Hour, -time.Hour, invitationEmail(t, alice))
+	noErr(t, err)
+	wantErr(t, s.Users.Activate(ctx, "alice"), store.ErrNotFound)
+	noErr(t, s.Users.Activate(ctx, "new"))
+}
+
+func testDeleteUnactivated(t *testing.T, s store.Storage) {
+	invite(t, s, "expired", -time.Hour)
+	invite(t, s, "pending", time.Hour)
+	createUser(t, s, "active")
+
+	deleted, err := s.Users.DeleteUnactivated(ctx, time.Now())
+	noErr(t, err)
+	if deleted != 1 {
+		t.Fatalf("DeleteUnactivated = %d, want 1", deleted)
+	}
+
+	_, err = s.Users.GetByUsername(ctx, "expired")
+	wantErr(t, err, store.ErrNotFound)
+	for _, username := range []string{"pending", "active"} {
+		_, err = s.Users.GetByUsername(ctx, username)
+		noErr(t, err)
+	}
+}
+
+func testPosts(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+
+	post := createPost(t, s, alice.ID, "hello", "go", "sql")
+	if post.ID == 0 || post.CreatedAt.IsZero() || post.UpdatedAt.IsZero() {
+		t.Fatalf("Create did not set id and timestamps: %+v", post)
+	}
+
+	got, err := s.Posts.GetByID(ctx, post.ID)
+	noErr(t, err)
+	if got.Title != "hello" || got.UserID != alice.ID || got.Version != 0 || len(got.Tags) != 2 || !got.CreatedAt.Equal(post.CreatedAt) {
+		t.Errorf("GetByID = %+v", got)
+	}
+
+	_, err = s.Posts.GetByID(ctx, post.ID+100)
+	wantErr(t, err, store.ErrNotFound)
+
+	noErr(t, s.Posts.Delete(ctx, post.ID))
+	_, err = s.Posts.GetByID(ctx, post.ID)
+	wantErr(t, err, store.ErrNotFound)
+	wantErr(t, s.Posts.Delete(ctx, post.ID), store.ErrNotFound)
+}
+
+func testPostVersion(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	post := createPost(t, s, alice.ID, "draft")
+
+	stale := *post
+	post.Title = "first"
+	noErr(t, s.Posts.Update(ctx, post, nil))
+	if post.Version != 1 {
+		t.Fatalf("version after update = %d, want 1", post.Version)
+	}
+
+	stale.Title = "lost update"
+	wantErr(t, s.Posts.Update(ctx, &stale, nil), store.ErrNotFound)
+
+	got, err := s.Posts.GetByID(ctx, post.ID)
+	noErr(t, err)
+	if got.Title != "first" || got.Version != 1 {
+		t.Errorf("GetByID after update = %+v", got)
+	}
+
+	missing := &store.Post{ID: post.ID + 100, Title: "missing"}
+	wantErr(t, s.Posts.Update(ctx, missing, nil), store.ErrNotFound)
+}
+
+func testComments(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	post := createPost(t, s, alice.ID, "hello")
+
+	comments, err := s.Comments.GetByPostID(ctx, post.ID)
+	noErr(t, err)
+	if len(comments) != 0 {
+		t.Fatalf("GetByPostID on a new post = %+v", comments)
+	}
+
+	for i, author := range []*store.User{alice, bob} {
+		c := &store.Comment{PostID: post.ID, UserID: author.ID, Content: fmt.Sprintf("comment %d", i)}
+		noErr(t, s.Comments.Create(ctx, c))
+		if c.ID == 0 || c.CreatedAt == "" {
+			t.Fatalf("Create did not set id and created_at: %+v", c)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, c.CreatedAt); err != nil {
+			t.Errorf("created_at %q: %v", c.CreatedAt, err)
+		}
+	}
+
+	comments, err = s.Comments.GetByPostID(ctx, post.ID)
+	noErr(t, err)
+	if len(comments) != 2 {
+		t.Fatalf("GetByPostID returned %d comments, want 2", len(comments))
+	}
+	// newest first
+	if comments[0].User.Username != "bob" || comments[0].User.ID != bob.ID || comments[1].User.Username != "alice" {
+		t.Errorf("GetByPostID = %+v", comments)
+	}
+}
+
+func testFollowers(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+
+	noErr(t, s.Followers.Follow(ctx, alice.ID, bob.ID))
+	wantErr(t, s.Followers.Follow(ctx, alice.ID, bob.ID), store.ErrConflict)
+	wantErr(t, s.Followers.Follow(ctx, alice.ID, bob.ID+100), store.ErrNotFound)
+
+	noErr(t, s.Followers.UnFollow(ctx, alice.ID, bob.ID))
+	noErr(t, s.Followers.UnFollow(ctx, alice.ID, bob.ID))
+	noErr(t, s.Followers.Follow(ctx, alice.ID, bob.ID))
+}
+
+func testBlocks(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	carol := createUser(t, s, "carol")
+
+	check := func(name string, got []store.BlockedUser, want ...string) {
+		t.Helper()
+		var usernames []string
+		for _, b := range got {
+			usernames = append(usernames, b.Username)
+		}
+		if fmt.Sprint(usernames) != fmt.Sprint(want) {
+			t.Errorf("%s = %v, want %v", name, usernames, want)
+		}
+	}
+
+	noErr(t, s.Blocks.Block(ctx, alice.ID, bob.ID))
+	noErr(t, s.Blocks.Block(ctx, alice.ID, bob.ID))
+	noErr(t, s.Blocks.Block(ctx, alice.ID, carol.ID))
+	wantErr(t, s.Blocks.Block(ctx, alice.ID, carol.ID+100), store.ErrNotFound)
+	if err := s.Blocks.Block(ctx, alice.ID, alice.ID); err == nil {
+		t.Error("Block of oneself succeeded")
+	}
+
+	blocked, err := s.Blocks.List(ctx, alice.ID)
+	noErr(t, err)
+	check("List", blocked, "carol", "bob")
+	if !near(blocked[0].BlockedAt, time.Now()) {
+		t.Errorf("List[0].BlockedAt = %v, want about now", blocked[0].BlockedAt)
+	}
+	// blocks are listed by the blocker only
+	blocked, err = s.Blocks.List(ctx, bob.ID)
+	noErr(t, err)
+	check("List of the blocked", blocked)
+
+	noErr(t, s.Blocks.Unblock(ctx, alice.ID, bob.ID))
+	noErr(t, s.Blocks.Unblock(ctx, alice.ID, bob.ID))
+	blocked, err = s.Blocks.List(ctx, alice.ID)
+	noErr(t, err)
+	check("List after Unblock", blocked, "carol")
+
+	// deleting an account deletes its blocks
+	noErr(t, s.Users.Delete(ctx, carol.ID))
+	blocked, err = s.Blocks.List(ctx, alice.ID)
+	noErr(t, err)
+	check("List after deleting the blocked", blocked)
+}
+
+func testSuggestions(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	carol := createUser(t, s, "carol")
+	dave := createUser(t, s, "dave")
+	erin := createUser(t, s, "erin")
+	frank := invite(t, s, "frank", time.Hour)
+
+	for _, f := range [][2]*store.User{{alice, bob}, {bob, carol}, {bob, dave}, {bob, frank}, {erin, carol}, {carol, erin}} {
+		noErr(t, s.Followers.Follow(ctx, f[0].ID, f[1].ID))
+	}
+	createPost(t, s, alice.ID, "mine", "go")
+	createPost(t, s, dave.ID, "dave's", "go", "sql")
+
+	type suggestion struct {
+		username string
+		score    float64
+		reasons  string
+	}
+	check := func(name string, got []store.Suggestion, want ...suggestion) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s = %+v, want %d suggestions", name, got, len(want))
+			return
+		}
+		for i, g := range got {
+			reasons := fmt.Sprint(g.Reasons)
+			if g.Username != want[i].username || math.Abs(g.Score-want[i].score) > 0.001 || reasons != want[i].reasons {
+				t.Errorf("%s[%d] = %+v, want %+v", name, i, g, want[i])
+			}
+		}
+	}
+
+	// bob is followed already, frank isn't active
+	suggestions, err := s.Suggestions.List(ctx, alice.ID, 10)
+	noErr(t, err)
+	check("List", suggestions,
+		suggestion{"dave", 2 + math.Log(2) + 1, "[friends_of_friends popular shared_tags]"},
+		suggestion{"carol", 2 + math.Log(3), "[friends_of_friends popular]"},
+		suggestion{"erin", math.Log(2), "[popular]"},
+	)
+	suggestions, err = s.Suggestions.List(ctx, alice.ID, 1)
+	noErr(t, err)
+	check("List with limit", suggestions, suggestion{"dave", 2 + math.Log(2) + 1, "[friends_of_friends popular shared_tags]"})
+
+	noErr(t, s.Suggestions.Dismiss(ctx, alice.ID, dave.ID))
+	noErr(t, s.Suggestions.Dismiss(ctx, alice.ID, dave.ID))
+	wantErr(t, s.Suggestions.Dismiss(ctx, alice.ID, 404), store.ErrNotFound)
+	noErr(t, s.Followers.Follow(ctx, alice.ID, erin.ID))
+	suggestions, err = s.Suggestions.List(ctx, alice.ID, 10)
+	noErr(t, err)
+	check("List after dismissing and following", suggestions, suggestion{"carol", 2 + math.Log(3) + 2, "[friends_of_friends popular]"})
+
+	// blocks hide both ways
+	noErr(t, s.Blocks.Block(ctx, carol.ID, alice.ID))
+	noErr(t, s.Blocks.Block(ctx, carol.ID, alice.ID))
+	wantErr(t, s.Blocks.Block(ctx, carol.ID, 404), store.ErrNotFound)
+	suggestions, err = s.Suggestions.List(ctx, alice.ID, 10)
+	noErr(t, err)
+	check("List after being blocked", suggestions)
+	noErr(t, s.Blocks.Unblock(ctx, carol.ID, alice.ID))
+	noErr(t, s.Blocks.Unblock(ctx, carol.ID, alice.ID))
+	suggestions, err = s.Suggestions.List(ctx, alice.ID, 10)
+	noErr(t, err)
+	check("List after being unblocked", suggestions, suggestion{"carol", 2 + math.Log(3) + 2, "[friends_of_friends popular]"})
+
+	// only bob follows enough accounts
+	count, err := s.Suggestions.Precompute(ctx, 3, 10)
+	noErr(t, err)
+	if count != 1 {
+		t.Errorf("Precompute refreshed %d users, want 1", count)
+	}
+	gina := createUser(t, s, "gina")
+	noErr(t, s.Followers.Follow(ctx, carol.ID, gina.ID))
+
+	// the precomputed suggestions don't know gina yet
+	suggestions, err = s.Suggestions.List(ctx, bob.ID, 10)
+	noErr(t, err)
+	check("List of precomputed", suggestions, suggestion{"erin", 2 + math.Log(3), "[friends_of_friends popular]"})
+	// once none are left, they are computed again
+	noErr(t, s.Followers.Follow(ctx, bob.ID, erin.ID))
+	suggestions, err = s.Suggestions.List(ctx, bob.ID, 10)
+	noErr(t, err)
+	check("List after following the precomputed", suggestions, suggestion{"gina", 2 + math.Log(2), "[friends_of_friends popular]"})
+
+	// bob falls below the threshold, his stored erin isn't suggested anymore
+	for _, id := range []int64{erin.ID, dave.ID, frank.ID} {
+		noErr(t, s.Followers.UnFollow(ctx, bob.ID, id))
+	}
+	count, err = s.Suggestions.Precompute(ctx, 3, 10)
+	noErr(t, err)
+	if count != 0 {
+		t.Errorf("Precompute refreshed %d users, want 0", count)
+	}
+	suggestions, err = s.Suggestions.List(ctx, bob.ID, 10)
+	noErr(t, err)
+	if !slices.ContainsFunc(suggestions, func(s store.Suggestion) bool { return s.UserID == gina.ID }) {
+		t.Errorf("List after falling below the threshold = %+v, want them computed again", suggestions)
+	}
+}
+
+func testFeed(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	carol := createUser(t, s, "carol")
+
+	// alice follows bob, carol follows alice
+	noErr(t, s.Followers.Follow(ctx, alice.ID, bob.ID))
+	noErr(t, s.Followers.Follow(ctx, carol.ID, alice.ID))
+
+	own := createPost(t, s, alice.ID, "own post", "go")
+	followed := createPost(t, s, bob.ID, "followed post", "go", "sql")
+	createPost(t, s, carol.ID, "follower post", "go")
+
+	for i := 0; i < 3; i++ {
+		noErr(t, s.Comments.Create(ctx, &store.Comment{PostID: followed.ID, UserID: carol.ID, Content: "nice"}))
+	}
+
+	query := store.PaginatedFeedQuery{Limit: 20, Sort: "desc"}
+	feed, err := s.Posts.GetUserFeed(ctx, alice.ID, query)
+	noErr(t, err)
+	if len(feed) != 2 || feed[0].ID != followed.ID || feed[1].ID != own.ID {
+		t.Fatalf("feed = %+v", feed)
+	}
+	if feed[0].User.Username != "bob" || feed[0].CommentCount != 3 || feed[1].CommentCount != 0 {
+		t.Errorf("feed metadata = %+v", feed)
+	}
+
+	query.Sort = "asc"
+	feed, err = s.Posts.GetUserFeed(ctx, alice.ID, query)
+	noErr(t, err)
+	if len(feed) != 2 || feed[0].ID != own.ID {
+		t.Errorf("ascending feed = %+v", feed)
+	}
+
+	cases := []struct {
+		name  string
+		query store.PaginatedFeedQuery
+		want  []int64
+	}{
+		{"search", store.PaginatedFeedQuery{Limit: 20, Sort: "desc", Search: "FOLLOWED"}, []int64{followed.ID}},
+		{"tags", store.PaginatedFeedQuery{Limit: 20, Sort: "desc", Tags: []string{"sql", "go"}}, []int64{followed.ID}},
+		{"no match", store.PaginatedFeedQuery{Limit: 20, Sort: "desc", Tags: []string{"rust"}}, nil},
+		{"limit", store.PaginatedFeedQuery{Limit: 1, Sort: "desc"}, []int64{followed.ID}},
+		{"offset", store.PaginatedFeedQuery{Limit: 20, Offset: 1, Sort: "desc"}, []int64{own.ID}},
+	}
+	for _, tc := range cases {
+		feed, err := s.Posts.GetUserFeed(ctx, alice.ID, tc.query)
+		noErr(t, err)
+		var got []int64
+		for _, p := range feed {
+			got = append(got, p.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: feed = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	// bob doesn't follow anyone
+	feed, err = s.Posts.GetUserFeed(ctx, bob.ID, store.PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+	noErr(t, err)
+	if len(feed) != 1 || feed[0].ID != followed.ID {
+		t.Errorf("feed of bob = %+v", feed)
+	}
+}
+
+func testFeedCandidates(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	carol := createUser(t, s, "carol")
+	dave := createUser(t, s, "dave")
+
+	// alice follows bob, who follows carol, who follows dave
+	noErr(t, s.Followers.Follow(ctx, alice.ID, bob.ID))
+	noErr(t, s.Followers.Follow(ctx, bob.ID, carol.ID))
+	noErr(t, s.Followers.Follow(ctx, carol.ID, dave.ID))
+
+	own := &store.Post{UserID: alice.ID, Title: "own", Content: "hi @bob", Tags: []string{"go"}, Mentions: []string{"bob"}}
+	noErr(t, s.Posts.Create(ctx, own, nil))
+	followed := createPost(t, s, bob.ID, "followed", "go", "sql")
+	second := createPost(t, s, carol.ID, "second degree", "rust")
+	createPost(t, s, dave.ID, "third degree")
+	noErr(t, s.Comments.Create(ctx, &store.Comment{PostID: second.ID, UserID: alice.ID, Content: "nice"}))
+
+	at := time.Now().Add(time.Minute)
+	query := store.PaginatedFeedQuery{Limit: 20, Sort: "desc"}
+	candidates, err := s.Posts.GetFeedCandidates(ctx, alice.ID, at, query, 10)
+	noErr(t, err)
+	if len(candidates) != 3 || candidates[0].ID != second.ID || candidates[1].ID != followed.ID || candidates[2].ID != own.ID {
+		t.Fatalf("GetFeedCandidates = %+v", candidates)
+	}
+	type signals struct{ degree, affinity, tagOverlap, comments int }
+	want := []signals{{2, 1, 1, 1}, {1, 1, 1, 0}, {0, 0, 1, 0}}
+	for i, c := range candidates {
+		if got := (signals{c.Degree, c.Affinity, c.TagOverlap, c.CommentCount}); got != want[i] {
+			t.Errorf("signals of %q = %+v, want %+v", c.Title, got, want[i])
+		}
+	}
+	if candidates[1].User.Username != "bob" {
+		t.Errorf("author = %q, want bob", candidates[1].User.Username)
+	}
+
+	candidates, err = s.Posts.GetFeedCandidates(ctx, alice.ID, at, query, 1)
+	noErr(t, err)
+	if len(candidates) != 1 || candidates[0].ID != second.ID {
+		t.Errorf("GetFeedCandidates with limit = %+v", candidates)
+	}
+	query.Tags = []string{"sql"}
+	candidates, err = s.Posts.GetFeedCandidates(ctx, alice.ID, at, query, 10)
+	noErr(t, err)
+	if len(candidates) != 1 || candidates[0].ID != followed.ID {
+		t.Errorf("GetFeedCandidates filtered by tags = %+v", candidates)
+	}
+
+	// nothing existed an hour ago
+	candidates, err = s.Posts.GetFeedCandidates(ctx, alice.ID, time.Now().Add(-time.Hour), store.PaginatedFeedQuery{Limit: 20, Sort: "desc"}, 10)
+	noErr(t, err)
+	if len(candidates) != 0 {
+		t.Errorf("GetFeedCandidates before the posts = %+v", candidates)
+	}
+}
+
+func testBookmarks(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	first := createPost(t, s, bob.ID, "first")
+	second := createPost(t, s, bob.ID, "second")
+	own := createPost(t, s, alice.ID, "own")
+
+	later := &store.BookmarkCollection{UserID: alice.ID, Name: "later"}
+	noErr(t, s.Bookmarks.CreateCollection(ctx, later))
+	wantErr(t, s.Bookmarks.CreateCollection(ctx, &store.BookmarkCollection{UserID: alice.ID, Name: "later"}), store.ErrConflict)
+	bobs := &store.BookmarkCollection{UserID: bob.ID, Name: "later"}
+	noErr(t, s.Bookmarks.CreateCollection(ctx, bobs))
+
+	noErr(t, s.Bookmarks.Save(ctx, alice.ID, first.ID, nil))
+	noErr(t, s.Bookmarks.Save(ctx, alice.ID, second.ID, &later.ID))
+	noErr(t, s.Bookmarks.Save(ctx, alice.ID, own.ID, nil))
+	wantErr(t, s.Bookmarks.Save(ctx, alice.ID, own.ID, &bobs.ID), store.ErrNotFound)
+	wantErr(t, s.Bookmarks.Save(ctx, alice.ID, 404, nil), store.ErrNotFound)
+
+	check := func(name string, got []store.Bookmark, want ...*store.Post) {
+		t.Helper()
+		if len(got) != len(want) {
+			t.Errorf("%s = %+v, want %d bookmarks", name, got, len(want))
+			return
+		}
+		for i, b := range got {
+			if b.Post.ID != want[i].ID || b.Post.Title != want[i].Title || !b.Post.Bookmarked {
+				t.Errorf("%s[%d] = %+v, want post %d", name, i, b, want[i].ID)
+			}
+		}
+	}
+
+	bookmarks, err := s.Bookmarks.List(ctx, alice.ID, store.BookmarkQuery{Limit: 2})
+	noErr(t, err)
+	check("List", bookmarks, own, second)
+	if len(bookmarks) == 2 && (bookmarks[1].CollectionID == nil || *bookmarks[1].CollectionID != later.ID) {
+		t.Errorf("List[1].CollectionID = %v, want %d", bookmarks[1].CollectionID, later.ID)
+	}
+	if len(bookmarks) == 2 {
+		bookmarks, err = s.Bookmarks.List(ctx, alice.ID, store.BookmarkQuery{Before: bookmarks[1].ID, Limit: 2})
+		noErr(t, err)
+		check("List before", bookmarks, first)
+	}
+
+	// saving again moves the bookmark without changing its place
+	noErr(t, s.Bookmarks.Save(ctx, alice.ID, first.ID, &later.ID))
+	bookmarks, err = s.Bookmarks.List(ctx, alice.ID, store.BookmarkQuery{CollectionID: &later.ID, Limit: 10})
+	noErr(t, err)
+	check("List of a collection", bookmarks, second, first)
+	_, err = s.Bookmarks.List(ctx, alice.ID, store.BookmarkQuery{CollectionID: &bobs.ID, Limit: 10})
+	wantErr(t, err, store.ErrNotFound)
+
+	collections, err := s.Bookmarks.ListCollections(ctx, alice.ID)
+	noErr(t, err)
+	if len(collections) != 1 || collections[0].Name != "later" || collections[0].BookmarkCount != 2 {
+		t.Errorf("ListCollections = %+v, want later with 2 bookmarks", collections)
+	}
+
+	// the feeds flag the bookmarked posts
+	noErr(t, s.Bookmarks.Delete(ctx, alice.ID, own.ID))
+	noErr(t, s.Bookmarks.Delete(ctx, alice.ID, own.ID))
+	noErr(t, s.Followers.Follow(ctx, alice.ID, bob.ID))
+	feed, err := s.Posts.GetUserFeed(ctx, alice.ID, store.PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+	noErr(t, err)
+	for _, p := range feed {
+		if p.Bookmarked != (p.ID != own.ID) {
+			t.Errorf("GetUserFeed post %d Bookmarked = %v", p.ID, p.Bookmarked)
+		}
+	}
+	candidates, err := s.Posts.GetFeedCandidates(ctx, alice.ID, time.Now().Add(time.Minute), store.PaginatedFeedQuery{}, 20)
+	noErr(t, err)
+	for _, c := range candidates {
+		if c.Bookmarked != (c.ID != own.ID) {
+			t.Errorf("GetFeedCandidates post %d Bookmarked = %v", c.ID, c.Bookmarked)
+		}
+	}
+	if len(feed) != 3 || len(candidates) != 3 {
+		t.Errorf("got %d feed posts and %d candidates, want 3", len(feed), len(candidates))
+	}
+
+	// deleted posts leave the bookmarks, deleted collections leave theirs
+	noErr(t, s.Posts.Delete(ctx, second.ID))
+	wantErr(t, s.Bookmarks.DeleteCollection(ctx, bob.ID, later.ID), store.ErrNotFound)
+	noErr(t, s.Bookmarks.DeleteCollection(ctx, alice.ID, later.ID))
+	wantErr(t, s.Bookmarks.DeleteCollection(ctx, alice.ID, later.ID), store.ErrNotFound)
+	bookmarks, err = s.Bookmarks.List(ctx, alice.ID, store.BookmarkQuery{Limit: 10})
+	noErr(t, err)
+	check("List after deleting", bookmarks, first)
+	if len(bookmarks) == 1 && bookmarks[0].CollectionID != nil {
+		t.Errorf("List[0].CollectionID = %d, want none", *bookmarks[0].CollectionID)
+	}
+}
+
+func testTags(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+
+	first := createPost(t, s, alice.ID, "first", "go", "golang")
+	second := createPost(t, s, bob.ID, "second", "go", "sql")
+
+	tag, err := s.Tags.GetByName(ctx, "go")
+	noErr(t, err)
+	if tag.Name != "go" || tag.PostCount != 2 {
+		t.Errorf("GetByName = %+v", tag)
+	}
+	_, err = s.Tags.GetByName(ctx, "rust")
+	wantErr(t, err, store.ErrNotFound)
+
+	tags, err := s.Tags.Search(ctx, "go", 10)
+	noErr(t, err)
+	if len(tags) != 2 || tags[0].Name != "go" || tags[1].Name != "golang" || tags[1].PostCount != 1 {
+		t.Errorf("Search = %+v", tags)
+	}
+	tags, err = s.Tags.Search(ctx, "go", 1)
+	noErr(t, err)
+	if len(tags) != 1 || tags[0].Name != "go" {
+		t.Errorf("Search with limit = %+v", tags)
+	}
+	// _ isn't a wildcard
+	tags, err = s.Tags.Search(ctx, "g_", 10)
+	noErr(t, err)
+	if len(tags) != 0 {
+		t.Errorf("Search with an underscore = %+v", tags)
+	}
+
+	posts, err := s.Posts.GetByTag(ctx, "go", store.PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+	noErr(t, err)
+	if len(posts) != 2 || posts[0].ID != second.ID || posts[1].ID != first.ID || posts[0].User.Username != "bob" {
+		t.Errorf("GetByTag = %+v", posts)
+	}
+	posts, err = s.Posts.GetByTag(ctx, "go", store.PaginatedFeedQuery{Limit: 20, Sort: "desc", Tags: []string{"sql"}})
+	noErr(t, err)
+	if len(posts) != 1 || posts[0].ID != second.ID {
+		t.Errorf("GetByTag filtered by tags = %+v", posts)
+	}
+
+	// retagging and deleting keep the counts in line
+	first.Tags = []string{"sql"}
+	noErr(t, s.Posts.Update(ctx, first, nil))
+	noErr(t, s.Posts.Delete(ctx, second.ID))
+
+	_, err = s.Tags.GetByName(ctx, "go")
+	wantErr(t, err, store.ErrNotFound)
+	tag, err = s.Tags.GetByName(ctx, "sql")
+	noErr(t, err)
+	if tag.PostCount != 1 {
+		t.Errorf("sql post count = %d, want 1", tag.PostCount)
+	}
+	posts, err = s.Posts.GetByTag(ctx, "sql", store.PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+	noErr(t, err)
+	if len(posts) != 1 || posts[0].ID != first.ID {
+		t.Errorf("GetByTag after update = %+v", posts)
+	}
+}
+
+func testMentions(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	createUser(t, s, "bob")
+	createUser(t, s, "carol")
+	invite(t, s, "dave", time.Hour)
+
+	var notified []string
+	notify := func(post *store.Post, mentioned []store.User) ([]*store.OutboxEmail, error) {
+		if post.ID == 0 {
+			t.Errorf("notified of an unsaved post")
+		}
+		var emails []*store.OutboxEmail
+		for _, u := range mentioned {
+			notified = append(notified, u.Username)
+			email, err := store.NewOutboxEmail("mention", u.Username, u.Email, map[string]string{"Author": "alice"})
+			noErr(t, err)
+			emails = append(emails, email)
+		}
+		return emails, nil
+	}
+
+	// the author, an inactive and an unknown user are not notified
+	post := &store.Post{UserID: alice.ID, Title: "hi", Content: "hi", Mentions: []string{"carol", "bob", "alice", "dave", "nobody"}}
+	noErr(t, s.Posts.Create(ctx, post, notify))
+	if fmt.Sprint(post.Mentions) != "[alice bob carol]" || fmt.Sprint(notified) != "[bob carol]" {
+		t.Fatalf("mentions = %v, notified = %v", post.Mentions, notified)
+	}
+
+	got, err := s.Posts.GetByID(ctx, post.ID)
+	noErr(t, err)
+	if fmt.Sprint(got.Mentions) != "[alice bob carol]" {
+		t.Errorf("GetByID mentions = %v", got.Mentions)
+	}
+
+	// only the users mentioned for the first time are notified again
+	notified = nil
+	post.Mentions = []string{"bob", "dave"}
+	noErr(t, s.Users.Activate(ctx, "dave"))
+	noErr(t, s.Posts.Update(ctx, post, notify))
+	if fmt.Sprint(post.Mentions) != "[bob dave]" || fmt.Sprint(notified) != "[dave]" {
+		t.Errorf("after update mentions = %v, notified = %v", post.Mentions, notified)
+	}
+
+	emails, err := s.Outbox.Claim(ctx, 20, time.Hour)
+	noErr(t, err)
+	var recipients []string
+	for _, e := range emails {
+		if e.Template == "mention" {
+			recipients = append(recipients, e.Username)
+		}
+	}
+	if fmt.Sprint(recipients) != "[bob carol dave]" {
+		t.Errorf("mention emails sent to %v", recipients)
+	}
+
+	// a failing notify leaves the post untouched
+	failing := func(*store.Post, []store.User) ([]*store.OutboxEmail, error) { return nil, errors.New("boom") }
+	post.Title = "rolled back"
+	post.Mentions = []string{"carol"}
+	if err := s.Posts.Update(ctx, post, failing); err == nil {
+		t.Fatal("Update with a failing notifier succeeded")
+	}
+	got, err = s.Posts.GetByID(ctx, post.ID)
+	noErr(t, err)
+	if got.Title != "hi" || fmt.Sprint(got.Mentions) != "[bob dave]" {
+		t.Errorf("post after a failed update = %+v", got)
+	}
+}
+
+func testTrending(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+
+	quiet := createPost(t, s, alice.ID, "quiet", "go")
+	busy := createPost(t, s, bob.ID, "busy", "go", "sql")
+	other := createPost(t, s, bob.ID, "other", "rust")
+	for _, author := range []*store.User{alice, bob} {
+		noErr(t, s.Comments.Create(ctx, &store.Comment{PostID: busy.ID, UserID: author.ID, Content: "hot"}))
+	}
+
+	// a long half-life keeps the scores close to the event weights
+	params := store.TrendingParams{Window: time.Hour, HalfLife: 24 * time.Hour, Limit: 2}
+	noErr(t, s.Trending.Compute(ctx, params))
+
+	near := func(got, want float64) bool { return math.Abs(got-want) < 0.01 }
+	posts, err := s.Trending.Posts(ctx, 10)
+	noErr(t, err)
+	// ties go to the newest post
+	if len(posts) != 2 || posts[0].ID != busy.ID || posts[1].ID != other.ID {
+		t.Fatalf("Posts = %+v", posts)
+	}
+	if !near(posts[0].Score, 5) || posts[0].CommentCount != 2 || posts[0].User.Username != "bob" || posts[0].ComputedAt.IsZero() {
+		t.Errorf("busy post = %+v", posts[0])
+	}
+
+	tags, err := s.Trending.Tags(ctx, 10)
+	noErr(t, err)
+	if len(tags) != 2 || tags[0].Name != "go" || tags[1].Name != "sql" {
+		t.Fatalf("Tags = %+v", tags)
+	}
+	if !near(tags[0].Score, 6) || tags[0].PostCount != 2 {
+		t.Errorf("go tag = %+v", tags[0])
+	}
+	tags, err = s.Trending.Tags(ctx, 1)
+	noErr(t, err)
+	if len(tags) != 1 || tags[0].Name != "go" {
+		t.Errorf("Tags with limit = %+v", tags)
+	}
+
+	// deleted posts leave the snapshot, and so do tags without posts
+	noErr(t, s.Posts.Delete(ctx, busy.ID))
+	posts, err = s.Trending.Posts(ctx, 10)
+	noErr(t, err)
+	if len(posts) != 1 || posts[0].ID != other.ID {
+		t.Errorf("Posts after delete = %+v", posts)
+	}
+	tags, err = s.Trending.Tags(ctx, 10)
+	noErr(t, err)
+	if len(tags) != 1 || tags[0].Name != "go" || tags[0].PostCount != 1 {
+		t.Errorf("Tags after delete = %+v", tags)
+	}
+
+	// a new computation replaces the snapshot
+	noErr(t, s.Trending.Compute(ctx, params))
+	posts, err = s.Trending.Posts(ctx, 10)
+	noErr(t, err)
+	if len(posts) != 2 || posts[0].ID != other.ID || posts[1].ID != quiet.ID {
+		t.Errorf("Posts after recompute = %+v", posts)
+	}
+	tags, err = s.Trending.Tags(ctx, 10)
+	noErr(t, err)
+	// go and rust are about even, their order depends on the clock
+	if len(tags) != 2 || tags[0].Name+tags[1].Name != "gorust" && tags[0].Name+tags[1].Name != "rustgo" {
+		t.Errorf("Tags after recompute = %+v", tags)
+	}
+}
+
+func testRoles(t *testing.T, s store.Storage) {
+	for name, level := range map[string]int{"user": 1, "moderator": 2, "admin": 3} {
+		role, err := s.Roles.GetByName(ctx, name)
+		noErr(t, err)
+		if role.Level != level || role.Description == "" {
+			t.Errorf("role %s = %+v", name, role)
+		}
+	}
+	_, err := s.Roles.GetByName(ctx, "owner")
+	wantErr(t, err, store.ErrNotFound)
+}
+
+func testSessions(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+
+	session, err := s.Sessions.Create(ctx, alice.ID, hash("valid"), time.Hour)
+	noErr(t, err)
+	if session.UserID != alice.ID || !near(session.Expiry, time.Now().Add(time.Hour)) {
+		t.Errorf("Create = %+v", session)
+	}
+	_, err = s.Sessions.Create(ctx, alice.ID, hash("expired"), -time.Hour)
+	noErr(t, err)
+
+	id, err := s.Sessions.GetUserID(ctx, hash("valid"))
+	noErr(t, err)
+	if id != alice.ID {
+		t.Errorf("GetUserID = %d, want %d", id, alice.ID)
+	}
+	_, err = s.Sessions.GetUserID(ctx, hash("expired"))
+	wantErr(t, err, store.ErrNotFound)
+
+	noErr(t, s.Sessions.Delete(ctx, hash("valid")))
+	_, err = s.Sessions.GetUserID(ctx, hash("valid"))
+	wantErr(t, err, store.ErrNotFound)
+}
+
+func testEmailChange(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	_, err := s.Sessions.Create(ctx, alice.ID, hash("session"), time.Hour)
+	noErr(t, err)
+
+	err = s.Users.RequestEmailChange(ctx, alice.ID, "BOB@example.com", hash("taken"), time.Hour)
+	wantErr(t, err, store.ErrDuplicateEmail)
+
+	noErr(t, s.Users.RequestEmailChange(ctx, alice.ID, "old@example.com", hash("old"), time.Hour))
+	// a new request replaces the pending one
+	noErr(t, s.Users.RequestEmailChange(ctx, alice.ID, "new@example.com", hash("new"), time.Hour, invitationEmail(t, alice)))
+	_, err = s.Users.ConfirmEmailChange(ctx, hash("old"))
+	wantErr(t, err, store.ErrNotFound)
+
+	noErr(t, s.Users.RequestEmailChange(ctx, bob.ID, "late@example.com", hash("late"), -time.Hour))
+	_, err = s.Users.ConfirmEmailChange(ctx, hash("late"))
+	wantErr(t, err, store.ErrExpired)
+
+	user, err := s.Users.ConfirmEmailChange(ctx, hash("new"))
+	noErr(t, err)
+	if user.ID != alice.ID || user.Username != "alice" || user.Email != "new@example.com" {
+		t.Errorf("ConfirmEmailChange = %+v", user)
+	}
+	_, err = s.Users.GetByEmail(ctx, "new@example.com")
+	noErr(t, err)
+	_, err = s.Sessions.GetUserID(ctx, hash("session"))
+	wantErr(t, err, store.ErrNotFound)
+	_, err = s.Users.ConfirmEmailChange(ctx, hash("new"))
+	wantErr(t, err, store.ErrNotFound)
+}
+
+func testProfile(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	createUser(t, s, "bob")
+
+	user, err := s.Users.GetByID(ctx, alice.ID)
+	noErr(t, err)
+	user.DisplayName = "Alice"
+	user.Bio = "hello"
+	user.PreferredLocale = "de"
+	noErr(t, s.Users.UpdateProfile(ctx, user, time.Hour))
+	if user.UsernameChangedAt != nil {
+		t.Error("UsernameChangedAt set without a username change")
+	}
+
+	user.Username = "bob"
+	wantErr(t, s.Users.UpdateProfile(ctx, user, time.Hour), store.ErrDuplicateUsername)
+
+	user, err = s.Users.GetByID(ctx, alice.ID)
+	noErr(t, err)
+	user.Username = "alicia"
+	noErr(t, s.Users.UpdateProfile(ctx, user, time.Hour))
+	if user.UsernameChangedAt == nil {
+		t.Fatal("UsernameChangedAt not set")
+	}
+
+	got, err := s.Users.GetByID(ctx, alice.ID)
+	noErr(t, err)
+	if got.Username != "alicia" || got.DisplayName != "Alice" || got.Bio != "hello" || got.PreferredLocale != "de" || got.UsernameChangedAt == nil {
+		t.Errorf("GetByID after UpdateProfile = %+v", got)
+	}
+
+	current, err := s.Users.ResolveUsername(ctx, "alice")
+	noErr(t, err)
+	if current != "alicia" {
+		t.Errorf("ResolveUsername = %q, want alicia", current)
+	}
+	_, err = s.Users.ResolveUsername(ctx, "nobody")
+	wantErr(t, err, store.ErrNotFound)
+
+	got.Username = "ally"
+	wantErr(t, s.Users.UpdateProfile(ctx, got, time.Hour), store.ErrUsernameCooldown)
+
+	missing := &store.User{ID: alice.ID + 100, Username: "missing"}
+	wantErr(t, s.Users.UpdateProfile(ctx, missing, time.Hour), store.ErrNotFound)
+}
+
+func testAvatar(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+
+	first := &store.Media{UserID: alice.ID, Kind: store.MediaAvatar, StorageKey: "avatars/1", ContentType: "image/png", Size: 10}
+	noErr(t, s.Media.Create(ctx, first))
+	second := &store.Media{UserID: alice.ID, Kind: store.MediaAvatar, StorageKey: "avatars/2", ContentType: "image/png", Size: 20}
+	noErr(t, s.Media.Create(ctx, second))
+
+	previous, err := s.Users.SetAvatar(ctx, alice.ID, &first.ID)
+	noErr(t, err)
+	if previous != nil {
+		t.Errorf("previous avatar = %d, want none", *previous)
+	}
+	previous, err = s.Users.SetAvatar(ctx, alice.ID, &second.ID)
+	noErr(t, err)
+	if previous == nil || *previous != first.ID {
+		t.Errorf("previous avatar = %v, want %d", previous, first.ID)
+	}
+	_, err = s.Users.SetAvatar(ctx, alice.ID+100, nil)
+	wantErr(t, err, store.ErrNotFound)
+
+	m, err := s.Media.GetByID(ctx, second.ID)
+	noErr(t, err)
+	if m.StorageKey != "avatars/2" || m.Size != 20 {
+		t.Errorf("GetByID = %+v", m)
+	}
+
+	// deleting the media clears the avatar
+	noErr(t, s.Media.Delete(ctx, second.ID))
+	_, err = s.Media.GetByID(ctx, second.ID)
+	wantErr(t, err, store.ErrNotFound)
+	user, err := s.Users.GetByID(ctx, alice.ID)
+	noErr(t, err)
+	if user.AvatarID != nil {
+		t.Errorf("avatar = %d after its media was deleted", *user.AvatarID)
+	}
+}
+
+func testErasure(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	bob := createUser(t, s, "bob")
+	noErr(t, s.Followers.Follow(ctx, bob.ID, alice.ID))
+
+	post := createPost(t, s, alice.ID, "bye")
+	noErr(t, s.Comments.Create(ctx, &store.Comment{PostID: post.ID, UserID: bob.ID, Content: "why"}))
+	m := &store.Media{UserID: alice.ID, Kind: store.MediaAvatar, StorageKey: "avatars/alice", ContentType: "image/png", Size: 1}
+	noErr(t, s.Media.Create(ctx, m))
+	_, err := s.Sessions.Create(ctx, alice.ID, hash("session"), time.Hour)
+	noErr(t, err)
+
+	noErr(t, s.Users.ScheduleDeletion(ctx, alice.ID, time.Now().Add(time.Hour)))
+	_, err = s.Sessions.GetUserID(ctx, hash("session"))
+	wantErr(t, err, store.ErrNotFound)
+
+	_, err = s.Users.Erase(ctx, alice.ID)
+	wantErr(t, err, store.ErrNotFound)
+	due, err := s.Users.DueForErasure(ctx, 10)
+	noErr(t, err)
+	if len(due) != 0 {
+		t.Errorf("DueForErasure = %v before the grace period", due)
+	}
+
+	cancelled, err := s.Users.CancelDeletion(ctx, alice.ID)
+	noErr(t, err)
+	if !cancelled {
+		t.Error("CancelDeletion reported no pending deletion")
+	}
+	cancelled, err = s.Users.CancelDeletion(ctx, alice.ID)
+	noErr(t, err)
+	if cancelled {
+		t.Error("CancelDeletion cancelled twice")
+	}
+
+	noErr(t, s.Users.ScheduleDeletion(ctx, alice.ID, time.Now().Add(-time.Minute)))
+	wantErr(t, s.Users.ScheduleDeletion(ctx, alice.ID+100, time.Now()), store.ErrNotFound)
+	due, err = s.Users.DueForErasure(ctx, 10)
+	noErr(t, err)
+	if len(due) != 1 || due[0] != alice.ID {
+		t.Fatalf("DueForErasure = %v, want [%d]", due, alice.ID)
+	}
+
+	keys, err := s.Users.Erase(ctx, alice.ID)
+	noErr(t, err)
+	if len(keys) != 1 || keys[0] != "avatars/alice" {
+		t.Errorf("Erase returned keys %v", keys)
+	}
+
+	_, err = s.Users.GetByID(ctx, alice.ID)
+	wantErr(t, err, store.ErrNotFound)
+	_, err = s.Posts.GetByID(ctx, post.ID)
+	wantErr(t, err, store.ErrNotFound)
+	comments, err := s.Comments.GetByPostID(ctx, post.ID)
+	noErr(t, err)
+	if len(comments) != 0 {
+		t.Errorf("comments on an erased post: %+v", comments)
+	}
+	// bob no longer follows anyone
+	feed, err := s.Posts.GetUserFeed(ctx, bob.ID, store.PaginatedFeedQuery{Limit: 20, Sort: "desc"})
+	noErr(t, err)
+	if len(feed) != 0 {
+		t.Errorf("feed of bob = %+v", feed)
+	}
+}
+
+func testExports(t *testing.T, s store.Storage) {
+	alice := createUser(t, s, "alice")
+	post := createPost(t, s, alice.ID, "mine", "go")
+	_, err := s.Sessions.Create(ctx, alice.ID, hash("session"), time.Hour)
+	noErr(t, err)
+
+	export, err := s.Exports.Request(ctx, alice.ID)
+	noErr(t, err)
+	if export.ID == 0 || export.Status != store.ExportPending || export.UserID != alice.ID || export.RequestedAt.IsZero() {
+		t.Fatalf("Request = %+v", export)
+	}
+	_, err = s.Exports.Request(ctx, alice.ID)
+	wantErr(t, err, store.ErrConflict)
+
+	claimed, err := s.Exports.Claim(ctx, time.Hour)
+	noErr(t, err)
+	if claimed.ID != export.ID || claimed.Status != store.ExportProcessing || claimed.Attempts != 1 {
+		t.Fatalf("Claim = %+v", claimed)
+	}
+	_, err = s.Exports.Claim(ctx, time.Hour)
+	wantErr(t, err, store.ErrNotFound)
+	_, err = s.Exports.Request(ctx, alice.ID)
+	wantErr(t, err, store.ErrConflict)
+
+	noErr(t, s.Exports.Fail(ctx, export.ID, "boom", false))
+	claimed, err = s.Exports.Claim(ctx, time.Hour)
+	noErr(t, err)
+	if claimed.Attempts != 2 {
+		t.Errorf("attempts after a retry = %d, want 2", claimed.Attempts)
+	}
+
+	expires := time.Now().Add(-time.Minute)
+	claimed.StorageKey = "exports/1.zip"
+	claimed.Size = 42
+	claimed.ExpiresAt = &expires
+	noErr(t, s.Exports.Complete(ctx, claimed, invitationEmail(t, alice)))
+	if claimed.Status != store.ExportReady || claimed.CompletedAt == nil {
+		t.Errorf("Complete = %+v", claimed)
+	}
+
+	got, err := s.Exports.GetByID(ctx, export.ID)
+	noErr(t, err)
+	if got.Status != store.ExportReady || got.StorageKey != "exports/1.zip" || got.Size != 42 || got.ExpiresAt == nil {
+		t.Errorf("GetByID = %+v", got)
+	}
+	_, err = s.Exports.GetByID(ctx, export.ID+100)
+	wantErr(t, err, store.ErrNotFound)
+
+	// a ready export doesn't block a new request
+	second, err := s.Exports.Request(ctx, alice.ID)
+	noErr(t, err)
+	exports, err := s.Exports.ListByUser(ctx, alice.ID)
+	noErr(t, err)
+	if len(exports) != 2 || exports[0].ID != second.ID || exports[1].ID != export.ID {
+		t.Errorf("ListByUser = %+v", exports)
+	}
+	exports, err = s.Exports.ListByUser(ctx, alice.ID+100)
+	noErr(t, err)
+	if exports == nil || len(exports) != 0 {
+		t.Errorf("ListByUser of an unknown user = %#v, want an empty list", exports)
+	}
+
+	expired, err := s.Exports.Expire(ctx, 10)
+	noErr(t, err)
+	if len(expired) != 1 || expired[0].ID != export.ID || expired[0].Status != store.ExportExpired || expired[0].StorageKey != "exports/1.zip" {
+		t.Errorf("Expire = %+v", expired)
+	}
+	expired, err = s.Exports.Expire(ctx, 10)
+	noErr(t, err)
+	if len(expired) != 0 {
+		t.Errorf("Expire twice = %+v", expired)
+	}
+
+	data, err := s.Exports.Collect(ctx, alice.ID)
+	noErr(t, err)
+	if data.Profile.ID != alice.ID || len(data.Posts) != 1 || data.Posts[0].ID != post.ID || len(data.Sessions) != 1 {
+		t.Errorf("Collect = %+v", data)
+	}
+	_, err = s.Exports.Collect(ctx, alice.ID+100)
+	wantErr(t, err, store.ErrNotFound)
+}
+
+func testOutbox(t *testing.T, s store.Storage) {
+	invite(t, s, "alice", time.Hour)
+
+	emails, err := s.Outbox.Claim(ctx, 10, time.Hour)
+	noErr(t, err)
+	if len(emails) != 1 {
+		t.Fatalf("Claim returned %d emails, want 1", len(emails))
+	}
+	email := emails[0]
+	if email.Template != "user_invitation" || email.Email != "alice@example.com" || email.Attempts != 1 || email.Status != store.OutboxPending {
+		t.Errorf("Claim = %+v", email)
+	}
+	var data map[string]string
+	if err := json.Unmarshal(email.Data, &data); err != nil || data["username"] != "alice" {
+		t.Errorf("email data = %s (%v)", email.Data, err)
+	}
+
+	// claimed emails are leased
+	emails, err = s.Outbox.Claim(ctx, 10, time.Hour)
+	noErr(t, err)
+	if len(emails) != 0 {
+		t.Fatalf("leased email claimed again: %+v", emails)
+	}
+
+	noErr(t, s.Outbox.MarkFailed(ctx, email.ID, "smtp down", time.Now().Add(-time.Minute), false))
+	emails, err = s.Outbox.Claim(ctx, 10, time.Hour)
+	noErr(t, err)
+	if len(emails) != 1 || emails[0].Attempts != 2 || emails[0].LastError != "smtp down" {
+		t.Fatalf("Claim after a failure = %+v", emails)
+	}
+
+	noErr(t, s.Outbox.MarkSent(ctx, email.ID))
+	noErr(t, s.Outbox.MarkFailed(ctx, email.ID, "ignored", time.Now().Add(-time.Minute), true))
+	emails, err = s.Outbox.Claim(ctx, 10, time.Hour)
+	noErr(t, err)
+	if len(emails) != 0 {
+		t.Errorf("dead email claimed: %+v", emails)
+	}
+
+	// sent emails are purged after the retention, the others are kept
+	invite(t, s, "bob", time.Hour)
+	emails, err = s.Outbox.Claim(ctx, 10, time.Hour)
+	noErr(t, err)
+	if len(emails) != 1 {
+		t.Fatalf("Claim returned %d emails, want 1", len(emails))
+	}
+	noErr(t, s.Outbox.MarkSent(ctx, emails[0].ID))
+	invite(t, s, "carol", time.Hour)
+
+	deleted, err := s.Outbox.DeleteSent(ctx, time.Now().Add(-time.Hour))
+	noErr(t, err)
+	if deleted != 0 {
+		t.Errorf("DeleteSent within the retention = %d, want 0", deleted)
+	}
+	deleted, err = s.Outbox.DeleteSent(ctx, time.Now().Add(time.Second))
+	noErr(t, err)
+	if deleted != 1 {
+		t.Errorf("DeleteSent = %d, want 1", deleted)
+	}
+	emails, err = s.Outbox.Claim(ctx, 10, time.Hour)
+	noErr(t, err)
+	if len(emails) != 1 || emails[0].Email != "carol@example.com" {
+		t.Errorf("Claim after DeleteSent = %+v", emails)
+	}
+}
+
+func testIdempotency(t *testing.T, s store.Storage) {
+	begin := func(key, fingerprint string, ttl, lease time.Duration) *store.IdempotencyKey {
+		t.Helper()
+		existing, err := s.Idempotency.Begin(ctx, &store.IdempotencyKey{Scope: "user:1", Key: key, Fingerprint: fingerprint}, ttl, lease)
+		noErr(t, err)
+		return existing
+	}
+
+	if existing := begin("a", hash("a"), time.Hour, time.Hour); existing != nil {
+		t.Fatalf("Begin of a new key = %+v", existing)
+	}
+	existing := begin("a", hash("a"), time.Hour, time.Hour)
+	if existing == nil || existing.Completed() || existing.Fingerprint != hash("a") {
+		t.Fatalf("Begin while in progress = %+v", existing)
+	}
+	if !near(existing.ExpiresAt, time.Now().Add(time.Hour)) {
+		t.Errorf("ExpiresAt = %v", existing.ExpiresAt)
+	}
+	// the scope keeps clients apart
+	other, err := s.Idempotency.Begin(ctx, &store.IdempotencyKey{Scope: "user:2", Key: "a", Fingerprint: hash("b")}, time.Hour, time.Hour)
+	noErr(t, err)
+	if other != nil {
+		t.Errorf("Begin in another scope = %+v", other)
+	}
+
+	wantErr(t, s.Idempotency.Complete(ctx, &store.IdempotencyKey{Scope: "user:1", Key: "a", Fingerprint: hash("b"), Status: 201}), store.ErrNotFound)
+	noErr(t, s.Idempotency.Complete(ctx, &store.IdempotencyKey{
+		Scope:       "user:1",
+		Key:         "a",
+		Fingerprint: hash("a"),
+		Status:      201,
+		Header:      map[string][]string{"Content-Type": {"application/json"}},
+		Body:        []byte(`{"data":1}`),
+	}))
+	wantErr(t, s.Idempotency.Complete(ctx, &store.IdempotencyKey{Scope: "user:1", Key: "a", Fingerprint: hash("a"), Status: 200}), store.ErrNotFound)
+
+	// completed keys are replayed and never released
+	noErr(t, s.Idempotency.Release(ctx, "user:1", "a"))
+	existing = begin("a", hash("b"), time.Hour, time.Hour)
+	if existing == nil || existing.Status != 201 || existing.Fingerprint != hash("a") || string(existing.Body) != `{"data":1}` ||
+		fmt.Sprint(existing.Header) != fmt.Sprint(map[string][]string{"Content-Type": {"application/json"}}) {
+		t.Fatalf("Begin of a completed key = %+v", existing)
+	}
+
+	// released keys can be used again
+	begin("b", hash("b"), time.Hour, time.Hour)
+	noErr(t, s.Idempotency.Release(ctx, "user:1", "b"))
+	if existing := begin("b", hash("c"), time.Hour, time.Hour); existing != nil {
+		t.Errorf("Begin of a released key = %+v", existing)
+	}
+
+	// abandoned requests are taken over by their retries only
+	begin("c", hash("c"), time.Hour, -time.Minute)
+	if existing := begin("c", hash("d"), time.Hour, time.Hour); existing == nil || existing.Fingerprint != hash("c") {
+		t.Errorf("Begin of an abandoned key with another request = %+v", existing)
+	}
+	if existing := begin("c", hash("c"), time.Hour, time.Hour); existing != nil {
+		t.Errorf("Begin of an abandoned key = %+v", existing)
+	}
+
+	// expired keys are claimed again and purged
+	begin("d", hash("d"), -time.Minute, time.Hour)
+	begin("e", hash("e"), -time.Minute, time.Hour)
+	if existing := begin("d", hash("x"), time.Hour, time.Hour); existing != nil {
+		t.Errorf("Begin of an expired key = %+v", existing)
+	}
+	n, err := s.Idempotency.DeleteExpired(ctx)
+	noErr(t, err)
+	if n != 1 {
+		t.Errorf("DeleteExpired = %d, want 1", n)
+	}
+	if existing := begin("d", hash("x"), time.Hour, time.Hour); existing == nil {
+		t.Error("reclaimed key was purged")
+	}
+}
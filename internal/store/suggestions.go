@@ -0,0 +1,245 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Reasons a user is suggested to follow an account.
+const (
+	// SuggestionFriendsOfFriends: followed by accounts the user follows.
+	SuggestionFriendsOfFriends = "friends_of_friends"
+	// SuggestionPopular: among the most followed accounts.
+	SuggestionPopular = "popular"
+	// SuggestionSharedTags: posts in tags the user posts or comments in.
+	SuggestionSharedTags = "shared_tags"
+)
+
+// Weights of the reasons in the score of a suggestion: every follow by a
+// followed account and every shared tag count, popularity grows with the
+// logarithm of the follower count.
+const (
+	SuggestionFriendWeight     = 2.0
+	SuggestionTagWeight        = 1.0
+	SuggestionPopularityWeight = 1.0
+	// SuggestionPopularPool is the number of most followed accounts suggested
+	// for their popularity.
+	SuggestionPopularPool = 50
+)
+
+type Suggestion struct {
+	UserID   int64    `json:"user_id"`
+	Username string   `json:"username"`
+	Score    float64  `json:"score"`
+	Reasons  []string `json:"reasons"`
+}
+
+type SuggestionStore struct {
+	db *sql.DB
+}
+
+// suggestionsQuery scores the accounts $1 could follow, leaving out itself,
+// the accounts it follows, dismissed or is blocked from and the inactive or
+// leaving ones. $2 is the limit.
+const suggestionsQuery = `
+	WITH followed AS (
+		SELECT user_id FROM followers WHERE follower_id = $1
+	), interests AS (
+		SELECT DISTINCT pt.tag_id
+		FROM post_tags pt
+		JOIN posts ip ON ip.id = pt.post_id
+		WHERE ip.user_id = $1 OR ip.id IN (SELECT post_id FROM comments WHERE user_id = $1)
+	), candidates AS (
+		SELECT f.user_id, '` + SuggestionFriendsOfFriends + `' AS reason, $3::float8 * COUNT(*) AS score
+		FROM followers f
+		JOIN followed ON followed.user_id = f.follower_id
+		GROUP BY f.user_id
+		UNION ALL
+		SELECT p.user_id, '` + SuggestionSharedTags + `', $4::float8 * COUNT(DISTINCT pt.tag_id)
+		FROM posts p
+		JOIN post_tags pt ON pt.post_id = p.id
+		WHERE pt.tag_id IN (SELECT tag_id FROM interests)
+		GROUP BY p.user_id
+		UNION ALL
+		(
+			SELECT user_id, '` + SuggestionPopular + `', $5::float8 * LN(1 + COUNT(*)::float8)
+			FROM followers
+			GROUP BY user_id
+			ORDER BY COUNT(*) DESC, user_id
+			LIMIT $6
+		)
+	)
+	SELECT u.id, u.username, SUM(c.score) AS score, ARRAY_AGG(c.reason ORDER BY c.reason)
+	FROM candidates c
+	JOIN users u ON u.id = c.user_id
+	WHERE
+		u.id <> $1 AND u.is_active AND u.deletion_scheduled_at IS NULL AND
+		u.id NOT IN (SELECT user_id FROM followed) AND
+		u.id NOT IN (SELECT suggested_id FROM follow_suggestion_dismissals WHERE user_id = $1) AND
+		u.id NOT IN (` + blockedBy + `)
+	GROUP BY u.id, u.username
+	ORDER BY score DESC, u.id
+	LIMIT $2
+`
+
+func suggestionArgs(userID int64, limit int) []any {
+	return []any{userID, limit, SuggestionFriendWeight, SuggestionTagWeight, SuggestionPopularityWeight, SuggestionPopularPool}
+}
+
+// List returns the suggestions of a user, the precomputed ones when the
+// precomputation job got to them and some are left, computed on the spot
+// otherwise.
+func (s *SuggestionStore) List(ctx context.Context, userID int64, limit int) ([]Suggestion, error) {
+	query := `
+		SELECT u.id, u.username, s.score, s.reasons
+		FROM follow_suggestions s
+		JOIN users u ON u.id = s.suggested_id
+		WHERE
+			s.user_id = $1 AND u.is_active AND u.deletion_scheduled_at IS NULL AND
+			u.id NOT IN (SELECT user_id FROM followers WHERE follower_id = $1) AND
+			u.id NOT IN (SELECT suggested_id FROM follow_suggestion_dismissals WHERE user_id = $1) AND
+			u.id NOT IN (` + blockedBy + `)
+		ORDER BY s.score DESC, u.id
+		LIMIT $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	suggestions, err := scanSuggestions(rows)
+	if err != nil || len(suggestions) > 0 {
+		return suggestions, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, suggestionsQuery, suggestionArgs(userID, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	return scanSuggestions(rows)
+}
+
+func scanSuggestions(rows *sql.Rows) ([]Suggestion, error) {
+	defer rows.Close()
+	var suggestions []Suggestion
+	for rows.Next() {
+		var s Suggestion
+		if err := rows.Scan(&s.UserID, &s.Username, &s.Score, pq.Array(&s.Reasons)); err != nil {
+			return nil, err
+		}
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, rows.Err()
+}
+
+// Precompute stores the suggestions of the users following at least
+// minFollowing accounts, whose suggestions are the slowest to compute, and
+// drops the stored ones of the users who fell below it. It returns the number
+// of users refreshed.
+func (s *SuggestionStore) Precompute(ctx context.Context, minFollowing, limit int) (int64, error) {
+	query := `
+		SELECT follower_id FROM followers
+		GROUP BY follower_id
+		HAVING COUNT(*) >= $1
+		ORDER BY follower_id
+	`
+
+	listCtx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(listCtx, query, minFollowing)
+	if err != nil {
+		return 0, err
+	}
+	var users []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		users = append(users, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// their suggestions are computed on request again
+	stale := `
+		DELETE FROM follow_suggestions
+		WHERE user_id NOT IN (SELECT follower_id FROM followers GROUP BY follower_id HAVING COUNT(*) >= $1)
+	`
+	if _, err := s.db.ExecContext(listCtx, stale, minFollowing); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, id := range users {
+		if err := s.precompute(ctx, id, limit); err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// precompute replaces the stored suggestions of a user. Concurrent runs
+// upsert the same rows rather than conflicting.
+func (s *SuggestionStore) precompute(ctx context.Context, userID int64, limit int) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM follow_suggestions WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		query := `
+			INSERT INTO follow_suggestions (user_id, suggested_id, score, reasons)
+			SELECT $1, id, score, reasons FROM (` + suggestionsQuery + `) AS suggestions (id, username, score, reasons)
+			ON CONFLICT (user_id, suggested_id) DO UPDATE
+			SET score = EXCLUDED.score, reasons = EXCLUDED.reasons, computed_at = NOW()
+		`
+		_, err := tx.ExecContext(ctx, query, suggestionArgs(userID, limit)...)
+		return err
+	})
+}
+
+// Dismiss hides an account from the suggestions of a user. Dismissing twice
+// is a no-op, an unknown account is ErrNotFound.
+func (s *SuggestionStore) Dismiss(ctx context.Context, userID, suggestedID int64) error {
+	query := `
+		INSERT INTO follow_suggestion_dismissals (user_id, suggested_id)
+		SELECT $1, id FROM users WHERE id = $2
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, suggestedID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil || rows > 0 {
+		return err
+	}
+
+	// nothing inserted: already dismissed, or no such user
+	var exists bool
+	err = s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, suggestedID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
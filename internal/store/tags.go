@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Tag is a normalized hashtag and the number of posts using it.
+type Tag struct {
+	ID        int64     `json:"-"`
+	Name      string    `json:"name"`
+	PostCount int64     `json:"post_count"`
+	CreatedAt time.Time `json:"-"`
+}
+
+type TagStore struct {
+	db *sql.DB
+}
+
+// GetByName returns a tag used by at least one post.
+func (s *TagStore) GetByName(ctx context.Context, name string) (*Tag, error) {
+	query := `SELECT id, name, post_count, created_at FROM tags WHERE name = $1 AND post_count > 0`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	var tag Tag
+	err := s.db.QueryRowContext(ctx, query, name).Scan(&tag.ID, &tag.Name, &tag.PostCount, &tag.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &tag, nil
+}
+
+// Search returns up to limit tags in use starting with prefix, the most used
+// first.
+func (s *TagStore) Search(ctx context.Context, prefix string, limit int) ([]Tag, error) {
+	query := `
+		SELECT id, name, post_count, created_at
+		FROM tags
+		WHERE name LIKE $1 || '%' AND post_count > 0
+		ORDER BY post_count DESC, name
+		LIMIT $2`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, escapeLike(prefix), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []Tag
+	for rows.Next() {
+		var tag Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.PostCount, &tag.CreatedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// escapeLike quotes the LIKE wildcards of s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
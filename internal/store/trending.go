@@ -0,0 +1,189 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Weights of the events a trending score adds up. There is no reactions
+// table, posts and comments are the only activity recorded.
+const (
+	TrendingPostWeight    = 1.0
+	TrendingCommentWeight = 2.0
+)
+
+// TrendingParams tune the trending computation.
+type TrendingParams struct {
+	// Window bounds the age of the events taken into account.
+	Window time.Duration
+	// HalfLife is the age at which an event weighs half as much as a new one.
+	HalfLife time.Duration
+	// Limit is the number of tags and of posts kept in the snapshot.
+	Limit int
+}
+
+type TrendingTag struct {
+	Name       string    `json:"name"`
+	PostCount  int64     `json:"post_count"`
+	Score      float64   `json:"score"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+type TrendingPost struct {
+	PostWithMetadata
+	Score      float64   `json:"score"`
+	ComputedAt time.Time `json:"computed_at"`
+}
+
+type TrendingStore struct {
+	db *sql.DB
+}
+
+// trendingScores scores the posts with activity in the window, every event
+// weighing half as much each half-life. A post older than the window can
+// still trend from its recent comments.
+const trendingScores = `
+	WITH events AS (
+		SELECT id AS post_id, created_at, $3::float8 AS weight
+		FROM posts
+		WHERE created_at > NOW() - make_interval(secs => $1)
+		UNION ALL
+		SELECT c.post_id, c.created_at, $4::float8
+		FROM comments c
+		JOIN posts p ON p.id = c.post_id
+		WHERE c.created_at > NOW() - make_interval(secs => $1)
+	), scores AS (
+		SELECT post_id,
+			SUM(weight * power(0.5, GREATEST(EXTRACT(EPOCH FROM NOW() - created_at)::float8, 0) / $2)) AS score
+		FROM events
+		GROUP BY post_id
+	)`
+
+// Compute replaces the snapshot with the current scores. Concurrent runs are
+// serialized by the table locks, the last one wins.
+func (s *TrendingStore) Compute(ctx context.Context, params TrendingParams) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		// readers keep seeing the previous snapshot until the commit
+		if _, err := tx.ExecContext(ctx, `LOCK TABLE trending_tags, trending_posts IN EXCLUSIVE MODE`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM trending_tags`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM trending_posts`); err != nil {
+			return err
+		}
+
+		args := []any{params.Window.Seconds(), params.HalfLife.Seconds(), TrendingPostWeight, TrendingCommentWeight, params.Limit}
+
+		query := trendingScores + `
+			INSERT INTO trending_posts (post_id, rank, score)
+			SELECT post_id, ROW_NUMBER() OVER (ORDER BY score DESC, post_id DESC), score
+			FROM scores
+			ORDER BY score DESC, post_id DESC
+			LIMIT $5`
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+
+		query = trendingScores + `
+			INSERT INTO trending_tags (tag_id, rank, score)
+			SELECT id, ROW_NUMBER() OVER (ORDER BY score DESC, name), score
+			FROM (
+				SELECT t.id, t.name, SUM(s.score) AS score
+				FROM scores s
+				JOIN post_tags pt ON pt.post_id = s.post_id
+				JOIN tags t ON t.id = pt.tag_id
+				GROUP BY t.id, t.name
+			) tag_scores
+			ORDER BY score DESC, name
+			LIMIT $5`
+		_, err := tx.ExecContext(ctx, query, args...)
+		return err
+	})
+}
+
+// Tags returns the top of the last snapshot.
+func (s *TrendingStore) Tags(ctx context.Context, limit int) ([]TrendingTag, error) {
+	query := `
+		SELECT t.name, t.post_count, tt.score, tt.computed_at
+		FROM trending_tags tt
+		JOIN tags t ON t.id = tt.tag_id
+		WHERE t.post_count > 0
+		ORDER BY tt.rank
+		LIMIT $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tags []TrendingTag
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Name, &t.PostCount, &t.Score, &t.ComputedAt); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// Posts returns the top of the last snapshot.
+func (s *TrendingStore) Posts(ctx context.Context, limit int) ([]TrendingPost, error) {
+	query := `
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+			u.username,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			tp.score, tp.computed_at
+		FROM trending_posts tp
+		JOIN posts p ON p.id = tp.post_id
+		JOIN users u ON u.id = p.user_id
+		ORDER BY tp.rank
+		LIMIT $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []TrendingPost
+	for rows.Next() {
+		var p TrendingPost
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.Version,
+			pq.Array(&p.Tags),
+			&p.User.Username,
+			&p.CommentCount,
+			&p.Score,
+			&p.ComputedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
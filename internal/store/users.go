@@ -11,19 +11,60 @@ import (
 )
 
 type User struct {
+	ID              int64     `json:"id"`
+	Username        string    `json:"username"`
+	Email           string    `json:"email"`
+	Password        password  `json:"-"`
+	CreatedAt       time.Time `json:"created_at"`
+	IsActive        bool      `json:"is_active"`
+	RoleID          int64     `json:"role_id"`
+	Role            Role      `json:"role"`
+	PreferredLocale string    `json:"preferred_locale"`
+	// DeletionScheduledAt is set while a requested account deletion waits
+	// for its grace period.
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+	Profile
+}
+
+// Profile holds the public, user editable part of an account.
+type Profile struct {
+	DisplayName       string     `json:"display_name"`
+	Bio               string     `json:"bio"`
+	Website           string     `json:"website"`
+	Location          string     `json:"location"`
+	AvatarID          *int64     `json:"avatar_id"`
+	UsernameChangedAt *time.Time `json:"username_changed_at,omitempty"`
+}
+
+// PublicUser is the part of an account anyone can look up, without the
+// email, the activation state, the role or the locale.
+type PublicUser struct {
 	ID        int64     `json:"id"`
 	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Password  password  `json:"-"`
 	CreatedAt time.Time `json:"created_at"`
-	IsActive  bool      `json:"is_active"`
+	Profile
+}
+
+func (u *User) Public() PublicUser {
+	return PublicUser{ID: u.ID, Username: u.Username, CreatedAt: u.CreatedAt, Profile: u.Profile}
+}
+
+type UserListQuery struct {
+	Search string
+	Active *bool
+	Limit  int
+	Offset int
 }
 
 var (
 	ErrDuplicateEmail    = errors.New("a user with that email already exists")
 	ErrDuplicateUsername = errors.New("a user with that username already exists")
+	ErrUsernameCooldown  = errors.New("the username was changed too recently")
 )
 
+// DefaultLocale is stored for users who did not pick a language.
+const DefaultLocale = "en"
+
 type password struct {
 	text *string
 	hash []byte
@@ -39,16 +80,26 @@ func (p *password) Set(text string) error {
 	return nil
 }
 
+// Matches reports whether text is the password. Only users loaded through
+// GetByID or GetByEmail carry the hash.
+func (p *password) Matches(text string) bool {
+	return len(p.hash) > 0 && bcrypt.CompareHashAndPassword(p.hash, []byte(text)) == nil
+}
+
 type UserStore struct {
 	db *sql.DB
 }
 
 func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
-	query := `INSERT INTO users (username, email, password) VALUES ($1, $2, $3) RETURNING id, created_at`
+	if user.PreferredLocale == "" {
+		user.PreferredLocale = DefaultLocale
+	}
+
+	query := `INSERT INTO users (username, email, password, preferred_locale) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
 	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
 	defer cancel()
 
-	err := tx.QueryRowContext(ctx, query, user.Username, user.Email, user.Password.hash).Scan(&user.ID, &user.CreatedAt)
+	err := tx.QueryRowContext(ctx, query, user.Username, user.Email, user.Password.hash, user.PreferredLocale).Scan(&user.ID, &user.CreatedAt)
 
 	if err != nil {
 		switch {
@@ -67,7 +118,7 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 func (s *UserStore) Delete(ctx context.Context, id int64) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 
-		if err := s.delete(ctx, tx, id); err != nill {
+		if err := s.delete(ctx, tx, id); err != nil {
 			return err
 		}
 		if err := s.deleteUserInvitation(ctx, tx, id); err != nil {
@@ -80,9 +131,61 @@ func (s *UserStore) Delete(ctx context.Context, id int64) error {
 }
 
 func (s *UserStore) GetByID(ctx context.Context, id int64) (*User, error) {
-	query := `SELECT id, username, created_at, email FROM users WHERE id = $1`
+	return s.getBy(ctx, "u.id", id)
+}
+
+// GetByUsername looks a user up by its current handle.
+func (s *UserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return s.getBy(ctx, "u.username", username)
+}
+
+// GetByEmail looks a user up by email, case insensitively.
+func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return s.getBy(ctx, "u.email", email)
+}
+
+func (s *UserStore) getBy(ctx context.Context, column string, value any) (*User, error) {
+	return getUserBy(ctx, s.db, column, value)
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func getUserBy(ctx context.Context, db queryRower, column string, value any) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.created_at, u.email, u.is_active, u.role_id, r.name, r.level, u.preferred_locale, u.password,
+			u.display_name, u.bio, u.website, u.location, u.avatar_id, u.username_changed_at,
+			u.deletion_scheduled_at
+		FROM users u
+		JOIN roles r ON r.id = u.role_id
+		WHERE ` + column + ` = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
 	var user User
-	err := s.db.QueryRowContext(ctx, query, id).Scan(&user.ID, &user.Username, &user.CreatedAt, &user.Email)
+	err := db.QueryRowContext(ctx, query, value).Scan(
+		&user.ID,
+		&user.Username,
+		&user.CreatedAt,
+		&user.Email,
+		&user.IsActive,
+		&user.RoleID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.PreferredLocale,
+		&user.Password.hash,
+		&user.DisplayName,
+		&user.Bio,
+		&user.Website,
+		&user.Location,
+		&user.AvatarID,
+		&user.UsernameChangedAt,
+		&user.DeletionScheduledAt,
+	)
 
 	if err != nil {
 		switch {
@@ -92,11 +195,208 @@ func (s *UserStore) GetByID(ctx context.Context, id int64) (*User, error) {
 			return nil, err
 		}
 	}
+	user.Role.ID = user.RoleID
 
 	return &user, nil
 }
 
-func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error {
+// List returns users ordered by id, optionally filtered by a case
+// insensitive match on username or email and by activation status.
+func (s *UserStore) List(ctx context.Context, q UserListQuery) ([]User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.created_at, u.is_active, u.role_id, r.name, r.level, u.preferred_locale,
+			u.display_name, u.bio, u.website, u.location, u.avatar_id, u.username_changed_at
+		FROM users u
+		JOIN roles r ON r.id = u.role_id
+		WHERE (u.username ILIKE '%' || $1 || '%' OR u.email ILIKE '%' || $1 || '%')
+		  AND ($2::boolean IS NULL OR u.is_active = $2)
+		ORDER BY u.id
+		LIMIT $3 OFFSET $4
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, escapeLike(q.Search), q.Active, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.CreatedAt, &u.IsActive, &u.RoleID, &u.Role.Name, &u.Role.Level, &u.PreferredLocale,
+			&u.DisplayName, &u.Bio, &u.Website, &u.Location, &u.AvatarID, &u.UsernameChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		u.Role.ID = u.RoleID
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// SetActive activates or deactivates a user, deactivating also ends its
+// sessions.
+func (s *UserStore) SetActive(ctx context.Context, id int64, active bool) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, `UPDATE users SET is_active = $1 WHERE id = $2`, active, id)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+		if active {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1`, id)
+		return err
+	})
+}
+
+func (s *UserStore) SetRole(ctx context.Context, id int64, roleID int64) error {
+	query := `UPDATE users SET role_id = $1 WHERE id = $2`
+	return s.execAffecting(ctx, query, roleID, id)
+}
+
+// ResendInvitation rotates the invitation of an inactive user and enqueues
+// the new invitation email. It fails with ErrRateLimited when the current
+// invitation was issued less than cooldown ago, returning the time left until
+// the next resend, and ErrNotFound when the user is unknown or already
+// active. A cooldown of 0 resends right away.
+func (s *UserStore) ResendInvitation(ctx context.Context, userID int64, token string, invitationExp, cooldown time.Duration, email *OutboxEmail) (time.Duration, error) {
+	var retryAfter time.Duration
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+		defer cancel()
+
+		// lock the user so concurrent resends can't both pass the cooldown
+		var id int64
+		err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE id = $1 AND NOT is_active FOR UPDATE`, userID).Scan(&id)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		var issuedAt sql.NullTime
+		err = tx.QueryRowContext(ctx, `SELECT MAX(created_at) FROM user_invitations WHERE user_id = $1`, userID).Scan(&issuedAt)
+		if err != nil {
+			return err
+		}
+		if cooldown > 0 && issuedAt.Valid && time.Since(issuedAt.Time) < cooldown {
+			retryAfter = cooldown - time.Since(issuedAt.Time)
+			return ErrRateLimited
+		}
+
+		if err := s.deleteUserInvitation(ctx, tx, userID); err != nil {
+			return err
+		}
+		if err := s.createUserInvitation(ctx, tx, token, invitationExp, userID); err != nil {
+			return err
+		}
+		return enqueueEmail(ctx, tx, email)
+	})
+	return retryAfter, err
+}
+
+// DeleteUnactivated removes the users who never activated their account and
+// whose invitation expired before expiredBefore. Users deactivated by an
+// admin have no invitation and are kept.
+func (s *UserStore) DeleteUnactivated(ctx context.Context, expiredBefore time.Time) (int64, error) {
+	query := `
+		WITH expired AS (
+			SELECT u.id
+			FROM users u
+			JOIN user_invitations ui ON ui.user_id = u.id
+			WHERE NOT u.is_active AND ui.expiry <= $1
+		), invitations AS (
+			DELETE FROM user_invitations WHERE user_id IN (SELECT id FROM expired)
+		)
+		DELETE FROM users WHERE id IN (SELECT id FROM expired)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, expiredBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// expiredInvitations matches the expired invitations DeleteExpiredInvitations
+// removes. Those of users who never activated their account are kept, they
+// are how DeleteUnactivated finds the users once the grace period is over.
+const expiredInvitations = `
+	FROM user_invitations ui
+	WHERE ui.expiry <= $1
+		AND NOT EXISTS (SELECT 1 FROM users u WHERE u.id = ui.user_id AND NOT u.is_active)
+`
+
+func (s *UserStore) CountExpiredInvitations(ctx context.Context) (int64, error) {
+	query := `SELECT COUNT(*) ` + expiredInvitations
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	var count int64
+	err := s.db.QueryRowContext(ctx, query, time.Now()).Scan(&count)
+	return count, err
+}
+
+// DeleteExpiredInvitations removes the expired invitations and returns how
+// many it removed. The users who never activated their account are left to
+// DeleteUnactivated, along with their invitation.
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	query := `DELETE ` + expiredInvitations
+
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (s *UserStore) execAffecting(ctx context.Context, query string, args ...any) error {
+	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CreateAndInvite stores the user, its invitation and the invitation email
+// in the outbox atomically, the email is delivered by the outbox dispatcher.
+func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration, email *OutboxEmail) error {
 	// create transaction wrapper
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		// create the user
@@ -107,18 +407,27 @@ func (s *UserStore) CreateAndInvite(ctx context.Context, user *User, token strin
 		if err := s.createUserInvitation(ctx, tx, token, invitationExp, user.ID); err != nil {
 			return err
 		}
+		// queue the invitation email
+		if err := enqueueEmail(ctx, tx, email); err != nil {
+			return err
+		}
 		return nil
 	})
 
 }
 
+// Activate activates the user owning token. It fails with ErrExpired when
+// the invitation exists but expired, and ErrNotFound for unknown tokens.
 func (s *UserStore) Activate(ctx context.Context, token string) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		// find user and check if not expired token
-		user, err := s.getUserFromInvitation(ctx, tx, token)
+		user, expiry, err := s.getUserFromInvitation(ctx, tx, token)
 		if err != nil {
 			return err
 		}
+		if !expiry.After(time.Now()) {
+			return ErrExpired
+		}
 		// update the user
 		user.IsActive = true
 		if err := s.update(ctx, tx, user); err != nil {
@@ -148,12 +457,12 @@ INSERT INTO user_invitations (token, user_id, expiry) VALUES ($1, $2, $3)`
 	return nil
 }
 
-func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, time.Time, error) {
 	query := `
-SELECT u.id, u.username, u.email, u.created_at, u.is_active 
+SELECT u.id, u.username, u.email, u.created_at, u.is_active, ui.expiry
 FROM users u 
 JOIN user_invitations ui ON ui.user_id = u.id
-WHERE ui.token = $1 AND  ui.expiry > $2
+WHERE ui.token = $1
 `
 
 	hash := sha256.Sum256([]byte(token))
@@ -162,16 +471,17 @@ WHERE ui.token = $1 AND  ui.expiry > $2
 	ctx, cancel := context.WithTimeout(ctx, TimeoutDuration)
 	defer cancel()
 	user := &User{}
-	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive)
+	var expiry time.Time
+	err := tx.QueryRowContext(ctx, query, hashToken).Scan(&user.ID, &user.Username, &user.Email, &user.CreatedAt, &user.IsActive, &expiry)
 	if err != nil {
 		switch err {
 		case sql.ErrNoRows:
-			return nil, ErrNotFound
+			return nil, time.Time{}, ErrNotFound
 		default:
-			return nil, err
+			return nil, time.Time{}, err
 		}
 	}
-	return user, nil
+	return user, expiry, nil
 }
 
 func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
@@ -0,0 +1,121 @@
+// Package testdb provisions a throwaway Postgres schema for tests.
+package testdb
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/igorzinar/goSocial/cmd/migrate/migrations"
+	"github.com/igorzinar/goSocial/internal/migrate"
+	_ "github.com/lib/pq"
+)
+
+// extensionLock serializes the creation of the shared extensions between
+// test binaries running in parallel.
+const extensionLock = 7162543002
+
+// New returns a connection to a fresh schema migrated to the latest version.
+// The schema is dropped when the test ends. The test is skipped unless
+// TEST_DB_ADDR points to a database it may create schemas in.
+func New(t testing.TB) *sql.DB {
+	t.Helper()
+
+	addr := os.Getenv("TEST_DB_ADDR")
+	if addr == "" {
+		t.Skip("TEST_DB_ADDR is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	admin, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	// the migrations create their extensions without a schema, they must
+	// already live in public so every test schema can see them
+	err = withLock(ctx, admin, func(tx *sql.Tx) error {
+		for _, ext := range []string{"citext", "pg_trgm"} {
+			if _, err := tx.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS `+ext+` SCHEMA public`); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := schemaName()
+	if _, err := admin.ExecContext(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := admin.ExecContext(ctx, `DROP SCHEMA `+schema+` CASCADE`); err != nil {
+			t.Errorf("dropping schema %s: %v", schema, err)
+		}
+	})
+
+	db, err := sql.Open("postgres", withSearchPath(addr, schema+",public"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrate.New(db, migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(ctx); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("migrating schema %s: %v", schema, err)
+	}
+	return db
+}
+
+func withLock(ctx context.Context, db *sql.DB, f func(*sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, extensionLock); err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func schemaName() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return "test_" + hex.EncodeToString(b)
+}
+
+// withSearchPath adds a search_path run-time parameter to a URL or key/value
+// connection string.
+func withSearchPath(addr, path string) string {
+	if u, err := url.Parse(addr); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		q := u.Query()
+		q.Set("search_path", path)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+	return strings.TrimSpace(addr) + " search_path=" + path
+}